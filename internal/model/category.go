@@ -0,0 +1,33 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Category 商品分類，可有多層子分類
+type Category struct {
+	ID        int64
+	ParentID  int64     // 上層分類ID，0 為最上層分類
+	Name      string    // 分類名稱
+	Path      string    // 所有上層分類ID，e.g. "/1/3/"，最上層分類為 "/"
+	CreatedAt time.Time // 創建時間
+	UpdatedAt time.Time // 更新時間
+}
+
+// ChildPath 返回子分類的 Path
+func (c *Category) ChildPath() string {
+	return c.Path + strconv.FormatInt(c.ID, 10) + "/"
+}
+
+// AncestorIDs 返回所有上層分類ID及自己的ID，由上到下排序
+func (c *Category) AncestorIDs() []int64 {
+	var ids = make([]int64, 0)
+	for _, s := range strings.Split(strings.Trim(c.Path, "/"), "/") {
+		if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return append(ids, c.ID)
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// Coupon 優惠碼，使用時套用關聯的優惠活動
+type Coupon struct {
+	ID             int64
+	Code           string    // 優惠碼，唯一
+	PromotionID    int64     // 關聯的 Promotion.ID
+	MaxRedemptions int32     // 總共可使用次數，0 為不限制
+	MaxPerUser     int32     // 每個用戶可使用次數，0 為不限制
+	RedeemedCount  int32     // 已使用次數
+	ExpiredAt      time.Time // 到期時間
+	CreatedAt      time.Time // 創建時間
+	UpdatedAt      time.Time // 更新時間
+
+	Promotion *Promotion // 關聯的優惠活動
+}
+
+// IsExpired 優惠碼在 now 是否已過期
+func (c *Coupon) IsExpired(now time.Time) bool {
+	return !now.Before(c.ExpiredAt)
+}
+
+// IsExhausted 優惠碼是否已達總共可使用次數
+func (c *Coupon) IsExhausted() bool {
+	return c.MaxRedemptions > 0 && c.RedeemedCount >= c.MaxRedemptions
+}
+
+// CouponRedemption 優惠碼使用紀錄
+type CouponRedemption struct {
+	ID        int64
+	CouponID  int64     // 關聯的 Coupon.ID
+	UserID    int64     // 用戶ID
+	OrderID   string    // 使用優惠碼的 OrderID
+	CreatedAt time.Time // 創建時間
+}
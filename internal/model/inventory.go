@@ -8,6 +8,7 @@ type Inventory struct {
 	ProductID         int64 // 關聯 Product.ID
 	TotalQuantity     int32 // 總庫存數量
 	AvailableQuantity int32 // 可售庫存數量
+	ReservedQuantity  int32 // 保留中的庫存數量，已從可售庫存扣除，等待結帳確認
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 }
@@ -16,3 +17,61 @@ type QuantityOperation struct {
 	Operation NumericOperation
 	Quantity  int32
 }
+
+// StockMovementCause 庫存異動原因
+type StockMovementCause int8
+
+const (
+	StockMovementCauseUnknown          StockMovementCause = iota
+	StockMovementCauseSale                                // 銷售
+	StockMovementCauseRefund                              // 退款、取消訂單
+	StockMovementCauseRestock                             // 進貨
+	StockMovementCauseManualCorrection                    // 人工校正
+	StockMovementCauseReservation                         // 保留、釋放保留
+)
+
+func (c StockMovementCause) Str() string {
+	switch c {
+	case StockMovementCauseSale:
+		return "Sale"
+	case StockMovementCauseRefund:
+		return "Refund"
+	case StockMovementCauseRestock:
+		return "Restock"
+	case StockMovementCauseManualCorrection:
+		return "ManualCorrection"
+	case StockMovementCauseReservation:
+		return "Reservation"
+	default:
+		return "Unknown"
+	}
+}
+
+// StockMovement 庫存異動紀錄，只新增不修改
+type StockMovement struct {
+	ID             int64
+	InventoryID    int64              // 關聯 Inventory.ID
+	ProductID      int64              // 關聯 Product.ID
+	Cause          StockMovementCause // 異動原因
+	ReferenceID    string             // 關聯的單號，e.g. 訂單ID、保留單ID、進貨單號
+	OperatorID     int64              // 操作者ID，OperatorSystem 為系統
+	Note           string             // 備註
+	TotalDelta     int32              // 總庫存異動量
+	AvailableDelta int32              // 可售庫存異動量
+	ReservedDelta  int32              // 保留庫存異動量
+	TotalAfter     int32              // 異動後的總庫存
+	AvailableAfter int32              // 異動後的可售庫存
+	ReservedAfter  int32              // 異動後的保留庫存
+	CreatedAt      time.Time
+}
+
+// Delta 返回操作的異動量，減少為負數
+func (q *QuantityOperation) Delta() int32 {
+	if q == nil {
+		return 0
+	}
+	if q.Operation == NumericOperationSub {
+		return -q.Quantity
+	}
+	return q.Quantity
+}
@@ -6,9 +6,61 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// OrderStatus 訂單狀態
+type OrderStatus int8
+
+const (
+	OrderStatusUnknown           OrderStatus = iota
+	OrderStatusPaid                          // 已付款
+	OrderStatusFulfilled                     // 已完成
+	OrderStatusCancelled                     // 已取消
+	OrderStatusRefunded                      // 已全額退款
+	OrderStatusPartiallyRefunded             // 已部分退款
+	OrderStatusPending                       // 待付款
+)
+
+// orderStatusTransitions 訂單狀態可轉換的下一個狀態
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusUnknown:           {OrderStatusPending, OrderStatusPaid},
+	OrderStatusPending:           {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:              {OrderStatusFulfilled, OrderStatusCancelled, OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusFulfilled:         {OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusPartiallyRefunded: {OrderStatusFulfilled, OrderStatusRefunded, OrderStatusPartiallyRefunded},
+}
+
+// CanTransitTo 是否可以從目前狀態轉換到 next
+func (o OrderStatus) CanTransitTo(next OrderStatus) bool {
+	for _, status := range orderStatusTransitions[o] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+func (o OrderStatus) Str() string {
+	switch o {
+	case OrderStatusPaid:
+		return "Paid"
+	case OrderStatusFulfilled:
+		return "Fulfilled"
+	case OrderStatusCancelled:
+		return "Cancelled"
+	case OrderStatusRefunded:
+		return "Refunded"
+	case OrderStatusPartiallyRefunded:
+		return "PartiallyRefunded"
+	case OrderStatusPending:
+		return "Pending"
+	default:
+		return "Unknown"
+	}
+}
+
 type Order struct {
 	ID            string
 	UserID        int64           // 用戶ID
+	Status        OrderStatus     // 訂單狀態
 	OriginalPrice decimal.Decimal // 原始價格
 	FinalPrice    decimal.Decimal // 最終價格 (扣除優惠活動)
 	UsedPoints    int32           // 使用平台點數
@@ -16,18 +68,211 @@ type Order struct {
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 
+	PriceBreakdown []*PriceStep // 依序計算每個優惠的明細
+	CouponCodes    []string     // 使用的優惠碼
+
 	Items      []*OrderItem // 關聯的商品 Product
 	Promotions []*Promotion // 使用的優惠 Promotion
 }
 
+// OrderIdempotencyKey 建立訂單請求的冪等紀錄
+// 同一個用戶以相同 Key 重送請求時，返回第一次請求的結果
+type OrderIdempotencyKey struct {
+	ID           int64
+	UserID       int64     // 用戶ID
+	Key          string    // 客戶端提供的冪等鍵
+	RequestHash  string    // 請求內容的雜湊，用來判斷重送的是否為相同的購物車
+	OrderID      string    // 成功建立的訂單ID
+	ErrorCode    string    // 建立訂單失敗的錯誤代碼
+	ErrorMessage string    // 建立訂單失敗的錯誤訊息
+	CreatedAt    time.Time // 創建時間
+	UpdatedAt    time.Time // 更新時間
+}
+
+// OperatorSystem 由系統執行的操作
+const OperatorSystem int64 = 0
+
+// OrderStatusHistory 訂單狀態變更紀錄
+type OrderStatusHistory struct {
+	ID         int64
+	OrderID    string      // 關聯的 OrderID
+	FromStatus OrderStatus // 變更前狀態
+	ToStatus   OrderStatus // 變更後狀態
+	OperatorID int64       // 操作者ID，0 為系統
+	Reason     string      // 變更原因
+	CreatedAt  time.Time   // 變更時間
+}
+
+// AllocateItemPrices 將訂單的折扣及使用的平台點數分攤到 OrderItem
+// 只折扣部分商品的優惠只分攤到 PriceStep.AffectedProductIDs 的商品，其他優惠依各商品目前金額的比例分攤
+// 點數依各商品原始金額的比例分攤，最後一個商品分攤剩餘的點數，確保加總等於訂單的 UsedPoints
+func (o *Order) AllocateItemPrices() {
+	var (
+		prices = make([]decimal.Decimal, len(o.Items))
+		all    = make([]int, len(o.Items))
+	)
+	for i, item := range o.Items {
+		prices[i] = item.OriginalPrice()
+		all[i] = i
+	}
+
+	for _, step := range o.PriceBreakdown {
+		if step.SkipReason != "" || !step.SavedAmount.IsPositive() {
+			continue
+		}
+
+		indexes := all
+		if len(step.AffectedProductIDs) > 0 {
+			indexes = o.itemIndexes(step.AffectedProductIDs)
+		}
+
+		// 指定商品的金額不足折抵時，剩餘的折扣由所有商品分攤
+		if remaining := allocateDiscount(prices, indexes, step.SavedAmount); remaining.IsPositive() {
+			allocateDiscount(prices, all, remaining)
+		}
+	}
+
+	// 沒有計算明細的折扣 (例如舊的訂單) 依比例分攤，確保加總等於訂單的 FinalPrice
+	var total decimal.Decimal
+	for _, price := range prices {
+		total = total.Add(price)
+	}
+	if remaining := total.Sub(o.FinalPrice); remaining.IsPositive() {
+		allocateDiscount(prices, all, remaining)
+	}
+
+	remainingPoints := o.UsedPoints
+	for i, item := range o.Items {
+		itemPrice := item.OriginalPrice()
+
+		if i == len(o.Items)-1 {
+			item.UsedPoints = remainingPoints
+		} else if o.OriginalPrice.IsZero() {
+			item.UsedPoints = 0
+		} else {
+			item.UsedPoints = int32(decimal.NewFromInt32(o.UsedPoints).Mul(itemPrice).Div(o.OriginalPrice).IntPart())
+		}
+		item.FinalPrice = prices[i]
+		item.DiscountAmount = itemPrice.Sub(item.FinalPrice)
+
+		remainingPoints -= item.UsedPoints
+	}
+}
+
+// itemIndexes 返回 productIDs 對應的 OrderItem 索引
+func (o *Order) itemIndexes(productIDs []int64) []int {
+	indexes := make([]int, 0, len(productIDs))
+	for i, item := range o.Items {
+		for _, productID := range productIDs {
+			if item.ProductID == productID {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// allocateDiscount 將 amount 依 prices 的比例從 indexes 的商品扣除，每個商品最多扣到 0
+// 最後一個商品分攤剩餘的金額，返回商品金額不足而沒有分攤的金額
+func allocateDiscount(prices []decimal.Decimal, indexes []int, amount decimal.Decimal) decimal.Decimal {
+	var total decimal.Decimal
+	for _, i := range indexes {
+		total = total.Add(prices[i])
+	}
+	if !total.IsPositive() {
+		return amount
+	}
+
+	var (
+		allocating = decimal.Min(amount, total)
+		remaining  = allocating
+	)
+	for n, i := range indexes {
+		share := remaining
+		if n < len(indexes)-1 {
+			share = allocating.Mul(prices[i]).Div(total).Round(tokenPlaces)
+		}
+		share = decimal.Min(share, prices[i], remaining)
+
+		prices[i] = prices[i].Sub(share)
+		remaining = remaining.Sub(share)
+	}
+
+	return amount.Sub(allocating).Add(remaining)
+}
+
+// tokenPlaces 分攤平台幣時保留的小數位數
+const tokenPlaces = 2
+
+// PriceStep 訂單計算單一優惠活動的明細
+type PriceStep struct {
+	PromotionID   int64
+	PromotionType PromotionType
+	BeforePrice   decimal.Decimal // 計算優惠前的價格
+	AfterPrice    decimal.Decimal // 計算優惠後的價格
+	SavedAmount   decimal.Decimal // 折抵的金額
+	SkipReason    string          // 未套用優惠的原因，有套用則為空
+	CouponCode    string          // 透過優惠碼套用時的優惠碼
+	Rule          PricingRule     // 決定套用或不套用這個優惠的規則
+
+	AffectedProductIDs []int64 // 只折扣部分商品時，被折扣的 OrderItem.ProductID
+	PromotionVersion   int32   // 計算時的活動內容版本
+}
+
+func NewPriceStep(promotion *Promotion, beforePrice decimal.Decimal, output *CalculatePriceOutput) *PriceStep {
+	return &PriceStep{
+		PromotionID:   promotion.ID,
+		PromotionType: promotion.Type,
+		BeforePrice:   beforePrice,
+		AfterPrice:    output.AfterPrice,
+		SavedAmount:   beforePrice.Sub(output.AfterPrice),
+		SkipReason:    output.SkipReason,
+
+		AffectedProductIDs: output.AffectedProductIDs,
+		PromotionVersion:   promotion.Version,
+	}
+}
+
 // OrderItem 訂單詳情的紀錄
 type OrderItem struct {
-	ID        int64
-	OrderID   string          // 關聯的 OrderID
-	ProductID int64           // Product 的 ID
-	Name      string          // 商品名稱
-	UnitPrice decimal.Decimal // 平台幣/單價
-	Quantity  int32           // 數量
+	ID             int64
+	OrderID        string          // 關聯的 OrderID
+	ProductID      int64           // Product 的 ID
+	Name           string          // 商品名稱
+	UnitPrice      decimal.Decimal // 平台幣/單價
+	Quantity       int32           // 數量
+	DiscountAmount decimal.Decimal // 分攤到的折扣金額
+	FinalPrice     decimal.Decimal // 分攤折扣後實付的平台幣
+	UsedPoints     int32           // 分攤到的平台點數
+
+	RefundedQuantity int32           // 已退款數量
+	RefundedToken    decimal.Decimal // 已退回的平台幣
+	RefundedPoints   int32           // 已退回的平台點數
+}
+
+// OriginalPrice 商品的原始總金額
+func (i *OrderItem) OriginalPrice() decimal.Decimal {
+	return i.UnitPrice.Mul(decimal.NewFromInt32(i.Quantity))
+}
+
+// RefundableQuantity 剩餘可退款的數量
+func (i *OrderItem) RefundableQuantity() int32 {
+	return i.Quantity - i.RefundedQuantity
+}
+
+// RefundAmount 計算退款 quantity 個商品應退回的平台幣及平台點數
+// 退回最後剩餘的商品時，返回所有尚未退回的金額及點數
+func (i *OrderItem) RefundAmount(quantity int32) (token decimal.Decimal, points int32) {
+	if quantity >= i.RefundableQuantity() {
+		return i.FinalPrice.Sub(i.RefundedToken), i.UsedPoints - i.RefundedPoints
+	}
+
+	ratio := decimal.NewFromInt32(quantity).Div(decimal.NewFromInt32(i.Quantity))
+	token = i.FinalPrice.Mul(ratio).Round(tokenPlaces)
+	points = int32(decimal.NewFromInt32(i.UsedPoints).Mul(ratio).IntPart())
+
+	return token, points
 }
 
 type PurchaseProduct struct {
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOrder(steps []*PriceStep, usedPoints int32) *Order {
+	order := &Order{
+		OriginalPrice:  decimal.NewFromInt(300),
+		FinalPrice:     decimal.NewFromInt(300),
+		UsedPoints:     usedPoints,
+		PriceBreakdown: steps,
+		Items: []*OrderItem{
+			{ProductID: 1, UnitPrice: decimal.NewFromInt(50), Quantity: 2},
+			{ProductID: 2, UnitPrice: decimal.NewFromInt(200), Quantity: 1},
+		},
+	}
+	for _, step := range steps {
+		order.FinalPrice = order.FinalPrice.Sub(step.SavedAmount)
+	}
+	return order
+}
+
+func TestOrderAllocateItemPrices(t *testing.T) {
+	// 商品折扣只分攤到被折扣的商品，退款沒有折扣的商品時退回原價
+	order := newTestOrder([]*PriceStep{
+		{PromotionType: PromotionTypeProductDiscount, SavedAmount: decimal.NewFromInt(20), AffectedProductIDs: []int64{1}},
+	}, 0)
+	order.AllocateItemPrices()
+
+	require.True(t, decimal.NewFromInt(80).Equal(order.Items[0].FinalPrice))
+	require.True(t, decimal.NewFromInt(20).Equal(order.Items[0].DiscountAmount))
+	require.True(t, decimal.NewFromInt(200).Equal(order.Items[1].FinalPrice))
+	require.True(t, order.Items[1].DiscountAmount.IsZero())
+
+	token, points := order.Items[1].RefundAmount(1)
+	require.True(t, decimal.NewFromInt(200).Equal(token))
+	require.Zero(t, points)
+
+	token, _ = order.Items[0].RefundAmount(1)
+	require.True(t, decimal.NewFromInt(40).Equal(token))
+}
+
+func TestOrderAllocateItemPricesOrderLevel(t *testing.T) {
+	// 訂單層級的折扣依商品目前金額的比例分攤，略過沒有套用的活動
+	order := newTestOrder([]*PriceStep{
+		{PromotionType: PromotionTypeProductDiscount, SavedAmount: decimal.NewFromInt(20), AffectedProductIDs: []int64{1}},
+		{PromotionType: PromotionTypeMember, SkipReason: SkipReasonMemberLevelNotMatch},
+		{PromotionType: PromotionTypePoint, SavedAmount: decimal.NewFromInt(28)},
+	}, 28)
+	order.AllocateItemPrices()
+
+	require.True(t, decimal.NewFromInt(72).Equal(order.Items[0].FinalPrice))
+	require.True(t, decimal.NewFromInt(180).Equal(order.Items[1].FinalPrice))
+	require.Equal(t, int32(28), order.Items[0].UsedPoints+order.Items[1].UsedPoints)
+
+	// 指定商品的金額不足折抵時，剩餘的折扣由所有商品分攤
+	order = newTestOrder([]*PriceStep{
+		{PromotionType: PromotionTypeProductDiscount, SavedAmount: decimal.NewFromInt(130), AffectedProductIDs: []int64{1}},
+	}, 0)
+	order.AllocateItemPrices()
+
+	require.True(t, order.Items[0].FinalPrice.IsZero())
+	require.True(t, decimal.NewFromInt(170).Equal(order.Items[1].FinalPrice))
+}
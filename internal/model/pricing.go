@@ -0,0 +1,152 @@
+package model
+
+import (
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// PricingMode 多個優惠活動一起計算的方式
+type PricingMode int8
+
+const (
+	// PricingModePriority 依優先順序計算，與先套用的活動衝突時不套用
+	PricingModePriority PricingMode = iota
+	// PricingModeBestPrice 計算所有可套用的活動組合，選擇用戶付最少的組合
+	PricingModeBestPrice
+)
+
+func (m PricingMode) Str() string {
+	switch m {
+	case PricingModePriority:
+		return "Priority"
+	case PricingModeBestPrice:
+		return "BestPrice"
+	default:
+		return "Unknown"
+	}
+}
+
+// bestPriceMaxCandidates 最佳價格模式最多計算的活動數量，超過時依優先順序計算
+const bestPriceMaxCandidates = 12
+
+// PricingRule 決定套用或不套用優惠活動的規則
+type PricingRule string
+
+const (
+	PricingRuleRequirement PricingRule = "requirement" // 活動本身的條件，不套用的原因見 PriceStep.SkipReason
+	PricingRulePriority    PricingRule = "priority"    // 依優先順序套用
+	PricingRuleExclusive   PricingRule = "exclusive"   // 獨佔活動不與其他活動一起套用
+	PricingRuleStackGroup  PricingRule = "stack_group" // 同一個疊加群組只套用一個活動
+	PricingRuleBestPrice   PricingRule = "best_price"  // 最佳價格模式選出的組合
+)
+
+// PricingCandidate 計算訂單金額時可套用的優惠活動
+type PricingCandidate struct {
+	Promotion  *Promotion
+	CouponCode string // 透過優惠碼套用時的優惠碼
+}
+
+// PricingResult 計算訂單金額的結果
+type PricingResult struct {
+	FinalPrice decimal.Decimal
+	Steps      []*PriceStep        // 每個活動的計算明細，依計算順序
+	Applied    []*PricingCandidate // 有套用的活動
+}
+
+// PointsApplied 是否有套用平台點數折抵的活動，沒有套用時不應扣除用戶的點數
+func (r *PricingResult) PointsApplied() bool {
+	for _, c := range r.Applied {
+		if c.Promotion.Type == PromotionTypePoint {
+			return true
+		}
+	}
+	return false
+}
+
+// SortPricingCandidates 依 Promotion.Priority 由大到小排序，相同時維持原本的順序
+func SortPricingCandidates(candidates []*PricingCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Promotion.Priority > candidates[j].Promotion.Priority
+	})
+}
+
+// CalculatePricing 依 mode 計算套用 candidates 後的訂單金額，candidates 需依計算順序排列
+func CalculatePricing(mode PricingMode, originalPrice decimal.Decimal, candidates []*PricingCandidate, input *CalculatePriceInput) *PricingResult {
+	all := make([]bool, len(candidates))
+	for i := range all {
+		all[i] = true
+	}
+
+	if mode != PricingModeBestPrice || len(candidates) > bestPriceMaxCandidates {
+		return applyPricingCandidates(originalPrice, candidates, all, input, PricingRulePriority)
+	}
+
+	// 從全部都可套用的組合開始，金額相同時保留先計算的組合
+	best := applyPricingCandidates(originalPrice, candidates, all, input, PricingRuleBestPrice)
+	for mask := 1<<len(candidates) - 2; mask >= 0; mask-- {
+		allowed := make([]bool, len(candidates))
+		for i := range candidates {
+			allowed[i] = mask&(1<<i) != 0
+		}
+
+		result := applyPricingCandidates(originalPrice, candidates, allowed, input, PricingRuleBestPrice)
+		if result.FinalPrice.LessThan(best.FinalPrice) {
+			best = result
+		}
+	}
+
+	return best
+}
+
+// applyPricingCandidates 依順序計算 allowed 的活動，與已套用的活動衝突時不套用
+// appliedRule 為有套用的活動紀錄的規則
+func applyPricingCandidates(originalPrice decimal.Decimal, candidates []*PricingCandidate, allowed []bool, input *CalculatePriceInput, appliedRule PricingRule) *PricingResult {
+	var (
+		afterPrice       = originalPrice
+		exclusiveApplied bool
+		appliedGroups    = make(map[string]bool)
+		result           = &PricingResult{
+			Steps:   make([]*PriceStep, 0, len(candidates)),
+			Applied: make([]*PricingCandidate, 0, len(candidates)),
+		}
+	)
+
+	for i, c := range candidates {
+		var (
+			output *CalculatePriceOutput
+			rule   PricingRule
+		)
+
+		switch {
+		case !allowed[i]:
+			output, rule = skippedPromotion(afterPrice, SkipReasonNotBestCombination), PricingRuleBestPrice
+		case exclusiveApplied || (c.Promotion.Exclusive && len(result.Applied) > 0):
+			output, rule = skippedPromotion(afterPrice, SkipReasonExclusiveConflict), PricingRuleExclusive
+		case c.Promotion.StackGroup != "" && appliedGroups[c.Promotion.StackGroup]:
+			output, rule = skippedPromotion(afterPrice, SkipReasonStackGroupConflict), PricingRuleStackGroup
+		default:
+			output, rule = c.Promotion.CalculatePrice(afterPrice, input), appliedRule
+			if !output.Used {
+				rule = PricingRuleRequirement
+			}
+		}
+
+		step := NewPriceStep(c.Promotion, afterPrice, output)
+		step.CouponCode = c.CouponCode
+		step.Rule = rule
+		result.Steps = append(result.Steps, step)
+
+		if output.Used {
+			result.Applied = append(result.Applied, c)
+			exclusiveApplied = exclusiveApplied || c.Promotion.Exclusive
+			if c.Promotion.StackGroup != "" {
+				appliedGroups[c.Promotion.StackGroup] = true
+			}
+		}
+		afterPrice = output.AfterPrice
+	}
+	result.FinalPrice = afterPrice
+
+	return result
+}
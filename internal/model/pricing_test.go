@@ -0,0 +1,238 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedDiscountExt 測試用的活動內容，折抵固定金額，金額為 0 時不符合條件
+type fixedDiscountExt struct {
+	amount int64
+}
+
+func (e *fixedDiscountExt) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
+	if e.amount == 0 {
+		return skippedPromotion(beforePrice, SkipReasonNoEligibleItems)
+	}
+	return usedPromotion(beforePrice.Sub(decimal.Min(decimal.NewFromInt(e.amount), beforePrice)))
+}
+
+func (e *fixedDiscountExt) Validate() error {
+	return nil
+}
+
+// newCandidate 建立折抵 amount 的活動，modify 可以修改優先順序、獨佔及疊加群組
+func newCandidate(id, amount int64, modify ...func(p *Promotion)) *PricingCandidate {
+	p := &Promotion{ID: id, Extension: &fixedDiscountExt{amount: amount}}
+	for _, m := range modify {
+		m(p)
+	}
+	return &PricingCandidate{Promotion: p}
+}
+
+func exclusive(p *Promotion) { p.Exclusive = true }
+
+func priority(priority int32) func(p *Promotion) {
+	return func(p *Promotion) { p.Priority = priority }
+}
+
+func stackGroup(group string) func(p *Promotion) {
+	return func(p *Promotion) { p.StackGroup = group }
+}
+
+// expectedStep 預期的計算明細，skipReason 為空時表示有套用
+type expectedStep struct {
+	promotionID int64
+	rule        PricingRule
+	skipReason  string
+}
+
+func TestCalculatePricing(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       PricingMode
+		candidates []*PricingCandidate
+		finalPrice int64
+		steps      []expectedStep
+	}{
+		{
+			name:       "priority: stack all",
+			mode:       PricingModePriority,
+			candidates: []*PricingCandidate{newCandidate(1, 10), newCandidate(2, 20)},
+			finalPrice: 70,
+			steps: []expectedStep{
+				{promotionID: 1, rule: PricingRulePriority},
+				{promotionID: 2, rule: PricingRulePriority},
+			},
+		},
+		{
+			name:       "priority: requirement not met",
+			mode:       PricingModePriority,
+			candidates: []*PricingCandidate{newCandidate(1, 0), newCandidate(2, 20)},
+			finalPrice: 80,
+			steps: []expectedStep{
+				{promotionID: 1, rule: PricingRuleRequirement, skipReason: SkipReasonNoEligibleItems},
+				{promotionID: 2, rule: PricingRulePriority},
+			},
+		},
+		{
+			name:       "priority: exclusive after applied promotion is skipped",
+			mode:       PricingModePriority,
+			candidates: []*PricingCandidate{newCandidate(1, 10), newCandidate(2, 30, exclusive)},
+			finalPrice: 90,
+			steps: []expectedStep{
+				{promotionID: 1, rule: PricingRulePriority},
+				{promotionID: 2, rule: PricingRuleExclusive, skipReason: SkipReasonExclusiveConflict},
+			},
+		},
+		{
+			name:       "priority: applied exclusive blocks later promotions",
+			mode:       PricingModePriority,
+			candidates: []*PricingCandidate{newCandidate(1, 30, exclusive), newCandidate(2, 10)},
+			finalPrice: 70,
+			steps: []expectedStep{
+				{promotionID: 1, rule: PricingRulePriority},
+				{promotionID: 2, rule: PricingRuleExclusive, skipReason: SkipReasonExclusiveConflict},
+			},
+		},
+		{
+			name: "priority: one promotion per stack group",
+			mode: PricingModePriority,
+			candidates: []*PricingCandidate{
+				newCandidate(1, 10, stackGroup("g")),
+				newCandidate(2, 20, stackGroup("g")),
+				newCandidate(3, 5, stackGroup("other")),
+			},
+			finalPrice: 85,
+			steps: []expectedStep{
+				{promotionID: 1, rule: PricingRulePriority},
+				{promotionID: 2, rule: PricingRuleStackGroup, skipReason: SkipReasonStackGroupConflict},
+				{promotionID: 3, rule: PricingRulePriority},
+			},
+		},
+		{
+			name:       "best price: exclusive beats stacked promotions",
+			mode:       PricingModeBestPrice,
+			candidates: []*PricingCandidate{newCandidate(1, 10), newCandidate(2, 30, exclusive)},
+			finalPrice: 70,
+			steps: []expectedStep{
+				{promotionID: 1, rule: PricingRuleBestPrice, skipReason: SkipReasonNotBestCombination},
+				{promotionID: 2, rule: PricingRuleBestPrice},
+			},
+		},
+		{
+			name:       "best price: stacked promotions beat exclusive",
+			mode:       PricingModeBestPrice,
+			candidates: []*PricingCandidate{newCandidate(1, 20), newCandidate(2, 30, exclusive), newCandidate(3, 20)},
+			finalPrice: 60,
+			steps: []expectedStep{
+				{promotionID: 1, rule: PricingRuleBestPrice},
+				{promotionID: 2, rule: PricingRuleExclusive, skipReason: SkipReasonExclusiveConflict},
+				{promotionID: 3, rule: PricingRuleBestPrice},
+			},
+		},
+		{
+			name: "best price: larger discount in the same stack group",
+			mode: PricingModeBestPrice,
+			candidates: []*PricingCandidate{
+				newCandidate(1, 10, stackGroup("g")),
+				newCandidate(2, 20, stackGroup("g")),
+			},
+			finalPrice: 80,
+			steps: []expectedStep{
+				{promotionID: 1, rule: PricingRuleBestPrice, skipReason: SkipReasonNotBestCombination},
+				{promotionID: 2, rule: PricingRuleBestPrice},
+			},
+		},
+		{
+			// 金額相同時保留先計算的組合，即全部可套用的組合
+			name:       "best price: tie keeps the full combination",
+			mode:       PricingModeBestPrice,
+			candidates: []*PricingCandidate{newCandidate(1, 20, exclusive), newCandidate(2, 20, exclusive)},
+			finalPrice: 80,
+			steps: []expectedStep{
+				{promotionID: 1, rule: PricingRuleBestPrice},
+				{promotionID: 2, rule: PricingRuleExclusive, skipReason: SkipReasonExclusiveConflict},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CalculatePricing(tt.mode, decimal.NewFromInt(100), tt.candidates, &CalculatePriceInput{})
+			require.True(t, decimal.NewFromInt(tt.finalPrice).Equal(result.FinalPrice), "final price: %s", result.FinalPrice)
+			require.Len(t, result.Steps, len(tt.steps))
+
+			var applied []int64
+			for i, expected := range tt.steps {
+				step := result.Steps[i]
+				require.Equal(t, expected.promotionID, step.PromotionID)
+				require.Equal(t, expected.rule, step.Rule, "promotion(%d)", step.PromotionID)
+				require.Equal(t, expected.skipReason, step.SkipReason, "promotion(%d)", step.PromotionID)
+				if expected.skipReason == "" {
+					applied = append(applied, expected.promotionID)
+				}
+			}
+
+			var actual []int64
+			for _, c := range result.Applied {
+				actual = append(actual, c.Promotion.ID)
+			}
+			require.Equal(t, applied, actual)
+		})
+	}
+}
+
+func TestCalculatePricingBestPriceFallback(t *testing.T) {
+	// 活動數量超過 bestPriceMaxCandidates 時依優先順序計算
+	candidates := make([]*PricingCandidate, 0, bestPriceMaxCandidates+1)
+	for i := 0; i <= bestPriceMaxCandidates; i++ {
+		candidates = append(candidates, newCandidate(int64(i+1), 1))
+	}
+
+	result := CalculatePricing(PricingModeBestPrice, decimal.NewFromInt(100), candidates, &CalculatePriceInput{})
+	require.True(t, decimal.NewFromInt(100-int64(len(candidates))).Equal(result.FinalPrice))
+	for _, step := range result.Steps {
+		require.Equal(t, PricingRulePriority, step.Rule)
+	}
+}
+
+func TestCalculatePricingPointsApplied(t *testing.T) {
+	point := &PricingCandidate{Promotion: &Promotion{
+		ID:        1,
+		Type:      PromotionTypePoint,
+		Extension: &PromotionExtPoint{Ratio: decimal.NewFromInt(1)},
+	}}
+	input := &CalculatePriceInput{UsedPoints: 30}
+
+	result := CalculatePricing(PricingModePriority, decimal.NewFromInt(100), []*PricingCandidate{point}, input)
+	require.True(t, decimal.NewFromInt(70).Equal(result.FinalPrice))
+	require.True(t, result.PointsApplied())
+
+	// 獨佔活動優先套用時不套用點數折抵，也不應扣除點數
+	candidates := []*PricingCandidate{newCandidate(2, 40, exclusive, priority(10)), point}
+	SortPricingCandidates(candidates)
+	result = CalculatePricing(PricingModePriority, decimal.NewFromInt(100), candidates, input)
+	require.True(t, decimal.NewFromInt(60).Equal(result.FinalPrice))
+	require.Equal(t, SkipReasonExclusiveConflict, result.Steps[1].SkipReason)
+	require.False(t, result.PointsApplied())
+}
+
+func TestSortPricingCandidates(t *testing.T) {
+	// 依優先順序由大到小，相同時維持原本的順序
+	candidates := []*PricingCandidate{
+		newCandidate(1, 10),
+		newCandidate(2, 10, priority(5)),
+		newCandidate(3, 10),
+		newCandidate(4, 10, priority(5)),
+	}
+	SortPricingCandidates(candidates)
+
+	var ids []int64
+	for _, c := range candidates {
+		ids = append(ids, c.Promotion.ID)
+	}
+	require.Equal(t, []int64{2, 4, 1, 3}, ids)
+}
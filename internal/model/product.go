@@ -14,6 +14,22 @@ const (
 	ProductStatusDown                  // 下架
 )
 
+// productStatusTransitions 商品狀態可轉換的下一個狀態
+var productStatusTransitions = map[ProductStatus][]ProductStatus{
+	ProductStatusOn:   {ProductStatusDown},
+	ProductStatusDown: {ProductStatusOn},
+}
+
+// CanTransitTo 是否可以從目前狀態轉換到 next
+func (p ProductStatus) CanTransitTo(next ProductStatus) bool {
+	for _, status := range productStatusTransitions[p] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
 func (p ProductStatus) Str() string {
 	switch p {
 	case ProductStatusOn:
@@ -27,12 +43,14 @@ func (p ProductStatus) Str() string {
 
 // Product 產品
 type Product struct {
-	ID        int64
-	Name      string          // 商品名稱
-	Status    ProductStatus   // 商品上下架狀態
-	Price     decimal.Decimal // 價格(單位：平台幣)
-	CreatedAt time.Time       // 創建時間
-	UpdatedAt time.Time       // 更新時間
+	ID         int64
+	Name       string          // 商品名稱
+	Status     ProductStatus   // 商品上下架狀態
+	Price      decimal.Decimal // 價格(單位：平台幣)
+	CategoryID int64           // 商品分類ID，0 為未分類
+	Tags       []string        // 商品標籤
+	CreatedAt  time.Time       // 創建時間
+	UpdatedAt  time.Time       // 更新時間
 
 	Inventory *Inventory // 庫存
 }
@@ -12,7 +12,17 @@ import (
 )
 
 // ValidPromotionTypes 優惠活動類型
-var ValidPromotionTypes = []PromotionType{PromotionTypeMember, PromotionTypePoint, PromotionTypeExtraDiscount}
+// 依順序計算優惠
+var ValidPromotionTypes = []PromotionType{
+	PromotionTypeMember,
+	PromotionTypeProductDiscount,
+	PromotionTypeBuyXGetY,
+	PromotionTypeBundle,
+	PromotionTypeCategoryDiscount,
+	PromotionTypeSpendTier,
+	PromotionTypePoint,
+	PromotionTypeExtraDiscount,
+}
 
 // PromotionType 優惠類型
 type PromotionType int8
@@ -25,8 +35,85 @@ const (
 	PromotionTypePoint
 	// PromotionTypeExtraDiscount 額外優惠
 	PromotionTypeExtraDiscount
+	// PromotionTypeCategoryDiscount 指定分類或標籤的商品優惠
+	PromotionTypeCategoryDiscount
+	// PromotionTypeProductDiscount 指定商品的優惠
+	PromotionTypeProductDiscount
+	// PromotionTypeBuyXGetY 買 X 送 Y
+	PromotionTypeBuyXGetY
+	// PromotionTypeBundle 組合價
+	PromotionTypeBundle
+	// PromotionTypeSpendTier 滿額折扣
+	PromotionTypeSpendTier
+)
+
+// PromotionStatus 活動狀態
+type PromotionStatus int8
+
+const (
+	// PromotionStatusUnknown 加入活動狀態前建立的活動，視為進行中
+	PromotionStatusUnknown   PromotionStatus = iota
+	PromotionStatusDraft                     // 草稿，不會被套用
+	PromotionStatusScheduled                 // 已發布，等待開始
+	PromotionStatusLive                      // 進行中
+	PromotionStatusEnded                     // 已結束
+	PromotionStatusArchived                  // 已封存
 )
 
+// PublishedPromotionStatuses 已發布的活動狀態，查詢可套用的活動時使用
+var PublishedPromotionStatuses = []PromotionStatus{PromotionStatusUnknown, PromotionStatusScheduled, PromotionStatusLive}
+
+// promotionStatusTransitions 活動狀態可轉換的下一個狀態
+var promotionStatusTransitions = map[PromotionStatus][]PromotionStatus{
+	PromotionStatusUnknown:   {PromotionStatusEnded, PromotionStatusArchived},
+	PromotionStatusDraft:     {PromotionStatusScheduled, PromotionStatusLive, PromotionStatusArchived},
+	PromotionStatusScheduled: {PromotionStatusDraft, PromotionStatusLive, PromotionStatusEnded, PromotionStatusArchived},
+	PromotionStatusLive:      {PromotionStatusEnded, PromotionStatusArchived},
+	PromotionStatusEnded:     {PromotionStatusArchived},
+}
+
+// CanTransitTo 是否可以從目前狀態轉換到 next
+func (s PromotionStatus) CanTransitTo(next PromotionStatus) bool {
+	for _, status := range promotionStatusTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPublished 是否已發布，已發布的活動在活動期間內才會被套用
+func (s PromotionStatus) IsPublished() bool {
+	for _, status := range PublishedPromotionStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLive 是否進行中，沒有狀態的舊活動視為進行中
+func (s PromotionStatus) IsLive() bool {
+	return s == PromotionStatusLive || s == PromotionStatusUnknown
+}
+
+func (s PromotionStatus) Str() string {
+	switch s {
+	case PromotionStatusDraft:
+		return "Draft"
+	case PromotionStatusScheduled:
+		return "Scheduled"
+	case PromotionStatusLive:
+		return "Live"
+	case PromotionStatusEnded:
+		return "Ended"
+	case PromotionStatusArchived:
+		return "Archived"
+	default:
+		return "Unknown"
+	}
+}
+
 // Promotion 優惠活動
 type Promotion struct {
 	ID          int64         // ID
@@ -35,10 +122,205 @@ type Promotion struct {
 	Type        PromotionType // 活動類型
 	Extension   IPromotionExt // 活動內容
 	IsDefault   bool          // 是否為預設活動
+	CouponOnly  bool          // 只能透過優惠碼使用，不會自動套用
 	StartAt     time.Time     // 活動開始時間
 	EndAt       time.Time     // 活動結束時間
 	CreatedAt   time.Time     // 創建時間
 	UpdatedAt   time.Time     // 更新時間
+
+	// 使用限制，0 為不限制
+	MaxRedemptions int32           // 總共可使用次數
+	MaxPerUser     int32           // 每個用戶可使用次數
+	Budget         decimal.Decimal // 總共可折抵的平台幣
+	RedeemedCount  int32           // 已使用次數，只有設定使用限制的活動會累計
+	UsedBudget     decimal.Decimal // 已折抵的平台幣，只有設定使用限制的活動會累計
+
+	// 疊加規則
+	Priority   int32  // 優先順序，越大越先計算，相同時依 ValidPromotionTypes 的順序
+	Exclusive  bool   // 獨佔活動，不與其他活動一起套用
+	StackGroup string // 疊加群組，同一個群組內的活動只會套用一個，空字串為不限制
+
+	// 重複時段
+	Timezone  string               // IANA 時區，e.g. Asia/Taipei，空字串為 UTC
+	Schedules []*PromotionSchedule // 活動期間內符合任一個時段時才進行中，空的為整個活動期間
+	location  *time.Location       // LoadLocation 載入的時區
+
+	// 發布 & 版本
+	Status  PromotionStatus // 活動狀態
+	Version int32           // 目前活動內容的版本，每次修改 Extension、疊加規則或重複時段都會增加
+}
+
+// PromotionVersion 活動內容的版本，只新增不修改
+type PromotionVersion struct {
+	ID          int64
+	PromotionID int64         // 關聯的 Promotion.ID
+	Version     int32         // 版本，從 1 開始
+	Type        PromotionType // 活動類型
+	Extension   IPromotionExt // 這個版本的活動內容
+	OperatorID  int64         // 操作者ID
+	CreatedAt   time.Time     // 創建時間
+}
+
+// PromotionSchedule 活動的重複時段，依 Promotion.Timezone 的當地時間計算
+// EndTime 小於等於 StartTime 時為跨日的時段，Weekdays 為時段開始的星期
+type PromotionSchedule struct {
+	Weekdays  []time.Weekday // 星期幾，空的為每天
+	StartTime string         // 開始時間 HH:MM，空字串為 00:00
+	EndTime   string         // 結束時間 HH:MM，不包含，空字串為 24:00
+}
+
+// Contains local 是否在時段內，local 需為活動時區的時間
+func (s *PromotionSchedule) Contains(local time.Time) bool {
+	start, err := parseClock(s.StartTime, 0)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(s.EndTime, 24*time.Hour)
+	if err != nil {
+		return false
+	}
+
+	// 以當地的時鐘時間計算，避免日光節約時間影響
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+	if start < end {
+		return s.onWeekday(local.Weekday()) && offset >= start && offset < end
+	}
+
+	// 跨日的時段，前一天開始的時段延續到今天
+	yesterday := local.AddDate(0, 0, -1).Weekday()
+	return (s.onWeekday(local.Weekday()) && offset >= start) || (s.onWeekday(yesterday) && offset < end)
+}
+
+func (s *PromotionSchedule) onWeekday(weekday time.Weekday) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, w := range s.Weekdays {
+		if w == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock 將 HH:MM 轉換為距離當天 00:00 的時間，空字串時返回 def
+func parseClock(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Wrapf(errors.ErrInvalidInput, "invalid clock %s, %+v", s, err)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// PromotionRedemption 優惠活動使用紀錄
+type PromotionRedemption struct {
+	ID             int64
+	PromotionID    int64           // 關聯的 Promotion.ID
+	UserID         int64           // 用戶ID
+	OrderID        string          // 使用活動的 OrderID
+	DiscountAmount decimal.Decimal // 折抵的平台幣
+	CreatedAt      time.Time       // 創建時間
+}
+
+// IsActive 活動在 now 是否進行中，活動必須已發布，有設定重複時段時 now 也必須在其中一個時段內
+func (p *Promotion) IsActive(now time.Time) bool {
+	if !p.Status.IsPublished() {
+		return false
+	}
+	if now.Before(p.StartAt) || !now.Before(p.EndAt) {
+		return false
+	}
+	if len(p.Schedules) == 0 {
+		return true
+	}
+
+	loc, err := p.Location()
+	if err != nil {
+		return false
+	}
+
+	local := now.In(loc)
+	for _, schedule := range p.Schedules {
+		if schedule.Contains(local) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Location 活動的時區，已透過 LoadLocation 載入時直接使用，否則依 Timezone 解析
+func (p *Promotion) Location() (*time.Location, error) {
+	if p.location != nil {
+		return p.location, nil
+	}
+	return loadLocation(p.Timezone)
+}
+
+// LoadLocation 解析並保存活動的時區，之後 IsActive 不需要每次重新解析
+// 讀取活動時呼叫，修改 Timezone 後需重新呼叫
+func (p *Promotion) LoadLocation() error {
+	loc, err := loadLocation(p.Timezone)
+	if err != nil {
+		return err
+	}
+
+	p.location = loc
+	return nil
+}
+
+// loadLocation 解析 IANA 時區，空字串為 UTC
+func loadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "invalid timezone %s, %+v", timezone, err)
+	}
+
+	return loc, nil
+}
+
+// IsExhausted 活動是否已達總共可使用次數或已用完預算
+func (p *Promotion) IsExhausted() bool {
+	if p.MaxRedemptions > 0 && p.RedeemedCount >= p.MaxRedemptions {
+		return true
+	}
+	return p.Budget.IsPositive() && p.UsedBudget.GreaterThanOrEqual(p.Budget)
+}
+
+// HasLimits 是否有設定使用次數或預算的限制，沒有限制的活動結帳時不需要鎖定
+func (p *Promotion) HasLimits() bool {
+	return p.MaxRedemptions > 0 || p.MaxPerUser > 0 || p.Budget.IsPositive()
+}
+
+// CanRedeem 活動是否還可以使用一次並折抵 discount
+func (p *Promotion) CanRedeem(discount decimal.Decimal) bool {
+	if p.MaxRedemptions > 0 && p.RedeemedCount >= p.MaxRedemptions {
+		return false
+	}
+	return !p.Budget.IsPositive() || p.UsedBudget.Add(discount).LessThanOrEqual(p.Budget)
+}
+
+// CalculatePrice 依活動內容計算優惠後的價格，超過活動的使用限制時不套用
+func (p *Promotion) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
+	if p.MaxPerUser > 0 && input.UserRedemptions[p.ID] >= p.MaxPerUser {
+		return skippedPromotion(beforePrice, SkipReasonUserLimitReached)
+	}
+
+	output := p.Extension.CalculatePrice(beforePrice, input)
+	if output.Used && !p.CanRedeem(beforePrice.Sub(output.AfterPrice)) {
+		return skippedPromotion(beforePrice, SkipReasonPromotionLimitReached)
+	}
+
+	return output
 }
 
 func (p *Promotion) ToExtByte() (datatypes.JSON, error) {
@@ -50,31 +332,228 @@ func (p *Promotion) ToExtByte() (datatypes.JSON, error) {
 	return b, nil
 }
 
+// FromExtByteTo 依活動類型解析活動內容，只解析不驗證，驗證規則修改後已儲存的活動及版本仍可讀取
 func (p *Promotion) FromExtByteTo(jsonB datatypes.JSON) (IPromotionExt, error) {
+	ext, err := NewPromotionExt(p.Type)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternalError, err.Error())
+	}
+
+	if err := json.Unmarshal(jsonB, ext); err != nil {
+		return nil, errors.Wrap(errors.ErrInternalError, err.Error())
+	}
+	return ext, nil
+}
+
+// NewPromotionExt 依活動類型建立空的活動內容，未知的活動類型返回 errors.ErrInvalidInput
+func NewPromotionExt(pType PromotionType) (IPromotionExt, error) {
 	var ext IPromotionExt
 
-	switch p.Type {
+	switch pType {
 	case PromotionTypeMember:
 		ext = &PromotionExtMember{}
 	case PromotionTypePoint:
 		ext = &PromotionExtPoint{}
 	case PromotionTypeExtraDiscount:
 		ext = &PromotionExtExtraDiscount{}
+	case PromotionTypeCategoryDiscount:
+		ext = &PromotionExtCategoryDiscount{}
+	case PromotionTypeProductDiscount:
+		ext = &PromotionExtProductDiscount{}
+	case PromotionTypeBuyXGetY:
+		ext = &PromotionExtBuyXGetY{}
+	case PromotionTypeBundle:
+		ext = &PromotionExtBundle{}
+	case PromotionTypeSpendTier:
+		ext = &PromotionExtSpendTier{}
+	default:
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "unknown promotion type %d", pType)
 	}
 
-	if err := json.Unmarshal(jsonB, ext); err != nil {
-		return nil, errors.Wrap(errors.ErrInternalError, err.Error())
-	}
 	return ext, nil
 }
 
 type CalculatePriceInput struct {
 	Member     *Member
 	UsedPoints int32
+	Items      []*PriceItem // 訂單的商品，用來計算指定商品的優惠
+
+	UserRedemptions map[int64]int32 // 用戶已使用各活動的次數，Promotion.ID -> 次數
+}
+
+// PriceItem 計算優惠時的訂單商品，包含商品的分類及標籤
+type PriceItem struct {
+	*OrderItem
+	CategoryIDs []int64  // 商品分類及所有上層分類
+	Tags        []string // 商品標籤
 }
 
+// ScopedPrice 返回 beforePrice 中屬於 scope 商品的金額
+// beforePrice 可能已套用其他優惠，依商品原價小計的比例分攤
+func (in *CalculatePriceInput) ScopedPrice(beforePrice decimal.Decimal, scope *ProductScope) decimal.Decimal {
+	if scope.IsEmpty() {
+		return beforePrice
+	}
+
+	var total, scoped decimal.Decimal
+	for _, item := range in.Items {
+		total = total.Add(item.OriginalPrice())
+		if scope.Match(item) {
+			scoped = scoped.Add(item.OriginalPrice())
+		}
+	}
+	if !total.IsPositive() {
+		return decimal.Zero
+	}
+
+	return beforePrice.Mul(scoped).Div(total)
+}
+
+// OriginalPrice 訂單商品原價總和，未套用任何優惠
+func (in *CalculatePriceInput) OriginalPrice() decimal.Decimal {
+	var total decimal.Decimal
+	for _, item := range in.Items {
+		total = total.Add(item.OriginalPrice())
+	}
+	return total
+}
+
+// priceRatio 返回 beforePrice 與訂單商品原價總和的比例，用來將商品原價換算為套用前面優惠後的價格
+func (in *CalculatePriceInput) priceRatio(beforePrice decimal.Decimal) decimal.Decimal {
+	total := in.OriginalPrice()
+	if !total.IsPositive() {
+		return decimal.Zero
+	}
+
+	return beforePrice.Div(total)
+}
+
+// matchedProductIDs 返回在 scope 內的訂單商品ID，scope 為空時返回 nil 表示整筆訂單
+func (in *CalculatePriceInput) matchedProductIDs(scope *ProductScope) []int64 {
+	if scope.IsEmpty() {
+		return nil
+	}
+
+	var ids = make([]int64, 0)
+	for _, item := range in.Items {
+		if scope.Match(item) {
+			ids = append(ids, item.ProductID)
+		}
+	}
+	return ids
+}
+
+// quantityMap 返回商品ID -> 訂單商品
+func (in *CalculatePriceInput) quantityMap() map[int64]*PriceItem {
+	var m = make(map[int64]*PriceItem, len(in.Items))
+	for _, item := range in.Items {
+		m[item.ProductID] = item
+	}
+	return m
+}
+
+// ProductScope 優惠適用的商品範圍，符合任一商品、分類或標籤即適用
+// 皆為空時適用全部商品
+type ProductScope struct {
+	ProductIDs  []int64  // 商品ID
+	CategoryIDs []int64  // 商品分類，包含子分類
+	Tags        []string // 商品標籤
+}
+
+func (s *ProductScope) IsEmpty() bool {
+	return s == nil || (len(s.ProductIDs) == 0 && len(s.CategoryIDs) == 0 && len(s.Tags) == 0)
+}
+
+// Match 商品是否在範圍內
+func (s *ProductScope) Match(item *PriceItem) bool {
+	if s.IsEmpty() {
+		return true
+	}
+	for _, id := range s.ProductIDs {
+		if id == item.ProductID {
+			return true
+		}
+	}
+	for _, id := range s.CategoryIDs {
+		for _, itemCategoryID := range item.CategoryIDs {
+			if id == itemCategoryID {
+				return true
+			}
+		}
+	}
+	for _, tag := range s.Tags {
+		for _, itemTag := range item.Tags {
+			if tag == itemTag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// discountScopedPrice 只對 scope 內商品的金額折扣，返回折扣後的總價
+// 折抵金額最多折抵到 scope 內商品的金額
+func discountScopedPrice(beforePrice decimal.Decimal, input *CalculatePriceInput, scope *ProductScope,
+	discountType DiscountType, discountRate, discountAmount decimal.Decimal,
+) *CalculatePriceOutput {
+	scopedPrice := input.ScopedPrice(beforePrice, scope)
+	if !scopedPrice.IsPositive() {
+		return skippedPromotion(beforePrice, SkipReasonNoEligibleItems)
+	}
+
+	var output *CalculatePriceOutput
+	if discountType == DiscountTypeRate {
+		output = usedPromotion(beforePrice.Sub(scopedPrice).Add(scopedPrice.Mul(discountRate)))
+	} else {
+		output = usedPromotion(beforePrice.Sub(decimal.Min(discountAmount, scopedPrice)))
+	}
+	output.AffectedProductIDs = input.matchedProductIDs(scope)
+	return output
+}
+
+// CalculatePriceOutput 優惠計算的結果
+type CalculatePriceOutput struct {
+	Used       bool            // 是否套用優惠
+	AfterPrice decimal.Decimal // 優惠後的價格，未套用時等於原價格
+	SkipReason string          // 未套用優惠的原因
+
+	AffectedProductIDs []int64 // 只折扣部分商品時，被折扣的 OrderItem.ProductID
+}
+
+func usedPromotion(afterPrice decimal.Decimal) *CalculatePriceOutput {
+	return &CalculatePriceOutput{Used: true, AfterPrice: afterPrice}
+}
+
+func skippedPromotion(beforePrice decimal.Decimal, reason string) *CalculatePriceOutput {
+	return &CalculatePriceOutput{AfterPrice: beforePrice, SkipReason: reason}
+}
+
+// 未套用優惠的原因
+const (
+	SkipReasonNotMember           = "user is not a member"
+	SkipReasonMemberTypeNotMatch  = "member type is not eligible"
+	SkipReasonMemberLevelNotMatch = "member level is not eligible"
+	SkipReasonNoPointsUsed        = "no points used"
+	SkipReasonInsufficientPoints  = "used points are less than required"
+	SkipReasonNoEligibleItems     = "no items in the promotion scope"
+	SkipReasonInsufficientItems   = "eligible item quantity is less than required"
+	SkipReasonNoSaving            = "promotion price is not lower than original price"
+	SkipReasonBelowMinOrderAmount = "order amount is less than required"
+
+	SkipReasonUserLimitReached      = "user has reached the promotion usage limit"
+	SkipReasonPromotionLimitReached = "promotion usage limit or budget is reached"
+
+	SkipReasonExclusiveConflict  = "cannot be combined with other promotions"
+	SkipReasonStackGroupConflict = "another promotion in the same stack group is applied"
+	SkipReasonNotBestCombination = "not part of the best price combination"
+)
+
+// IPromotionExt 優惠活動的內容
+// beforePrice 為套用前面優惠後的訂單總價，input.Items 為訂單的商品，用來計算只適用部分商品的優惠
+// Validate 檢查活動內容，錯誤時返回帶有欄位錯誤的 errors.ErrInvalidInput
 type IPromotionExt interface {
-	CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) (usePromotion bool, afterPrize decimal.Decimal)
+	CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput
+	Validate() error
 }
 
 // PromotionExtMember 優惠類型(會員)的內容
@@ -87,25 +566,24 @@ type PromotionExtMember struct {
 }
 
 // CalculatePrice 計算優惠類型(會員)後的價格
-func (p *PromotionExtMember) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) (UsedPromotion bool, afterPrice decimal.Decimal) {
-	afterPrice = beforePrice
+func (p *PromotionExtMember) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
 	if input.Member == nil {
-		return
+		return skippedPromotion(beforePrice, SkipReasonNotMember)
 	}
 
 	// 檢查是否有該 VIP 類型
 	memberTypeRatio, exist := p.MemberRatio[input.Member.Type]
 	if !exist {
-		return
+		return skippedPromotion(beforePrice, SkipReasonMemberTypeNotMatch)
 	}
 
 	// 檢查是否有支持該 VIP 等級
 	memberRatio, exist := memberTypeRatio[input.Member.Level]
 	if !exist {
-		return
+		return skippedPromotion(beforePrice, SkipReasonMemberLevelNotMatch)
 	}
 
-	return true, afterPrice.Mul(memberRatio)
+	return usedPromotion(beforePrice.Mul(memberRatio))
 }
 
 // PromotionExtPoint 優惠類型(點數)的內容
@@ -114,12 +592,14 @@ type PromotionExtPoint struct {
 }
 
 // CalculatePrice 計算優惠類型(會員)後的價格
-func (p *PromotionExtPoint) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) (usePromotion bool, afterPrice decimal.Decimal) {
+func (p *PromotionExtPoint) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
 	if input.UsedPoints == 0 {
-		return false, beforePrice
+		return skippedPromotion(beforePrice, SkipReasonNoPointsUsed)
 	}
 
-	return true, beforePrice.Sub(p.Ratio.Mul(decimal.NewFromInt32(input.UsedPoints)))
+	// 折抵的金額最多到 0，避免訂單金額為負數
+	discount := p.Ratio.Mul(decimal.NewFromInt32(input.UsedPoints))
+	return usedPromotion(beforePrice.Sub(decimal.Min(discount, beforePrice)))
 }
 
 // PromotionExtExtraDiscount 優惠類型(額外優惠)的內容
@@ -136,51 +616,271 @@ type ExtraDiscountRequirement struct {
 	// [Pro] 1, 2, 3
 	MemberLevel map[MemberType][]int8
 	Point       int32
+	Scope       *ProductScope // 只折扣範圍內的商品，nil 則折扣整筆訂單
+
+	MinOrderAmount decimal.Decimal // 訂單商品原價總和的最低金額，0 為不限制
 }
 
 // CalculatePrice 計算優惠類型(額外優惠)後的價格
-func (p *PromotionExtExtraDiscount) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) (usePromotion bool, afterPrice decimal.Decimal) {
-	afterPrice = beforePrice
+func (p *PromotionExtExtraDiscount) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
 	// 	額外優惠， 如果有要求會員等級
 	if p.Requirement.MemberLevel != nil {
 		// 用戶不是會員
 		if input.Member == nil {
-			return
+			return skippedPromotion(beforePrice, SkipReasonNotMember)
 		}
 
 		// 用戶不符合特定的 memberType
 		levels, exist := p.Requirement.MemberLevel[input.Member.Type]
 		if !exist {
-			return
+			return skippedPromotion(beforePrice, SkipReasonMemberTypeNotMatch)
 		}
 
+		// levels 由小到大排序
 		idx := sort.Search(len(levels), func(i int) bool {
-			return levels[i] == input.Member.Level
+			return levels[i] >= input.Member.Level
 		})
 		// 用戶不符合特定的等級
-		if idx >= len(levels) {
-			return
+		if idx >= len(levels) || levels[idx] != input.Member.Level {
+			return skippedPromotion(beforePrice, SkipReasonMemberLevelNotMatch)
 		}
 	}
 
 	// 	額外優惠， 如果有要求點數
 	if p.Requirement.Point > 0 {
+		// 沒有使用點數
 		if input.UsedPoints == 0 {
-			return
+			return skippedPromotion(beforePrice, SkipReasonNoPointsUsed)
 		}
 
-		// 沒有使用點數
-		if input.UsedPoints == 0 {
-			return
+		// 使用的點數不足
+		if input.UsedPoints < p.Requirement.Point {
+			return skippedPromotion(beforePrice, SkipReasonInsufficientPoints)
 		}
 	}
 
+	// 	額外優惠， 如果有要求訂單最低金額
+	if p.Requirement.MinOrderAmount.IsPositive() && input.OriginalPrice().LessThan(p.Requirement.MinOrderAmount) {
+		return skippedPromotion(beforePrice, SkipReasonBelowMinOrderAmount)
+	}
+
+	// 有指定商品範圍時只折扣範圍內的商品
+	if !p.Requirement.Scope.IsEmpty() {
+		return discountScopedPrice(beforePrice, input, p.Requirement.Scope, p.DiscountType, p.DiscountRate, p.DiscountAmount)
+	}
+
 	// 計算額外優惠後的價格
 	if p.DiscountType == DiscountTypeRate {
-		afterPrice = afterPrice.Mul(p.DiscountRate)
-	} else {
-		afterPrice = afterPrice.Sub(p.DiscountAmount)
+		return usedPromotion(beforePrice.Mul(p.DiscountRate))
 	}
+	return usedPromotion(beforePrice.Sub(decimal.Min(p.DiscountAmount, beforePrice)))
+}
 
-	return true, afterPrice
+// PromotionExtCategoryDiscount 優惠類型(分類優惠)的內容
+type PromotionExtCategoryDiscount struct {
+	Scope          ProductScope    // 適用的商品分類或標籤
+	DiscountType   DiscountType    // 折扣類型，e.g. 百分比、金額
+	DiscountRate   decimal.Decimal // 折抵百分比
+	DiscountAmount decimal.Decimal // 折抵金額
+}
+
+// CalculatePrice 計算優惠類型(分類優惠)後的價格
+func (p *PromotionExtCategoryDiscount) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
+	return discountScopedPrice(beforePrice, input, &p.Scope, p.DiscountType, p.DiscountRate, p.DiscountAmount)
+}
+
+// PromotionExtProductDiscount 優惠類型(商品優惠)的內容
+type PromotionExtProductDiscount struct {
+	ProductIDs     []int64         // 適用的商品ID
+	DiscountType   DiscountType    // 折扣類型，e.g. 百分比、金額
+	DiscountRate   decimal.Decimal // 折抵百分比
+	DiscountAmount decimal.Decimal // 每件商品折抵的金額，最多折抵到商品單價
+}
+
+// CalculatePrice 計算優惠類型(商品優惠)後的價格
+func (p *PromotionExtProductDiscount) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
+	// 沒有指定商品時不適用任何商品
+	if len(p.ProductIDs) == 0 {
+		return skippedPromotion(beforePrice, SkipReasonNoEligibleItems)
+	}
+
+	scope := &ProductScope{ProductIDs: p.ProductIDs}
+	if p.DiscountType == DiscountTypeRate {
+		return discountScopedPrice(beforePrice, input, scope, p.DiscountType, p.DiscountRate, p.DiscountAmount)
+	}
+
+	scopedPrice := input.ScopedPrice(beforePrice, scope)
+	if !scopedPrice.IsPositive() {
+		return skippedPromotion(beforePrice, SkipReasonNoEligibleItems)
+	}
+
+	// 依每件商品計算折抵金額
+	var discount decimal.Decimal
+	for _, item := range input.Items {
+		if scope.Match(item) {
+			unitDiscount := decimal.Min(p.DiscountAmount, item.UnitPrice)
+			discount = discount.Add(unitDiscount.Mul(decimal.NewFromInt32(item.Quantity)))
+		}
+	}
+
+	// 與買 X 送 Y 相同，依 beforePrice 與原價的比例換算為套用前面優惠後的折扣，最多折抵到範圍內商品的金額
+	discount = discount.Mul(input.priceRatio(beforePrice))
+	output := usedPromotion(beforePrice.Sub(decimal.Min(discount, scopedPrice)))
+	output.AffectedProductIDs = input.matchedProductIDs(scope)
+	return output
+}
+
+// PromotionExtBuyXGetY 優惠類型(買 X 送 Y)的內容
+// 適用商品可混搭計算，每買 BuyQuantity + FreeQuantity 件，其中最便宜的 FreeQuantity 件免費
+type PromotionExtBuyXGetY struct {
+	ProductIDs   []int64 // 適用的商品ID
+	BuyQuantity  int32   // 購買數量 X
+	FreeQuantity int32   // 免費數量 Y
+}
+
+// CalculatePrice 計算優惠類型(買 X 送 Y)後的價格
+func (p *PromotionExtBuyXGetY) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
+	if len(p.ProductIDs) == 0 || p.BuyQuantity <= 0 || p.FreeQuantity <= 0 {
+		return skippedPromotion(beforePrice, SkipReasonNoEligibleItems)
+	}
+
+	// 適用的商品，依單價由低到高排序
+	var (
+		scope = &ProductScope{ProductIDs: p.ProductIDs}
+		items = make([]*PriceItem, 0)
+		units int32
+	)
+	for _, item := range input.Items {
+		if scope.Match(item) {
+			items = append(items, item)
+			units += item.Quantity
+		}
+	}
+	if len(items) == 0 {
+		return skippedPromotion(beforePrice, SkipReasonNoEligibleItems)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].UnitPrice.LessThan(items[j].UnitPrice)
+	})
+
+	freeUnits := units / (p.BuyQuantity + p.FreeQuantity) * p.FreeQuantity
+	if freeUnits == 0 {
+		return skippedPromotion(beforePrice, SkipReasonInsufficientItems)
+	}
+
+	// 從最便宜的商品開始免費
+	var (
+		discount           decimal.Decimal
+		affectedProductIDs = make([]int64, 0)
+	)
+	for _, item := range items {
+		if freeUnits == 0 {
+			break
+		}
+		quantity := item.Quantity
+		if quantity > freeUnits {
+			quantity = freeUnits
+		}
+		discount = discount.Add(item.UnitPrice.Mul(decimal.NewFromInt32(quantity)))
+		affectedProductIDs = append(affectedProductIDs, item.ProductID)
+		freeUnits -= quantity
+	}
+
+	output := usedPromotion(beforePrice.Sub(discount.Mul(input.priceRatio(beforePrice))))
+	output.AffectedProductIDs = affectedProductIDs
+	return output
+}
+
+// PromotionExtBundle 優惠類型(組合價)的內容
+// 購物車內每湊齊一組 Items，該組商品以 BundlePrice 計價
+type PromotionExtBundle struct {
+	Items       []*BundleItem   // 組合的商品及數量
+	BundlePrice decimal.Decimal // 每組的組合價
+}
+
+// BundleItem 組合價的商品
+type BundleItem struct {
+	ProductID int64
+	Quantity  int32 // 每組需要的數量
+}
+
+// CalculatePrice 計算優惠類型(組合價)後的價格
+func (p *PromotionExtBundle) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
+	if len(p.Items) == 0 {
+		return skippedPromotion(beforePrice, SkipReasonNoEligibleItems)
+	}
+
+	// 計算可以湊成幾組，及每組的原價
+	var (
+		itemMap            = input.quantityMap()
+		bundles            = int32(-1)
+		bundleOriginal     decimal.Decimal
+		affectedProductIDs = make([]int64, 0, len(p.Items))
+	)
+	for _, bundleItem := range p.Items {
+		item, exist := itemMap[bundleItem.ProductID]
+		if !exist || bundleItem.Quantity <= 0 {
+			return skippedPromotion(beforePrice, SkipReasonInsufficientItems)
+		}
+		if n := item.Quantity / bundleItem.Quantity; bundles < 0 || n < bundles {
+			bundles = n
+		}
+		bundleOriginal = bundleOriginal.Add(item.UnitPrice.Mul(decimal.NewFromInt32(bundleItem.Quantity)))
+		affectedProductIDs = append(affectedProductIDs, bundleItem.ProductID)
+	}
+	if bundles <= 0 {
+		return skippedPromotion(beforePrice, SkipReasonInsufficientItems)
+	}
+
+	// 組合價不低於原價時不套用
+	saving := bundleOriginal.Sub(p.BundlePrice)
+	if !saving.IsPositive() {
+		return skippedPromotion(beforePrice, SkipReasonNoSaving)
+	}
+
+	// 與買 X 送 Y 相同，依 beforePrice 與原價的比例換算為套用前面優惠後的折扣
+	discount := saving.Mul(decimal.NewFromInt32(bundles)).Mul(input.priceRatio(beforePrice))
+	discount = decimal.Min(discount, beforePrice)
+	output := usedPromotion(beforePrice.Sub(discount))
+	output.AffectedProductIDs = affectedProductIDs
+	return output
+}
+
+// PromotionExtSpendTier 優惠類型(滿額折扣)的內容
+// e.g. 滿 500 折 50、滿 1000 折 150，只套用達到的最高門檻
+type PromotionExtSpendTier struct {
+	Tiers []*SpendTier
+}
+
+// SpendTier 滿額折扣的門檻
+type SpendTier struct {
+	MinAmount      decimal.Decimal // 訂單商品原價總和的門檻
+	DiscountType   DiscountType    // 折扣類型，e.g. 百分比、金額
+	DiscountRate   decimal.Decimal // 折抵百分比
+	DiscountAmount decimal.Decimal // 折抵金額
+}
+
+// CalculatePrice 計算優惠類型(滿額折扣)後的價格
+func (p *PromotionExtSpendTier) CalculatePrice(beforePrice decimal.Decimal, input *CalculatePriceInput) *CalculatePriceOutput {
+	// 找出達到的最高門檻
+	var (
+		orderAmount = input.OriginalPrice()
+		tier        *SpendTier
+	)
+	for _, t := range p.Tiers {
+		if orderAmount.LessThan(t.MinAmount) {
+			continue
+		}
+		if tier == nil || t.MinAmount.GreaterThan(tier.MinAmount) {
+			tier = t
+		}
+	}
+	if tier == nil {
+		return skippedPromotion(beforePrice, SkipReasonBelowMinOrderAmount)
+	}
+
+	if tier.DiscountType == DiscountTypeRate {
+		return usedPromotion(beforePrice.Mul(tier.DiscountRate))
+	}
+	return usedPromotion(beforePrice.Sub(decimal.Min(tier.DiscountAmount, beforePrice)))
 }
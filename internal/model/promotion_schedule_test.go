@@ -0,0 +1,120 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newScheduledPromotion 建立整年進行中的活動，只在 timezone 的 schedules 時段內套用
+func newScheduledPromotion(t *testing.T, timezone string, schedules ...*PromotionSchedule) *Promotion {
+	t.Helper()
+
+	p := &Promotion{
+		StartAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndAt:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:    PromotionStatusLive,
+		Timezone:  timezone,
+		Schedules: schedules,
+	}
+	require.NoError(t, p.LoadLocation())
+	return p
+}
+
+type scheduleCase struct {
+	name   string
+	now    time.Time // UTC 時間
+	active bool
+}
+
+func runScheduleCases(t *testing.T, p *Promotion, tests []scheduleCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.active, p.IsActive(tt.now), "now: %s", tt.now.In(p.location))
+		})
+	}
+}
+
+func TestPromotionScheduleCrossMidnight(t *testing.T) {
+	// 台北時間每週五 22:00 ~ 隔天 02:00，2024-03-01 為週五
+	p := newScheduledPromotion(t, "Asia/Taipei", &PromotionSchedule{
+		Weekdays:  []time.Weekday{time.Friday},
+		StartTime: "22:00",
+		EndTime:   "02:00",
+	})
+
+	runScheduleCases(t, p, []scheduleCase{
+		{name: "friday before start", now: time.Date(2024, 3, 1, 13, 59, 0, 0, time.UTC), active: false},
+		{name: "friday 22:00", now: time.Date(2024, 3, 1, 14, 0, 0, 0, time.UTC), active: true},
+		{name: "friday 23:30", now: time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC), active: true},
+		// 當地已是週六，UTC 仍是週五，延續週五開始的時段
+		{name: "saturday 01:59 carries over from friday", now: time.Date(2024, 3, 1, 17, 59, 0, 0, time.UTC), active: true},
+		{name: "saturday 02:00 end is exclusive", now: time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC), active: false},
+		{name: "saturday 23:00 is not scheduled", now: time.Date(2024, 3, 2, 15, 0, 0, 0, time.UTC), active: false},
+		// 當地週五 01:00 是週四開始的時段，週四不在時段內
+		{name: "friday 01:00 does not carry over from thursday", now: time.Date(2024, 2, 29, 17, 0, 0, 0, time.UTC), active: false},
+	})
+}
+
+func TestPromotionScheduleLocalWeekday(t *testing.T) {
+	// 台北時間每週六 00:00 ~ 03:00，UTC 時間仍是週五
+	p := newScheduledPromotion(t, "Asia/Taipei", &PromotionSchedule{
+		Weekdays:  []time.Weekday{time.Saturday},
+		StartTime: "00:00",
+		EndTime:   "03:00",
+	})
+
+	runScheduleCases(t, p, []scheduleCase{
+		{name: "saturday 01:00 in taipei", now: time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC), active: true},
+		{name: "saturday 01:00 in utc", now: time.Date(2024, 3, 2, 1, 0, 0, 0, time.UTC), active: false},
+	})
+}
+
+func TestPromotionScheduleDaylightSaving(t *testing.T) {
+	// 紐約時間每天 09:00 ~ 10:00，2024-03-10 開始日光節約時間 (UTC-5 -> UTC-4)
+	p := newScheduledPromotion(t, "America/New_York", &PromotionSchedule{
+		StartTime: "09:00",
+		EndTime:   "10:00",
+	})
+
+	runScheduleCases(t, p, []scheduleCase{
+		{name: "09:30 EST", now: time.Date(2024, 3, 9, 14, 30, 0, 0, time.UTC), active: true},
+		{name: "09:30 EDT", now: time.Date(2024, 3, 10, 13, 30, 0, 0, time.UTC), active: true},
+		// 以固定時差計算會是 09:30，以當地時鐘時間計算為 10:30
+		{name: "10:30 EDT", now: time.Date(2024, 3, 10, 14, 30, 0, 0, time.UTC), active: false},
+	})
+
+	// 2024-11-03 結束日光節約時間，01:00 ~ 02:00 會出現兩次
+	p = newScheduledPromotion(t, "America/New_York", &PromotionSchedule{
+		StartTime: "01:00",
+		EndTime:   "02:00",
+	})
+
+	runScheduleCases(t, p, []scheduleCase{
+		{name: "first 01:30 EDT", now: time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), active: true},
+		{name: "second 01:30 EST", now: time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC), active: true},
+		{name: "02:30 EST", now: time.Date(2024, 11, 3, 7, 30, 0, 0, time.UTC), active: false},
+	})
+}
+
+func TestPromotionLoadLocation(t *testing.T) {
+	p := &Promotion{Timezone: "Asia/Taipei"}
+	require.NoError(t, p.LoadLocation())
+
+	// 載入後直接使用保存的時區
+	loc, err := p.Location()
+	require.NoError(t, err)
+	require.Same(t, p.location, loc)
+
+	p = &Promotion{Timezone: "Mars/Olympus"}
+	require.Error(t, p.LoadLocation())
+	require.False(t, (&Promotion{
+		Timezone:  "Mars/Olympus",
+		Schedules: []*PromotionSchedule{{}},
+		Status:    PromotionStatusLive,
+		EndAt:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}).IsActive(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func newPriceInput(items ...*OrderItem) *CalculatePriceInput {
+	var input = &CalculatePriceInput{Items: make([]*PriceItem, 0, len(items))}
+	for _, item := range items {
+		input.Items = append(input.Items, &PriceItem{OrderItem: item})
+	}
+	return input
+}
+
+func TestPromotionExtBundleCalculatePrice(t *testing.T) {
+	// 商品 1 單價 100、商品 2 單價 50，組合價 120，每組省 30
+	var (
+		bundle = &PromotionExtBundle{
+			Items: []*BundleItem{
+				{ProductID: 1, Quantity: 1},
+				{ProductID: 2, Quantity: 1},
+			},
+			BundlePrice: decimal.NewFromInt(120),
+		}
+		input = newPriceInput(
+			&OrderItem{ProductID: 1, UnitPrice: decimal.NewFromInt(100), Quantity: 2},
+			&OrderItem{ProductID: 2, UnitPrice: decimal.NewFromInt(50), Quantity: 2},
+		)
+	)
+
+	tests := []struct {
+		name        string
+		beforePrice decimal.Decimal
+		afterPrice  decimal.Decimal
+	}{
+		{
+			name:        "未套用其他優惠",
+			beforePrice: decimal.NewFromInt(300),
+			afterPrice:  decimal.NewFromInt(240),
+		},
+		{
+			// 前面的優惠已打 8 折，組合價省下的金額同樣依比例換算，與買 X 送 Y 一致
+			name:        "已套用其他優惠",
+			beforePrice: decimal.NewFromInt(240),
+			afterPrice:  decimal.NewFromInt(192),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := bundle.CalculatePrice(tt.beforePrice, input)
+			require.True(t, output.Used)
+			require.True(t, tt.afterPrice.Equal(output.AfterPrice), "after price: %s", output.AfterPrice)
+			require.ElementsMatch(t, []int64{1, 2}, output.AffectedProductIDs)
+		})
+	}
+}
+
+func TestPromotionExtBundleMatchesBuyXGetY(t *testing.T) {
+	// 買 1 送 1 與「2 個商品組合價 100」的折扣相同，套用其他優惠後也應相同
+	var (
+		input = newPriceInput(
+			&OrderItem{ProductID: 1, UnitPrice: decimal.NewFromInt(100), Quantity: 2},
+		)
+		buyXGetY = &PromotionExtBuyXGetY{ProductIDs: []int64{1}, BuyQuantity: 1, FreeQuantity: 1}
+		bundle   = &PromotionExtBundle{
+			Items:       []*BundleItem{{ProductID: 1, Quantity: 2}},
+			BundlePrice: decimal.NewFromInt(100),
+		}
+		beforePrice = decimal.NewFromInt(150)
+	)
+
+	expected := buyXGetY.CalculatePrice(beforePrice, input)
+	actual := bundle.CalculatePrice(beforePrice, input)
+	require.True(t, expected.AfterPrice.Equal(actual.AfterPrice), "buy x get y: %s, bundle: %s", expected.AfterPrice, actual.AfterPrice)
+}
+
+func TestPromotionStatusUnknownIsLegacyLive(t *testing.T) {
+	// 加入活動狀態前建立的活動視為進行中，可以被套用、結束及封存
+	status := PromotionStatusUnknown
+	require.True(t, status.IsPublished())
+	require.True(t, status.IsLive())
+	require.True(t, status.CanTransitTo(PromotionStatusEnded))
+	require.True(t, status.CanTransitTo(PromotionStatusArchived))
+	require.False(t, status.CanTransitTo(PromotionStatusDraft))
+}
+
+func TestPromotionDiscountNotBelowZero(t *testing.T) {
+	// 折抵金額大於價格時，優惠後的價格為 0
+	var (
+		beforePrice = decimal.NewFromInt(50)
+		input       = &CalculatePriceInput{UsedPoints: 100}
+	)
+
+	tests := []struct {
+		name string
+		ext  IPromotionExt
+	}{
+		{
+			name: "point",
+			ext:  &PromotionExtPoint{Ratio: decimal.NewFromInt(1)},
+		},
+		{
+			name: "extra discount amount",
+			ext:  &PromotionExtExtraDiscount{DiscountType: DiscountTypeAmount, DiscountAmount: decimal.NewFromInt(80)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := tt.ext.CalculatePrice(beforePrice, input)
+			require.True(t, output.Used)
+			require.True(t, output.AfterPrice.IsZero(), "after price: %s", output.AfterPrice)
+		})
+	}
+}
+
+func TestPromotionExtProductDiscountAmountCalculatePrice(t *testing.T) {
+	// 商品 1 單價 100 買 2 件，每件折 30；商品 2 單價 200 不在範圍內
+	var (
+		discount = &PromotionExtProductDiscount{
+			ProductIDs:     []int64{1},
+			DiscountType:   DiscountTypeAmount,
+			DiscountAmount: decimal.NewFromInt(30),
+		}
+		input = newPriceInput(
+			&OrderItem{ProductID: 1, UnitPrice: decimal.NewFromInt(100), Quantity: 2},
+			&OrderItem{ProductID: 2, UnitPrice: decimal.NewFromInt(200), Quantity: 1},
+		)
+	)
+
+	tests := []struct {
+		name        string
+		beforePrice decimal.Decimal
+		afterPrice  decimal.Decimal
+	}{
+		{
+			name:        "未套用其他優惠",
+			beforePrice: decimal.NewFromInt(400),
+			afterPrice:  decimal.NewFromInt(340),
+		},
+		{
+			// 前面的優惠已打 5 折，折抵金額同樣依比例換算
+			name:        "已套用其他優惠",
+			beforePrice: decimal.NewFromInt(200),
+			afterPrice:  decimal.NewFromInt(170),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := discount.CalculatePrice(tt.beforePrice, input)
+			require.True(t, output.Used)
+			require.True(t, tt.afterPrice.Equal(output.AfterPrice), "after price: %s", output.AfterPrice)
+			require.Equal(t, []int64{1}, output.AffectedProductIDs)
+		})
+	}
+}
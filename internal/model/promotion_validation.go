@@ -0,0 +1,248 @@
+package model
+
+import (
+	"cashier/internal/pkg/errors"
+	"fmt"
+	"reflect"
+
+	"github.com/shopspring/decimal"
+)
+
+// fieldErrors 欄位的驗證錯誤，欄位 -> 錯誤原因
+type fieldErrors map[string]interface{}
+
+func (f fieldErrors) add(field, format string, args ...interface{}) {
+	f[field] = fmt.Sprintf(format, args...)
+}
+
+// merge 加入其他驗證錯誤的欄位，欄位名稱加上 prefix
+func (f fieldErrors) merge(prefix string, err error) {
+	for field, reason := range errors.Details(err) {
+		f[prefix+field] = reason
+	}
+}
+
+// err 沒有錯誤時返回 nil，否則返回帶有欄位錯誤的 errors.ErrInvalidInput
+func (f fieldErrors) err(name string) error {
+	if len(f) == 0 {
+		return nil
+	}
+	return errors.Wrapf(errors.WithDetails(errors.ErrInvalidInput, f), "invalid %s: %v", name, map[string]interface{}(f))
+}
+
+// checkRate 折扣比例必須在 0 ~ 1 之間
+func (f fieldErrors) checkRate(field string, rate decimal.Decimal) {
+	if rate.IsNegative() || rate.GreaterThan(decimal.NewFromInt(1)) {
+		f.add(field, "rate %s must be between 0 and 1", rate)
+	}
+}
+
+// checkAmount 金額不可為負數
+func (f fieldErrors) checkAmount(field string, amount decimal.Decimal) {
+	if amount.IsNegative() {
+		f.add(field, "amount %s must not be negative", amount)
+	}
+}
+
+// checkDiscount 依折扣類型檢查折扣比例或金額
+func (f fieldErrors) checkDiscount(prefix string, discountType DiscountType, rate, amount decimal.Decimal) {
+	switch discountType {
+	case DiscountTypeRate:
+		f.checkRate(prefix+"DiscountRate", rate)
+	case DiscountTypeAmount:
+		f.checkAmount(prefix+"DiscountAmount", amount)
+	default:
+		f.add(prefix+"DiscountType", "unknown discount type %d", discountType)
+	}
+}
+
+// Validate 檢查活動的設定及活動內容，錯誤時返回帶有欄位錯誤的 errors.ErrInvalidInput
+func (p *Promotion) Validate() error {
+	f := make(fieldErrors)
+
+	expected, err := NewPromotionExt(p.Type)
+	if err != nil {
+		f.add("Type", "unknown promotion type %d", p.Type)
+	} else if p.Extension == nil {
+		f.add("Extension", "is required")
+	} else if reflect.TypeOf(expected) != reflect.TypeOf(p.Extension) {
+		f.add("Extension", "%T does not match promotion type %d", p.Extension, p.Type)
+	} else if err := p.Extension.Validate(); err != nil {
+		f.merge("Extension.", err)
+	}
+
+	if !p.EndAt.After(p.StartAt) {
+		f.add("EndAt", "end time %s must be after start time %s", p.EndAt, p.StartAt)
+	}
+	if p.MaxRedemptions < 0 {
+		f.add("MaxRedemptions", "%d must not be negative", p.MaxRedemptions)
+	}
+	if p.MaxPerUser < 0 {
+		f.add("MaxPerUser", "%d must not be negative", p.MaxPerUser)
+	}
+	f.checkAmount("Budget", p.Budget)
+
+	if _, err := loadLocation(p.Timezone); err != nil {
+		f.add("Timezone", "unknown timezone %s", p.Timezone)
+	}
+	for i, schedule := range p.Schedules {
+		if _, err := parseClock(schedule.StartTime, 0); err != nil {
+			f.add(fmt.Sprintf("Schedules[%d].StartTime", i), "invalid clock %s, must be HH:MM", schedule.StartTime)
+		}
+		if _, err := parseClock(schedule.EndTime, 0); err != nil {
+			f.add(fmt.Sprintf("Schedules[%d].EndTime", i), "invalid clock %s, must be HH:MM", schedule.EndTime)
+		}
+	}
+
+	return f.err("promotion")
+}
+
+// Validate 會員優惠需設定每個會員類型及等級的折扣比例
+func (p *PromotionExtMember) Validate() error {
+	f := make(fieldErrors)
+
+	if len(p.MemberRatio) == 0 {
+		f.add("MemberRatio", "is required")
+	}
+	for memberType, levels := range p.MemberRatio {
+		if memberType != MemberTypeVIP && memberType != MemberTypePro {
+			f.add(fmt.Sprintf("MemberRatio[%d]", memberType), "unknown member type %d", memberType)
+		}
+		if len(levels) == 0 {
+			f.add(fmt.Sprintf("MemberRatio[%d]", memberType), "levels are required")
+		}
+		for level, ratio := range levels {
+			f.checkRate(fmt.Sprintf("MemberRatio[%d][%d]", memberType, level), ratio)
+		}
+	}
+
+	return f.err("member promotion")
+}
+
+// Validate 平台點數的比例必須大於 0
+func (p *PromotionExtPoint) Validate() error {
+	f := make(fieldErrors)
+
+	if !p.Ratio.IsPositive() {
+		f.add("Ratio", "ratio %s must be positive", p.Ratio)
+	}
+
+	return f.err("point promotion")
+}
+
+// Validate 額外優惠的會員等級需由小到大排序且不重複
+func (p *PromotionExtExtraDiscount) Validate() error {
+	f := make(fieldErrors)
+
+	for memberType, levels := range p.Requirement.MemberLevel {
+		field := fmt.Sprintf("Requirement.MemberLevel[%d]", memberType)
+		if memberType != MemberTypeVIP && memberType != MemberTypePro {
+			f.add(field, "unknown member type %d", memberType)
+		}
+		if !isAscendingLevels(levels) {
+			f.add(field, "levels %v must be sorted in ascending order without duplicates", levels)
+		}
+	}
+	if p.Requirement.Point < 0 {
+		f.add("Requirement.Point", "%d must not be negative", p.Requirement.Point)
+	}
+	f.checkAmount("Requirement.MinOrderAmount", p.Requirement.MinOrderAmount)
+	f.checkDiscount("", p.DiscountType, p.DiscountRate, p.DiscountAmount)
+
+	return f.err("extra discount promotion")
+}
+
+// Validate 分類優惠需指定適用的商品範圍
+func (p *PromotionExtCategoryDiscount) Validate() error {
+	f := make(fieldErrors)
+
+	if p.Scope.IsEmpty() {
+		f.add("Scope", "is required")
+	}
+	f.checkDiscount("", p.DiscountType, p.DiscountRate, p.DiscountAmount)
+
+	return f.err("category discount promotion")
+}
+
+// Validate 商品優惠需指定適用的商品
+func (p *PromotionExtProductDiscount) Validate() error {
+	f := make(fieldErrors)
+
+	if len(p.ProductIDs) == 0 {
+		f.add("ProductIDs", "is required")
+	}
+	f.checkDiscount("", p.DiscountType, p.DiscountRate, p.DiscountAmount)
+
+	return f.err("product discount promotion")
+}
+
+// Validate 買 X 送 Y 需指定適用的商品，購買及免費數量必須大於 0
+func (p *PromotionExtBuyXGetY) Validate() error {
+	f := make(fieldErrors)
+
+	if len(p.ProductIDs) == 0 {
+		f.add("ProductIDs", "is required")
+	}
+	if p.BuyQuantity <= 0 {
+		f.add("BuyQuantity", "%d must be positive", p.BuyQuantity)
+	}
+	if p.FreeQuantity <= 0 {
+		f.add("FreeQuantity", "%d must be positive", p.FreeQuantity)
+	}
+
+	return f.err("buy x get y promotion")
+}
+
+// Validate 組合價需指定組合的商品，每個商品的數量必須大於 0
+func (p *PromotionExtBundle) Validate() error {
+	f := make(fieldErrors)
+
+	if len(p.Items) == 0 {
+		f.add("Items", "is required")
+	}
+	for i, item := range p.Items {
+		if item == nil {
+			f.add(fmt.Sprintf("Items[%d]", i), "is required")
+			continue
+		}
+		if item.Quantity <= 0 {
+			f.add(fmt.Sprintf("Items[%d].Quantity", i), "%d must be positive", item.Quantity)
+		}
+	}
+	f.checkAmount("BundlePrice", p.BundlePrice)
+
+	return f.err("bundle promotion")
+}
+
+// Validate 滿額折扣的門檻需依金額由小到大排序且不重複
+func (p *PromotionExtSpendTier) Validate() error {
+	f := make(fieldErrors)
+
+	if len(p.Tiers) == 0 {
+		f.add("Tiers", "is required")
+	}
+	for i, tier := range p.Tiers {
+		prefix := fmt.Sprintf("Tiers[%d].", i)
+		if tier == nil {
+			f.add(fmt.Sprintf("Tiers[%d]", i), "is required")
+			continue
+		}
+		f.checkAmount(prefix+"MinAmount", tier.MinAmount)
+		f.checkDiscount(prefix, tier.DiscountType, tier.DiscountRate, tier.DiscountAmount)
+		if i > 0 && p.Tiers[i-1] != nil && !tier.MinAmount.GreaterThan(p.Tiers[i-1].MinAmount) {
+			f.add(prefix+"MinAmount", "tiers must be sorted by min amount in ascending order without duplicates")
+		}
+	}
+
+	return f.err("spend tier promotion")
+}
+
+// isAscendingLevels 等級是否由小到大排序且不重複
+func isAscendingLevels(levels []int8) bool {
+	for i := 1; i < len(levels); i++ {
+		if levels[i] <= levels[i-1] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,290 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"cashier/internal/pkg/errors"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// validationCase 驗證的測試案例，fields 為預期有錯誤的欄位，空的為驗證通過
+type validationCase struct {
+	name   string
+	target interface{ Validate() error }
+	fields []string
+}
+
+func runValidationCases(t *testing.T, tests []validationCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.target.Validate()
+			if len(tt.fields) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, errors.ErrInvalidInput)
+			details := errors.Details(err)
+			require.Len(t, details, len(tt.fields), "details: %v", details)
+			for _, field := range tt.fields {
+				require.Contains(t, details, field)
+			}
+		})
+	}
+}
+
+func TestPromotionValidate(t *testing.T) {
+	var (
+		startAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		valid   = func() *Promotion {
+			return &Promotion{
+				Type:      PromotionTypePoint,
+				Extension: &PromotionExtPoint{Ratio: decimal.NewFromInt(1)},
+				StartAt:   startAt,
+				EndAt:     startAt.Add(time.Hour),
+				Timezone:  "Asia/Taipei",
+				Schedules: []*PromotionSchedule{{StartTime: "09:00", EndTime: "12:00"}},
+			}
+		}
+		with = func(modify func(p *Promotion)) *Promotion {
+			p := valid()
+			modify(p)
+			return p
+		}
+	)
+
+	runValidationCases(t, []validationCase{
+		{name: "valid", target: valid()},
+		{
+			name:   "unknown type",
+			target: with(func(p *Promotion) { p.Type = PromotionType(100) }),
+			fields: []string{"Type"},
+		},
+		{
+			name:   "missing extension",
+			target: with(func(p *Promotion) { p.Extension = nil }),
+			fields: []string{"Extension"},
+		},
+		{
+			name:   "extension does not match type",
+			target: with(func(p *Promotion) { p.Extension = &PromotionExtBundle{} }),
+			fields: []string{"Extension"},
+		},
+		{
+			name:   "invalid extension",
+			target: with(func(p *Promotion) { p.Extension = &PromotionExtPoint{} }),
+			fields: []string{"Extension.Ratio"},
+		},
+		{
+			name:   "end before start",
+			target: with(func(p *Promotion) { p.EndAt = p.StartAt }),
+			fields: []string{"EndAt"},
+		},
+		{
+			name: "negative limits",
+			target: with(func(p *Promotion) {
+				p.MaxRedemptions = -1
+				p.MaxPerUser = -1
+				p.Budget = decimal.NewFromInt(-1)
+			}),
+			fields: []string{"MaxRedemptions", "MaxPerUser", "Budget"},
+		},
+		{
+			name:   "unknown timezone",
+			target: with(func(p *Promotion) { p.Timezone = "Mars/Olympus" }),
+			fields: []string{"Timezone"},
+		},
+		{
+			name: "invalid schedule clock",
+			target: with(func(p *Promotion) {
+				p.Schedules = []*PromotionSchedule{{StartTime: "25:00", EndTime: "9am"}}
+			}),
+			fields: []string{"Schedules[0].StartTime", "Schedules[0].EndTime"},
+		},
+	})
+}
+
+func TestPromotionExtMemberValidate(t *testing.T) {
+	runValidationCases(t, []validationCase{
+		{
+			name: "valid",
+			target: &PromotionExtMember{MemberRatio: map[MemberType]map[int8]decimal.Decimal{
+				MemberTypeVIP: {1: decimal.NewFromFloat(0.95)},
+			}},
+		},
+		{
+			name:   "empty ratio",
+			target: &PromotionExtMember{},
+			fields: []string{"MemberRatio"},
+		},
+		{
+			name: "unknown member type and invalid rate",
+			target: &PromotionExtMember{MemberRatio: map[MemberType]map[int8]decimal.Decimal{
+				MemberType(100): {1: decimal.NewFromFloat(0.9)},
+				MemberTypePro:   {1: decimal.NewFromFloat(1.5)},
+			}},
+			fields: []string{"MemberRatio[100]", "MemberRatio[2][1]"},
+		},
+	})
+}
+
+func TestPromotionExtPointValidate(t *testing.T) {
+	runValidationCases(t, []validationCase{
+		{name: "valid", target: &PromotionExtPoint{Ratio: decimal.NewFromFloat(0.5)}},
+		{name: "zero ratio", target: &PromotionExtPoint{}, fields: []string{"Ratio"}},
+		{name: "negative ratio", target: &PromotionExtPoint{Ratio: decimal.NewFromInt(-1)}, fields: []string{"Ratio"}},
+	})
+}
+
+func TestPromotionExtExtraDiscountValidate(t *testing.T) {
+	runValidationCases(t, []validationCase{
+		{
+			name: "valid",
+			target: &PromotionExtExtraDiscount{
+				Requirement:  ExtraDiscountRequirement{MemberLevel: map[MemberType][]int8{MemberTypePro: {1, 2, 3}}},
+				DiscountType: DiscountTypeRate,
+				DiscountRate: decimal.NewFromFloat(0.1),
+			},
+		},
+		{
+			name: "unsorted levels and negative requirement",
+			target: &PromotionExtExtraDiscount{
+				Requirement: ExtraDiscountRequirement{
+					MemberLevel:    map[MemberType][]int8{MemberTypeVIP: {2, 1}},
+					Point:          -1,
+					MinOrderAmount: decimal.NewFromInt(-1),
+				},
+				DiscountType:   DiscountTypeAmount,
+				DiscountAmount: decimal.NewFromInt(10),
+			},
+			fields: []string{"Requirement.MemberLevel[1]", "Requirement.Point", "Requirement.MinOrderAmount"},
+		},
+		{
+			name:   "unknown discount type",
+			target: &PromotionExtExtraDiscount{DiscountType: DiscountType(100)},
+			fields: []string{"DiscountType"},
+		},
+	})
+}
+
+func TestPromotionExtCategoryDiscountValidate(t *testing.T) {
+	runValidationCases(t, []validationCase{
+		{
+			name: "valid",
+			target: &PromotionExtCategoryDiscount{
+				Scope:        ProductScope{CategoryIDs: []int64{1}},
+				DiscountType: DiscountTypeRate,
+				DiscountRate: decimal.NewFromFloat(0.2),
+			},
+		},
+		{
+			name: "empty scope and invalid rate",
+			target: &PromotionExtCategoryDiscount{
+				DiscountType: DiscountTypeRate,
+				DiscountRate: decimal.NewFromFloat(1.2),
+			},
+			fields: []string{"Scope", "DiscountRate"},
+		},
+	})
+}
+
+func TestPromotionExtProductDiscountValidate(t *testing.T) {
+	runValidationCases(t, []validationCase{
+		{
+			name: "valid",
+			target: &PromotionExtProductDiscount{
+				ProductIDs:     []int64{1},
+				DiscountType:   DiscountTypeAmount,
+				DiscountAmount: decimal.NewFromInt(10),
+			},
+		},
+		{
+			name: "empty products and negative amount",
+			target: &PromotionExtProductDiscount{
+				DiscountType:   DiscountTypeAmount,
+				DiscountAmount: decimal.NewFromInt(-10),
+			},
+			fields: []string{"ProductIDs", "DiscountAmount"},
+		},
+	})
+}
+
+func TestPromotionExtBuyXGetYValidate(t *testing.T) {
+	runValidationCases(t, []validationCase{
+		{
+			name:   "valid",
+			target: &PromotionExtBuyXGetY{ProductIDs: []int64{1}, BuyQuantity: 2, FreeQuantity: 1},
+		},
+		{
+			name:   "empty",
+			target: &PromotionExtBuyXGetY{},
+			fields: []string{"ProductIDs", "BuyQuantity", "FreeQuantity"},
+		},
+	})
+}
+
+func TestPromotionExtBundleValidate(t *testing.T) {
+	runValidationCases(t, []validationCase{
+		{
+			name: "valid",
+			target: &PromotionExtBundle{
+				Items:       []*BundleItem{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 2}},
+				BundlePrice: decimal.NewFromInt(100),
+			},
+		},
+		{
+			name:   "empty items and negative price",
+			target: &PromotionExtBundle{BundlePrice: decimal.NewFromInt(-1)},
+			fields: []string{"Items", "BundlePrice"},
+		},
+		{
+			name: "invalid items",
+			target: &PromotionExtBundle{
+				Items: []*BundleItem{nil, {ProductID: 2, Quantity: 0}},
+			},
+			fields: []string{"Items[0]", "Items[1].Quantity"},
+		},
+	})
+}
+
+func TestPromotionExtSpendTierValidate(t *testing.T) {
+	runValidationCases(t, []validationCase{
+		{
+			name: "valid",
+			target: &PromotionExtSpendTier{Tiers: []*SpendTier{
+				{MinAmount: decimal.NewFromInt(500), DiscountType: DiscountTypeAmount, DiscountAmount: decimal.NewFromInt(50)},
+				{MinAmount: decimal.NewFromInt(1000), DiscountType: DiscountTypeRate, DiscountRate: decimal.NewFromFloat(0.15)},
+			}},
+		},
+		{
+			name:   "empty tiers",
+			target: &PromotionExtSpendTier{},
+			fields: []string{"Tiers"},
+		},
+		{
+			name: "unsorted tiers and invalid discount",
+			target: &PromotionExtSpendTier{Tiers: []*SpendTier{
+				{MinAmount: decimal.NewFromInt(1000), DiscountType: DiscountTypeAmount, DiscountAmount: decimal.NewFromInt(150)},
+				{MinAmount: decimal.NewFromInt(500), DiscountType: DiscountTypeRate, DiscountRate: decimal.NewFromInt(2)},
+				nil,
+			}},
+			fields: []string{"Tiers[1].MinAmount", "Tiers[1].DiscountRate", "Tiers[2]"},
+		},
+	})
+}
+
+func TestFromExtByteToDoesNotValidate(t *testing.T) {
+	// 已儲存的活動內容只解析不驗證，驗證規則修改後仍可讀取
+	p := &Promotion{Type: PromotionTypePoint}
+	ext, err := p.FromExtByteTo([]byte(`{"Ratio":"0"}`))
+	require.NoError(t, err)
+	require.True(t, ext.(*PromotionExtPoint).Ratio.IsZero())
+
+	_, err = (&Promotion{Type: PromotionType(100)}).FromExtByteTo([]byte(`{}`))
+	require.ErrorIs(t, err, errors.ErrInternalError)
+}
@@ -0,0 +1,7 @@
+package query
+
+type CategoryOptions struct {
+	IDIn       []int64
+	ParentIDIn []int64 // 上層分類ID，0 為最上層分類
+	PathPrefix string  // 分類路徑開頭，用來查詢某個分類的所有子分類，e.g. model.Category.ChildPath()
+}
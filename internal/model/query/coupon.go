@@ -0,0 +1,15 @@
+package query
+
+type CouponOptions struct {
+	IDIn          []int64
+	CodeIn        []string
+	PromotionIDIn []int64
+
+	Lock bool
+}
+
+type CouponRedemptionOptions struct {
+	CouponIDIn []int64
+	UserIDIn   []int64
+	OrderIDIn  []string
+}
@@ -6,3 +6,8 @@ type InventoryOptions struct {
 	Lock       bool
 	LockNoWait bool
 }
+
+type StockMovementOptions struct {
+	ProductIDIn   []int64
+	ReferenceIDIn []string
+}
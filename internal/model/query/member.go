@@ -1,5 +1,6 @@
 package query
 
 type MemberOptions struct {
-	IDIn []int64
+	IDIn     []int64
+	UserIDIn []int64 // 用戶ID
 }
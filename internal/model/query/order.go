@@ -0,0 +1,47 @@
+package query
+
+import (
+	"cashier/internal/model"
+
+	"time"
+)
+
+type OrderOptions struct {
+	IDIn         []string
+	UserIDIn     []int64             // 用戶ID
+	StatusIn     []model.OrderStatus // 訂單狀態
+	CreatedAtGte *time.Time          // 建立時間大於等於
+	CreatedAtLt  *time.Time          // 建立時間小於
+	PromotionID  int64               // 使用特定優惠的訂單
+
+	// 分頁，依訂單ID由新到舊排序
+	// Cursor 為上一頁最後一筆訂單ID，空值則從最新的訂單開始
+	Cursor string
+	Limit  int
+
+	Lock bool
+
+	// true 查詢 model.Order 關聯的 model.OrderItem 並返回
+	// false 則不查詢 model.OrderItem
+	WithItems bool
+}
+
+type OrderItemOptions struct {
+	IDIn      []int64
+	OrderIDIn []string
+}
+
+type OrderStatusHistoryOptions struct {
+	OrderIDIn []string
+}
+
+type OrderIdempotencyKeyOptions struct {
+	IDIn     []int64
+	UserIDIn []int64
+	KeyIn    []string
+
+	Processing  bool       // 只查詢尚未有結果的紀錄
+	UpdatedAtLt *time.Time // 更新時間小於
+
+	Lock bool
+}
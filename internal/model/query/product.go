@@ -1,7 +1,29 @@
 package query
 
+import (
+	"cashier/internal/model"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
 type ProductOptions struct {
-	IDIn []int64
+	IDIn         []int64
+	NameContains string                // 商品名稱包含
+	StatusIn     []model.ProductStatus // 商品上下架狀態
+	PriceGte     *decimal.Decimal      // 價格大於等於
+	PriceLte     *decimal.Decimal      // 價格小於等於
+	InStock      bool                  // true 只查詢可售庫存大於 0 的商品
+	CategoryIDIn []int64               // 商品分類ID，不包含子分類
+	Tag          string                // 包含此標籤的商品
+
+	// 分頁，依 Sort 排序
+	// Cursor 為上一頁最後一筆商品的 ProductCursor.Encode()，空值則從第一筆開始
+	Sort   ProductSort
+	Cursor string
+	Limit  int
 
 	Lock       bool
 	LockNoWait bool
@@ -10,3 +32,50 @@ type ProductOptions struct {
 	// false 則不查詢 model.Inventory
 	WithInventory bool
 }
+
+// ProductSort 商品排序方式，相同時依商品ID排序
+type ProductSort int8
+
+const (
+	ProductSortIDAsc         ProductSort = iota // 商品ID由小到大
+	ProductSortPriceAsc                         // 價格由低到高
+	ProductSortPriceDesc                        // 價格由高到低
+	ProductSortCreatedAtDesc                    // 建立時間由新到舊
+)
+
+// ProductCursor 商品分頁的位置
+type ProductCursor struct {
+	ID        int64           `json:"id"`
+	Price     decimal.Decimal `json:"price"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewProductCursor 以商品建立分頁位置
+func NewProductCursor(product *model.Product) *ProductCursor {
+	return &ProductCursor{
+		ID:        product.ID,
+		Price:     product.Price,
+		CreatedAt: product.CreatedAt,
+	}
+}
+
+// Encode 將分頁位置編碼為 ProductOptions.Cursor
+func (c *ProductCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeProductCursor 解析 ProductOptions.Cursor
+func DecodeProductCursor(cursor string) (*ProductCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var c = &ProductCursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
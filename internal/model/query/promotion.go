@@ -9,6 +9,24 @@ import (
 type PromotionOptions struct {
 	IDIn       []int64               // 活動ID
 	TypeIn     []model.PromotionType // 活動類型
-	StartAtGte *time.Time            // 活動時間大於等於
-	EndAtLt    *time.Time            // 活動時間小於
+	StartAtGte *time.Time            // 活動開始時間大於等於
+	StartAtLte *time.Time            // 活動開始時間小於等於
+	EndAtGt    *time.Time            // 活動結束時間大於
+	EndAtLt    *time.Time            // 活動結束時間小於
+	CouponOnly *bool                 // 是否只能透過優惠碼使用
+
+	StatusIn []model.PromotionStatus // 活動狀態
+
+	Lock bool
+}
+
+type PromotionRedemptionOptions struct {
+	PromotionIDIn []int64
+	UserIDIn      []int64
+	OrderIDIn     []string
+}
+
+type PromotionVersionOptions struct {
+	PromotionIDIn []int64
+	VersionIn     []int32
 }
@@ -0,0 +1,21 @@
+package query
+
+import (
+	"cashier/internal/model"
+
+	"time"
+)
+
+type ReservationOptions struct {
+	IDIn        []string
+	UserIDIn    []int64
+	StatusIn    []model.ReservationStatus
+	ExpiredAtLt *time.Time // 保留到期時間小於
+	Limit       int
+
+	Lock bool
+
+	// true 查詢 model.Reservation 關聯的 model.ReservationItem 並返回
+	// false 則不查詢 model.ReservationItem
+	WithItems bool
+}
@@ -6,3 +6,9 @@ type WalletOptions struct {
 
 	Lock bool
 }
+
+type WalletTransactionOptions struct {
+	WalletIDIn []int64
+	UserIDIn   []int64
+	OrderIDIn  []string
+}
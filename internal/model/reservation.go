@@ -0,0 +1,61 @@
+package model
+
+import "time"
+
+// ReservationStatus 庫存保留單狀態
+type ReservationStatus int8
+
+const (
+	ReservationStatusUnknown   ReservationStatus = iota
+	ReservationStatusReserved                    // 保留中
+	ReservationStatusConfirmed                   // 已確認並建立訂單
+	ReservationStatusReleased                    // 已釋放 (過期或取消)
+)
+
+func (r ReservationStatus) Str() string {
+	switch r {
+	case ReservationStatusReserved:
+		return "Reserved"
+	case ReservationStatusConfirmed:
+		return "Confirmed"
+	case ReservationStatusReleased:
+		return "Released"
+	default:
+		return "Unknown"
+	}
+}
+
+// Reservation 庫存保留單，結帳期間將商品庫存從可售移到保留
+type Reservation struct {
+	ID        string
+	UserID    int64             // 用戶ID
+	Status    ReservationStatus // 保留單狀態
+	OrderID   string            // 確認後建立的訂單ID
+	ExpiredAt time.Time         // 保留到期時間，過期後由背景程序釋放
+	CreatedAt time.Time         // 創建時間
+	UpdatedAt time.Time         // 更新時間
+
+	Items []*ReservationItem // 保留的商品
+}
+
+// IsExpired 保留單在 now 時是否已過期
+func (r *Reservation) IsExpired(now time.Time) bool {
+	return !now.Before(r.ExpiredAt)
+}
+
+// ShoppingCart 返回保留的 Product.ID 對應數量
+func (r *Reservation) ShoppingCart() map[int64]int32 {
+	var cart = make(map[int64]int32, len(r.Items))
+	for _, item := range r.Items {
+		cart[item.ProductID] += item.Quantity
+	}
+	return cart
+}
+
+// ReservationItem 保留單的商品
+type ReservationItem struct {
+	ID            int64
+	ReservationID string // 關聯的 Reservation.ID
+	ProductID     int64  // Product 的 ID
+	Quantity      int32  // 保留數量
+}
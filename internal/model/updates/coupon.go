@@ -0,0 +1,7 @@
+package updates
+
+import "cashier/internal/model"
+
+type Coupon struct {
+	RedeemedCount *model.QuantityOperation // 已使用次數
+}
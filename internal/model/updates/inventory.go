@@ -5,4 +5,11 @@ import "cashier/internal/model"
 type Inventory struct {
 	TotalQuantity     *model.QuantityOperation
 	AvailableQuantity *model.QuantityOperation
+	ReservedQuantity  *model.QuantityOperation
+
+	// 寫入庫存異動紀錄 model.StockMovement 的內容
+	Cause       model.StockMovementCause // 異動原因
+	ReferenceID string                   // 關聯的單號
+	OperatorID  int64                    // 操作者ID
+	Note        string                   // 備註
 }
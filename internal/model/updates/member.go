@@ -0,0 +1,8 @@
+package updates
+
+import "cashier/internal/model"
+
+type Member struct {
+	Type  *model.MemberType // 會員類型
+	Level *int8             // 會員等級
+}
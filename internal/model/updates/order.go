@@ -0,0 +1,19 @@
+package updates
+
+import "cashier/internal/model"
+
+type Order struct {
+	Status *model.OrderStatus // 訂單狀態
+}
+
+type OrderItem struct {
+	RefundedQuantity *model.QuantityOperation // 已退款數量操作
+	RefundedToken    *model.TokenOperation    // 已退回平台幣操作
+	RefundedPoints   *model.PointOperation    // 已退回平台點數操作
+}
+
+type OrderIdempotencyKey struct {
+	OrderID      *string // 成功建立的訂單ID
+	ErrorCode    *string // 建立訂單失敗的錯誤代碼
+	ErrorMessage *string // 建立訂單失敗的錯誤訊息
+}
@@ -0,0 +1,15 @@
+package updates
+
+import (
+	"cashier/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+type Product struct {
+	Name       *string              // 商品名稱
+	Status     *model.ProductStatus // 商品上下架狀態
+	Price      *decimal.Decimal     // 價格(單位：平台幣)
+	CategoryID *int64               // 商品分類ID
+	Tags       *[]string            // 商品標籤
+}
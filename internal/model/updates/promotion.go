@@ -0,0 +1,34 @@
+package updates
+
+import (
+	"cashier/internal/model"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type Promotion struct {
+	Name        *string
+	Description *string
+	Extension   model.IPromotionExt    // 活動內容，異動時會建立新的版本
+	Status      *model.PromotionStatus // 活動狀態
+	StartAt     *time.Time
+	EndAt       *time.Time
+	CouponOnly  *bool // 只能透過優惠碼使用，異動時會建立新的版本
+	OperatorID  int64 // 異動活動內容的操作者ID，紀錄在新的版本上
+
+	// 使用限制，0 為不限制
+	MaxRedemptions *int32           // 總共可使用次數
+	MaxPerUser     *int32           // 每個用戶可使用次數
+	Budget         *decimal.Decimal // 總共可折抵的平台幣
+
+	// 疊加規則 & 重複時段，異動時會建立新的版本
+	Priority   *int32
+	Exclusive  *bool
+	StackGroup *string
+	Timezone   *string
+	Schedules  *[]*model.PromotionSchedule
+
+	RedeemedCount *model.QuantityOperation // 已使用次數
+	UsedBudget    *model.TokenOperation    // 已折抵的平台幣
+}
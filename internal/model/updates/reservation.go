@@ -0,0 +1,8 @@
+package updates
+
+import "cashier/internal/model"
+
+type Reservation struct {
+	Status  *model.ReservationStatus // 保留單狀態
+	OrderID *string                  // 確認後建立的訂單ID
+}
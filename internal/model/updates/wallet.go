@@ -9,4 +9,10 @@ type Wallet struct {
 	PointsOperation *model.PointOperation // 平台點數操作
 
 	Lock bool // lock for update
+
+	// 寫入錢包異動紀錄 model.WalletTransaction 的內容
+	OrderID    string                        // 關聯的 OrderID
+	Reason     model.WalletTransactionReason // 異動原因
+	ReasonCode string                        // 異動原因代碼
+	OperatorID int64                         // 操作者ID
 }
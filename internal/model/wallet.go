@@ -24,3 +24,48 @@ type PointOperation struct {
 	Operation NumericOperation
 	Points    int32
 }
+
+// WalletTransactionReason 錢包異動原因
+type WalletTransactionReason int8
+
+const (
+	WalletTransactionReasonUnknown      WalletTransactionReason = iota
+	WalletTransactionReasonOrderPayment                         // 訂單付款
+	WalletTransactionReasonOrderRefund                          // 訂單退款
+	WalletTransactionReasonTopUp                                // 儲值平台幣
+	WalletTransactionReasonGrantPoints                          // 發放平台點數
+	WalletTransactionReasonAdminAdjust                          // 管理員調整
+)
+
+func (r WalletTransactionReason) Str() string {
+	switch r {
+	case WalletTransactionReasonOrderPayment:
+		return "OrderPayment"
+	case WalletTransactionReasonOrderRefund:
+		return "OrderRefund"
+	case WalletTransactionReasonTopUp:
+		return "TopUp"
+	case WalletTransactionReasonGrantPoints:
+		return "GrantPoints"
+	case WalletTransactionReasonAdminAdjust:
+		return "AdminAdjust"
+	default:
+		return "Unknown"
+	}
+}
+
+// WalletTransaction 錢包異動紀錄，只新增不修改，用來對帳
+type WalletTransaction struct {
+	ID          int64
+	WalletID    int64                   // 關聯 Wallet.ID
+	UserID      int64                   // 用戶ID
+	OrderID     string                  // 關聯的 OrderID，非訂單異動時為空
+	Reason      WalletTransactionReason // 異動原因
+	ReasonCode  string                  // 異動原因代碼，e.g. 活動名稱、客服單號
+	OperatorID  int64                   // 操作者ID，OperatorSystem 為系統
+	TokenDelta  decimal.Decimal         // 平台幣異動量，扣款為負數
+	PointsDelta int32                   // 平台點數異動量，扣點為負數
+	TokenAfter  decimal.Decimal         // 異動後的平台幣餘額
+	PointsAfter int32                   // 異動後的平台點數餘額
+	CreatedAt   time.Time               // 創建時間
+}
@@ -29,6 +29,20 @@ var (
 	ErrInternalError       = &_error{Code: "500001", Message: "The server encountered an internal error. Please retry the request.", Status: http.StatusInternalServerError, GRPCCode: codes.Internal}
 )
 
+// predefinedErrors 預先定義的 errors，用來依錯誤代碼還原錯誤
+var predefinedErrors = []*_error{
+	ErrInvalidInput,
+	ErrUnauthorized,
+	ErrResourceNotFound,
+	ErrMethodNotAllowed,
+	ErrResourceAlreadyExists,
+	ErrResourceUnavailable,
+	ErrResourceInsufficient,
+	ErrInsufficientBalance,
+	ErrInternalServerError,
+	ErrInternalError,
+}
+
 type _error struct {
 	Status   int                    `json:"status"`
 	Code     string                 `json:"code"`
@@ -114,3 +128,60 @@ func WithErrors(err error) error {
 func NewWithMessagef(err error, format string, args ...interface{}) error {
 	return NewWithMessage(err, fmt.Sprintf(format, args...))
 }
+
+// Code 取得錯誤代碼，未定義的錯誤會被視為 ErrInternalError 類型
+func Code(err error) string {
+	_err, ok := errors.Cause(err).(*_error)
+	if !ok {
+		return ErrInternalError.Code
+	}
+	return _err.Code
+}
+
+// HTTPStatus 取得錯誤對應的 http status，未定義的錯誤會被視為 ErrInternalError 類型
+func HTTPStatus(err error) int {
+	_err, ok := errors.Cause(err).(*_error)
+	if !ok {
+		return ErrInternalError.Status
+	}
+	return _err.Status
+}
+
+// FromCode 依錯誤代碼返回預先定義的錯誤
+// 未定義的錯誤代碼會被視為 ErrInternalError 類型
+func FromCode(code string) error {
+	for _, _err := range predefinedErrors {
+		if _err.Code == code {
+			return _err
+		}
+	}
+	return ErrInternalError
+}
+
+// WithDetails 附加錯誤的詳細資訊，e.g. 各欄位的驗證錯誤
+// 未定義的錯誤會被視為 ErrInternalError 類型
+func WithDetails(err error, details map[string]interface{}) error {
+	if err == nil {
+		return nil
+	}
+	_err, ok := errors.Cause(err).(*_error)
+	if !ok {
+		_err = ErrInternalError
+	}
+	return WithStack(&_error{
+		Status:   _err.Status,
+		Code:     _err.Code,
+		Message:  _err.Message,
+		GRPCCode: _err.GRPCCode,
+		Details:  details,
+	})
+}
+
+// Details 取得錯誤的詳細資訊，沒有時返回 nil
+func Details(err error) map[string]interface{} {
+	_err, ok := errors.Cause(err).(*_error)
+	if !ok {
+		return nil
+	}
+	return _err.Details
+}
@@ -14,41 +14,127 @@ type IDatabase interface {
 	Transaction(ctx context.Context, callback func(ctx context.Context, txRepo IDatabase) error) error
 
 	IProductDB
+	ICategoryDB
 	IPromotionDB
 	IMemberDB
 	IOrderDB
 	IWalletDB
 	IInventoryDB
+	IReservationDB
+	ICouponDB
 }
 
 type IPromotionDB interface {
 	// ListPromotions 取得多筆優惠活動
 	ListPromotions(ctx context.Context, options *query.PromotionOptions) ([]*model.Promotion, error)
+	// CreatePromotion 建立優惠活動，並將活動內容紀錄為第一個版本
 	CreatePromotion(ctx context.Context, mPromotion *model.Promotion) error
+	// UpdatePromotion 更新優惠活動，異動 Extension 時建立新的版本
+	UpdatePromotion(ctx context.Context, options *query.PromotionOptions, updates *updates.Promotion) error
+	// ListPromotionVersions 取得活動內容的版本
+	ListPromotionVersions(ctx context.Context, options *query.PromotionVersionOptions) ([]*model.PromotionVersion, error)
+	// CreatePromotionRedemption 紀錄優惠活動使用
+	CreatePromotionRedemption(ctx context.Context, redemption *model.PromotionRedemption) error
+	// ListPromotionRedemptions 取得優惠活動使用紀錄
+	ListPromotionRedemptions(ctx context.Context, options *query.PromotionRedemptionOptions) ([]*model.PromotionRedemption, error)
+	// DeletePromotionRedemptions 刪除優惠活動使用紀錄
+	DeletePromotionRedemptions(ctx context.Context, options *query.PromotionRedemptionOptions) error
 }
 
 type IProductDB interface {
 	ListProducts(ctx context.Context, options *query.ProductOptions) ([]*model.Product, error)
+	// GetProduct 取得單筆商品，找不到時返回 errors.ErrResourceNotFound
+	GetProduct(ctx context.Context, options *query.ProductOptions) (*model.Product, error)
+	// CreateProduct 建立商品及商品的庫存
+	CreateProduct(ctx context.Context, mProduct *model.Product) error
+	// UpdateProduct 更新商品
+	UpdateProduct(ctx context.Context, options *query.ProductOptions, updates *updates.Product) error
+}
+
+type ICategoryDB interface {
+	// CreateCategory 建立商品分類
+	CreateCategory(ctx context.Context, mCategory *model.Category) error
+	// GetCategory 取得單筆商品分類，找不到時返回 errors.ErrResourceNotFound
+	GetCategory(ctx context.Context, options *query.CategoryOptions) (*model.Category, error)
+	// ListCategories 取得多筆商品分類
+	ListCategories(ctx context.Context, options *query.CategoryOptions) ([]*model.Category, error)
 }
 
 type IMemberDB interface {
-	// GetMember 取得用戶的會員等級
+	// GetMember 取得用戶的會員等級，用戶不是會員時返回 errors.ErrResourceNotFound
 	GetMember(ctx context.Context, options *query.MemberOptions) (*model.Member, error)
+	// CreateMember 授予用戶會員方案
+	CreateMember(ctx context.Context, member *model.Member) error
+	// UpdateMember 變更用戶的會員方案
+	UpdateMember(ctx context.Context, options *query.MemberOptions, updates *updates.Member) error
 }
 
 type IOrderDB interface {
 	// CreateOrder 建立訂單
 	CreateOrder(ctx context.Context, order *model.Order) error
+	// GetOrder 取得單筆訂單
+	GetOrder(ctx context.Context, options *query.OrderOptions) (*model.Order, error)
+	// ListOrders 取得多筆訂單
+	ListOrders(ctx context.Context, options *query.OrderOptions) ([]*model.Order, error)
+	// UpdateOrder 更新訂單
+	UpdateOrder(ctx context.Context, options *query.OrderOptions, updates *updates.Order) error
+	// UpdateOrderItem 更新訂單詳情
+	UpdateOrderItem(ctx context.Context, options *query.OrderItemOptions, updates *updates.OrderItem) error
+	// CreateOrderStatusHistory 新增訂單狀態變更紀錄
+	CreateOrderStatusHistory(ctx context.Context, history *model.OrderStatusHistory) error
+	// ListOrderStatusHistories 取得訂單狀態變更紀錄，依時間排序
+	ListOrderStatusHistories(ctx context.Context, options *query.OrderStatusHistoryOptions) ([]*model.OrderStatusHistory, error)
+	// CreateOrderIdempotencyKey 新增冪等紀錄，(UserID, Key) 重複時返回 errors.ErrResourceAlreadyExists
+	CreateOrderIdempotencyKey(ctx context.Context, key *model.OrderIdempotencyKey) error
+	// GetOrderIdempotencyKey 取得冪等紀錄
+	GetOrderIdempotencyKey(ctx context.Context, options *query.OrderIdempotencyKeyOptions) (*model.OrderIdempotencyKey, error)
+	// UpdateOrderIdempotencyKey 更新冪等紀錄的結果
+	UpdateOrderIdempotencyKey(ctx context.Context, options *query.OrderIdempotencyKeyOptions, updates *updates.OrderIdempotencyKey) error
+	// DeleteOrderIdempotencyKey 刪除冪等紀錄
+	DeleteOrderIdempotencyKey(ctx context.Context, options *query.OrderIdempotencyKeyOptions) error
 }
 
 type IWalletDB interface {
 	// GetWallet 取得用戶的錢包
 	GetWallet(ctx context.Context, options *query.WalletOptions) (*model.Wallet, error)
-	// UpdateWallet 更新用戶的錢包
+	// CreateWallet 建立用戶的錢包
+	CreateWallet(ctx context.Context, wallet *model.Wallet) error
+	// UpdateWallet 更新用戶的錢包，並寫入錢包異動紀錄
 	UpdateWallet(ctx context.Context, options *query.WalletOptions, updates *updates.Wallet) error
+	// ListWalletTransactions 取得錢包異動紀錄
+	ListWalletTransactions(ctx context.Context, options *query.WalletTransactionOptions) ([]*model.WalletTransaction, error)
 }
 
 type IInventoryDB interface {
 	ListInventories(ctx context.Context, options *query.InventoryOptions) ([]*model.Inventory, error)
+	// UpdateInventory 更新庫存，並寫入庫存異動紀錄
 	UpdateInventory(ctx context.Context, options *query.InventoryOptions, updates *updates.Inventory) error
+	// ListStockMovements 取得庫存異動紀錄
+	ListStockMovements(ctx context.Context, options *query.StockMovementOptions) ([]*model.StockMovement, error)
+}
+
+type IReservationDB interface {
+	// CreateReservation 建立庫存保留單
+	CreateReservation(ctx context.Context, reservation *model.Reservation) error
+	// GetReservation 取得單筆庫存保留單
+	GetReservation(ctx context.Context, options *query.ReservationOptions) (*model.Reservation, error)
+	// ListReservations 取得多筆庫存保留單
+	ListReservations(ctx context.Context, options *query.ReservationOptions) ([]*model.Reservation, error)
+	// UpdateReservation 更新庫存保留單
+	UpdateReservation(ctx context.Context, options *query.ReservationOptions, updates *updates.Reservation) error
+}
+
+type ICouponDB interface {
+	// CreateCoupons 批次建立優惠碼，任一優惠碼重複時返回 errors.ErrResourceAlreadyExists
+	CreateCoupons(ctx context.Context, coupons []*model.Coupon) error
+	// ListCoupons 取得多筆優惠碼
+	ListCoupons(ctx context.Context, options *query.CouponOptions) ([]*model.Coupon, error)
+	// UpdateCoupon 更新優惠碼
+	UpdateCoupon(ctx context.Context, options *query.CouponOptions, updates *updates.Coupon) error
+	// CreateCouponRedemption 紀錄優惠碼使用
+	CreateCouponRedemption(ctx context.Context, redemption *model.CouponRedemption) error
+	// ListCouponRedemptions 取得優惠碼使用紀錄
+	ListCouponRedemptions(ctx context.Context, options *query.CouponRedemptionOptions) ([]*model.CouponRedemption, error)
+	// DeleteCouponRedemptions 刪除優惠碼使用紀錄
+	DeleteCouponRedemptions(ctx context.Context, options *query.CouponRedemptionOptions) error
 }
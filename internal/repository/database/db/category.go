@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/pkg/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// category schema
+type category struct {
+	ID        int64     `gorm:"column:id"`
+	ParentID  int64     `gorm:"column:parent_id"`  // 上層分類ID，0 為最上層分類
+	Name      string    `gorm:"column:name"`       // 分類名稱
+	Path      string    `gorm:"column:path"`       // 所有上層分類ID，e.g. "/1/3/"
+	CreatedAt time.Time `gorm:"column:created_at"` // 創建時間
+	UpdatedAt time.Time `gorm:"column:updated_at"` // 更新時間
+}
+
+func (c category) TableName() string {
+	return "categories"
+}
+
+func (c *category) ConvertToModel() *model.Category {
+	return &model.Category{
+		ID:        c.ID,
+		ParentID:  c.ParentID,
+		Name:      c.Name,
+		Path:      c.Path,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+}
+
+func buildCategoryWhereCondition(db *gorm.DB, options *query.CategoryOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.IDIn) > 0 {
+		values := make([]interface{}, 0, len(options.IDIn))
+		for i := range options.IDIn {
+			values = append(values, options.IDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "id",
+			Values: values,
+		})
+	}
+
+	if len(options.ParentIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.ParentIDIn))
+		for i := range options.ParentIDIn {
+			values = append(values, options.ParentIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "parent_id",
+			Values: values,
+		})
+	}
+
+	if options.PathPrefix != "" {
+		clauses = append(clauses, clause.Like{
+			Column: "path",
+			Value:  likeEscaper.Replace(options.PathPrefix) + "%",
+		})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// CreateCategory 建立商品分類
+func (db *database) CreateCategory(ctx context.Context, mCategory *model.Category) error {
+	var _category = &category{
+		ParentID: mCategory.ParentID,
+		Name:     mCategory.Name,
+		Path:     mCategory.Path,
+	}
+
+	if err := db.WriteDB(ctx).Create(_category).Error; err != nil {
+		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	}
+
+	mCategory.ID = _category.ID
+	mCategory.CreatedAt = _category.CreatedAt
+	mCategory.UpdatedAt = _category.UpdatedAt
+
+	return nil
+}
+
+// GetCategory 取得單筆商品分類，找不到時返回 errors.ErrResourceNotFound
+func (db *database) GetCategory(ctx context.Context, options *query.CategoryOptions) (*model.Category, error) {
+	var _category = &category{}
+
+	if err := buildCategoryWhereCondition(db.ReadDB(ctx), options).First(_category).Error; err != nil {
+		return nil, errors.Wrapf(notFoundOrInternalError(err), "%+v", err)
+	}
+
+	return _category.ConvertToModel(), nil
+}
+
+// ListCategories 取得多筆商品分類，依分類路徑排序
+func (db *database) ListCategories(ctx context.Context, options *query.CategoryOptions) ([]*model.Category, error) {
+	var _categories = make([]*category, 0)
+
+	if err := buildCategoryWhereCondition(db.ReadDB(ctx), options).
+		Order("path, id").
+		Find(&_categories).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mCategories = make([]*model.Category, 0, len(_categories))
+	for i := range _categories {
+		mCategories = append(mCategories, _categories[i].ConvertToModel())
+	}
+
+	return mCategories, nil
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	iDB "cashier/internal/repository/database"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// ################################
+//
+//  超級隨便的測試
+//  只是想測試 sql 語法正常
+//
+// ################################
+
+type CategorySuite struct {
+	suite.Suite
+
+	ctx  context.Context
+	repo iDB.IDatabase
+}
+
+func TestCategory(t *testing.T) {
+	suite.Run(t, new(CategorySuite))
+}
+
+func (s *CategorySuite) SetupSuite() {
+	readDB, writeDB, err := newTestDB()
+	s.Require().NoError(err)
+
+	s.ctx = context.Background()
+	s.repo = New(readDB, writeDB)
+}
+
+func (s *CategorySuite) TestCreateAndListCategories() {
+	parent := &model.Category{Name: "parent", Path: "/"}
+	err := s.repo.CreateCategory(s.ctx, parent)
+	s.Require().NoError(err)
+
+	child := &model.Category{ParentID: parent.ID, Name: "child", Path: parent.ChildPath()}
+	err = s.repo.CreateCategory(s.ctx, child)
+	s.Require().NoError(err)
+
+	categories, err := s.repo.ListCategories(s.ctx, &query.CategoryOptions{
+		PathPrefix: parent.ChildPath(),
+	})
+	s.Require().NoError(err)
+	s.Require().Len(categories, 1)
+	s.Require().Equal([]int64{parent.ID, child.ID}, categories[0].AncestorIDs())
+}
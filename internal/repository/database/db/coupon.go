@@ -0,0 +1,290 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// coupon schema，code 為 unique key
+type coupon struct {
+	ID             int64     `gorm:"column:id"`
+	Code           string    `gorm:"column:code"`            // 優惠碼
+	PromotionID    int64     `gorm:"column:promotion_id"`    // 關聯 promotions.id
+	MaxRedemptions int32     `gorm:"column:max_redemptions"` // 總共可使用次數，0 為不限制
+	MaxPerUser     int32     `gorm:"column:max_per_user"`    // 每個用戶可使用次數，0 為不限制
+	RedeemedCount  int32     `gorm:"column:redeemed_count"`  // 已使用次數
+	ExpiredAt      time.Time `gorm:"column:expired_at"`      // 到期時間
+	CreatedAt      time.Time `gorm:"column:created_at"`      // 創建時間
+	UpdatedAt      time.Time `gorm:"column:updated_at"`      // 更新時間
+}
+
+func (c coupon) TableName() string {
+	return "coupons"
+}
+
+func (c *coupon) ConvertToModel() *model.Coupon {
+	return &model.Coupon{
+		ID:             c.ID,
+		Code:           c.Code,
+		PromotionID:    c.PromotionID,
+		MaxRedemptions: c.MaxRedemptions,
+		MaxPerUser:     c.MaxPerUser,
+		RedeemedCount:  c.RedeemedCount,
+		ExpiredAt:      c.ExpiredAt,
+		CreatedAt:      c.CreatedAt,
+		UpdatedAt:      c.UpdatedAt,
+	}
+}
+
+type couponUpdates struct {
+	RedeemedCount *gormExpr `gorm:"column:redeemed_count"`
+}
+
+func buildCouponWhereCondition(db *gorm.DB, options *query.CouponOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.IDIn) > 0 {
+		values := make([]interface{}, 0, len(options.IDIn))
+		for i := range options.IDIn {
+			values = append(values, options.IDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "id",
+			Values: values,
+		})
+	}
+
+	if len(options.CodeIn) > 0 {
+		values := make([]interface{}, 0, len(options.CodeIn))
+		for i := range options.CodeIn {
+			values = append(values, options.CodeIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "code",
+			Values: values,
+		})
+	}
+
+	if len(options.PromotionIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.PromotionIDIn))
+		for i := range options.PromotionIDIn {
+			values = append(values, options.PromotionIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "promotion_id",
+			Values: values,
+		})
+	}
+
+	if options.Lock {
+		clauses = append(clauses, clause.Locking{Strength: "UPDATE"})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// CreateCoupons 批次建立優惠碼，任一優惠碼重複時全部不建立並返回 errors.ErrResourceAlreadyExists
+func (db *database) CreateCoupons(ctx context.Context, mCoupons []*model.Coupon) error {
+	if len(mCoupons) == 0 {
+		return nil
+	}
+
+	var _coupons = make([]*coupon, 0, len(mCoupons))
+	for i := range mCoupons {
+		_coupons = append(_coupons, &coupon{
+			Code:           mCoupons[i].Code,
+			PromotionID:    mCoupons[i].PromotionID,
+			MaxRedemptions: mCoupons[i].MaxRedemptions,
+			MaxPerUser:     mCoupons[i].MaxPerUser,
+			ExpiredAt:      mCoupons[i].ExpiredAt,
+		})
+	}
+
+	// 已在 transaction 內時 gorm 會使用 savepoint
+	err := db.WriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&_coupons).Error; err != nil {
+			return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range _coupons {
+		mCoupons[i].ID = _coupons[i].ID
+		mCoupons[i].CreatedAt = _coupons[i].CreatedAt
+		mCoupons[i].UpdatedAt = _coupons[i].UpdatedAt
+	}
+
+	return nil
+}
+
+// ListCoupons 取得多筆優惠碼
+func (db *database) ListCoupons(ctx context.Context, options *query.CouponOptions) ([]*model.Coupon, error) {
+	var _coupons = make([]*coupon, 0)
+
+	if err := buildCouponWhereCondition(db.ReadDB(ctx), options).
+		Order("id").
+		Find(&_coupons).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mCoupons = make([]*model.Coupon, 0, len(_coupons))
+	for i := range _coupons {
+		mCoupons = append(mCoupons, _coupons[i].ConvertToModel())
+	}
+
+	return mCoupons, nil
+}
+
+// UpdateCoupon 更新優惠碼
+func (db *database) UpdateCoupon(ctx context.Context, options *query.CouponOptions, updates *updates.Coupon) error {
+	// 沒有條件時會更新所有優惠碼
+	if len(options.IDIn) == 0 && len(options.CodeIn) == 0 && len(options.PromotionIDIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "coupon id, code or promotion id is required")
+	}
+
+	var _updates = &couponUpdates{}
+
+	if updates.RedeemedCount != nil {
+		_updates.RedeemedCount = &gormExpr{clause.Expr{
+			SQL:  fmt.Sprintf("%s %s ?", "redeemed_count", updates.RedeemedCount.Operation.Sql()),
+			Vars: []interface{}{updates.RedeemedCount.Quantity},
+		}}
+	}
+
+	if err := buildCouponWhereCondition(db.WriteDB(ctx), options).
+		Table(coupon{}.TableName()).
+		Updates(_updates).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
+}
+
+// couponRedemption schema，取消訂單或全額退款時刪除
+type couponRedemption struct {
+	ID        int64     `gorm:"column:id"`
+	CouponID  int64     `gorm:"column:coupon_id"`  // 關聯 coupons.id
+	UserID    int64     `gorm:"column:user_id"`    // 用戶ID
+	OrderID   string    `gorm:"column:order_id"`   // 關聯的 OrderID
+	CreatedAt time.Time `gorm:"column:created_at"` // 創建時間
+}
+
+func (c couponRedemption) TableName() string {
+	return "coupon_redemptions"
+}
+
+func (c *couponRedemption) ConvertToModel() *model.CouponRedemption {
+	return &model.CouponRedemption{
+		ID:        c.ID,
+		CouponID:  c.CouponID,
+		UserID:    c.UserID,
+		OrderID:   c.OrderID,
+		CreatedAt: c.CreatedAt,
+	}
+}
+
+func buildCouponRedemptionWhereCondition(db *gorm.DB, options *query.CouponRedemptionOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.CouponIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.CouponIDIn))
+		for i := range options.CouponIDIn {
+			values = append(values, options.CouponIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "coupon_id",
+			Values: values,
+		})
+	}
+
+	if len(options.UserIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.UserIDIn))
+		for i := range options.UserIDIn {
+			values = append(values, options.UserIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "user_id",
+			Values: values,
+		})
+	}
+
+	if len(options.OrderIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.OrderIDIn))
+		for i := range options.OrderIDIn {
+			values = append(values, options.OrderIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "order_id",
+			Values: values,
+		})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// CreateCouponRedemption 紀錄優惠碼使用
+func (db *database) CreateCouponRedemption(ctx context.Context, redemption *model.CouponRedemption) error {
+	var _redemption = &couponRedemption{
+		CouponID: redemption.CouponID,
+		UserID:   redemption.UserID,
+		OrderID:  redemption.OrderID,
+	}
+
+	if err := db.WriteDB(ctx).Create(_redemption).Error; err != nil {
+		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	}
+
+	redemption.ID = _redemption.ID
+	redemption.CreatedAt = _redemption.CreatedAt
+
+	return nil
+}
+
+// ListCouponRedemptions 取得優惠碼使用紀錄，依時間排序
+func (db *database) ListCouponRedemptions(ctx context.Context, options *query.CouponRedemptionOptions) ([]*model.CouponRedemption, error) {
+	var _redemptions = make([]*couponRedemption, 0)
+
+	if err := buildCouponRedemptionWhereCondition(db.ReadDB(ctx), options).
+		Order("id").
+		Find(&_redemptions).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mRedemptions = make([]*model.CouponRedemption, 0, len(_redemptions))
+	for i := range _redemptions {
+		mRedemptions = append(mRedemptions, _redemptions[i].ConvertToModel())
+	}
+
+	return mRedemptions, nil
+}
+
+// DeleteCouponRedemptions 刪除優惠碼使用紀錄，取消訂單或全額退款時歸還使用次數
+func (db *database) DeleteCouponRedemptions(ctx context.Context, options *query.CouponRedemptionOptions) error {
+	// 沒有條件時會刪除所有紀錄
+	if len(options.CouponIDIn) == 0 && len(options.UserIDIn) == 0 && len(options.OrderIDIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "delete coupon redemptions without options")
+	}
+
+	if err := buildCouponRedemptionWhereCondition(db.WriteDB(ctx), options).
+		Delete(&couponRedemption{}).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
+}
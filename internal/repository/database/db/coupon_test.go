@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/suite"
+)
+
+// ################################
+//
+//  超級隨便的測試
+//  只是想測試 sql 語法正常
+//
+// ################################
+
+type CouponSuite struct {
+	suite.Suite
+
+	ctx  context.Context
+	repo iDB.IDatabase
+}
+
+func TestCoupon(t *testing.T) {
+	suite.Run(t, new(CouponSuite))
+}
+
+func (s *CouponSuite) SetupSuite() {
+	readDB, writeDB, err := newTestDB()
+	s.Require().NoError(err)
+
+	s.ctx = context.Background()
+	s.repo = New(readDB, writeDB)
+}
+
+func (s *CouponSuite) TestCreateAndRedeemCoupon() {
+	coupons := []*model.Coupon{
+		{
+			Code:           "TEST" + xid.New().String(),
+			PromotionID:    1,
+			MaxRedemptions: 10,
+			MaxPerUser:     1,
+			ExpiredAt:      time.Now().Add(24 * time.Hour),
+		},
+	}
+	err := s.repo.CreateCoupons(s.ctx, coupons)
+	s.Require().NoError(err)
+
+	err = s.repo.Transaction(s.ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		locked, err := txRepo.ListCoupons(txCtx, &query.CouponOptions{
+			CodeIn: []string{coupons[0].Code},
+			Lock:   true,
+		})
+		s.Require().NoError(err)
+		s.Require().Len(locked, 1)
+
+		err = txRepo.UpdateCoupon(txCtx,
+			&query.CouponOptions{IDIn: []int64{locked[0].ID}},
+			&updates.Coupon{RedeemedCount: &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: 1}},
+		)
+		s.Require().NoError(err)
+
+		return txRepo.CreateCouponRedemption(txCtx, &model.CouponRedemption{
+			CouponID: locked[0].ID,
+			UserID:   1,
+			OrderID:  xid.New().String(),
+		})
+	})
+	s.Require().NoError(err)
+
+	redemptions, err := s.repo.ListCouponRedemptions(s.ctx, &query.CouponRedemptionOptions{
+		CouponIDIn: []int64{coupons[0].ID},
+		UserIDIn:   []int64{1},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(redemptions, 1)
+}
+
+func (s *CouponSuite) TestUpdateCouponWithoutOptions() {
+	err := s.repo.UpdateCoupon(s.ctx, &query.CouponOptions{}, &updates.Coupon{RedeemedCount: &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: 1}})
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+}
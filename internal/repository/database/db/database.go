@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"cashier/internal/pkg/errors"
 	iDB "cashier/internal/repository/database"
@@ -123,6 +124,9 @@ func duplicateOrInternalError(err error) error {
 	return errors.ErrInternalError
 }
 
+// likeEscaper 跳脫 LIKE 的萬用字元，讓使用者輸入只做字面比對
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 // gormExpr 包裝 clause.Expr 才能讓 gorm 用來更新欄位
 type gormExpr struct {
 	clause.Expr
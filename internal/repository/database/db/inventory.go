@@ -20,6 +20,7 @@ type inventory struct {
 	ProductID         int64     `gorm:"column:product_id"`
 	TotalQuantity     int32     `gorm:"column:total_quantity"`
 	AvailableQuantity int32     `gorm:"column:available_quantity"`
+	ReservedQuantity  int32     `gorm:"column:reserved_quantity"`
 	CreatedAt         time.Time `gorm:"column:created_at"`
 	UpdatedAt         time.Time `gorm:"column:updated_at"`
 }
@@ -34,6 +35,7 @@ func (i *inventory) ConvertToModel() *model.Inventory {
 		ProductID:         i.ProductID,
 		TotalQuantity:     i.TotalQuantity,
 		AvailableQuantity: i.AvailableQuantity,
+		ReservedQuantity:  i.ReservedQuantity,
 		CreatedAt:         i.CreatedAt,
 		UpdatedAt:         i.UpdatedAt,
 	}
@@ -42,6 +44,7 @@ func (i *inventory) ConvertToModel() *model.Inventory {
 type inventoryUpdates struct {
 	TotalQuantity     *gormExpr `gorm:"column:total_quantity"`
 	AvailableQuantity *gormExpr `gorm:"column:available_quantity"`
+	ReservedQuantity  *gormExpr `gorm:"column:reserved_quantity"`
 }
 
 func buildInventoryWhereCondition(db *gorm.DB, options *query.InventoryOptions) *gorm.DB {
@@ -87,6 +90,11 @@ func (db *database) ListInventories(ctx context.Context, options *query.Inventor
 }
 
 func (db *database) UpdateInventory(ctx context.Context, options *query.InventoryOptions, updates *updates.Inventory) error {
+	// 沒有條件時會更新所有庫存
+	if len(options.ProductIDIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "product id is required")
+	}
+
 	var _updates = &inventoryUpdates{}
 
 	if updates.TotalQuantity != nil {
@@ -103,11 +111,161 @@ func (db *database) UpdateInventory(ctx context.Context, options *query.Inventor
 		}}
 	}
 
-	if err := buildInventoryWhereCondition(db.WriteDB(ctx), options).
-		Table(inventory{}.TableName()).
-		Updates(_updates).Error; err != nil {
-		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	if updates.ReservedQuantity != nil {
+		_updates.ReservedQuantity = &gormExpr{clause.Expr{
+			SQL:  fmt.Sprintf("%s %s ?", "reserved_quantity", updates.ReservedQuantity.Operation.Sql()),
+			Vars: []interface{}{updates.ReservedQuantity.Quantity},
+		}}
+	}
+
+	if _updates.TotalQuantity == nil && _updates.AvailableQuantity == nil && _updates.ReservedQuantity == nil {
+		return nil
+	}
+
+	// 已在 transaction 內時 gorm 會使用 savepoint
+	err := db.WriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		// 鎖定要異動的庫存
+		var _inventories = make([]*inventory, 0)
+		if err := buildInventoryWhereCondition(tx, &query.InventoryOptions{
+			ProductIDIn: options.ProductIDIn,
+			Lock:        true,
+			LockNoWait:  options.LockNoWait,
+		}).Find(&_inventories).Error; err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+		if len(_inventories) == 0 {
+			return errors.Wrapf(errors.ErrResourceNotFound, "inventory not found, options: %+v", options)
+		}
+
+		if err := buildInventoryWhereCondition(tx, options).
+			Table(inventory{}.TableName()).
+			Updates(_updates).Error; err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+
+		// 取得異動後的庫存
+		_inventories = make([]*inventory, 0, len(_inventories))
+		if err := buildInventoryWhereCondition(tx, &query.InventoryOptions{ProductIDIn: options.ProductIDIn}).
+			Find(&_inventories).Error; err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+
+		var _movements = make([]*stockMovement, 0, len(_inventories))
+		for i := range _inventories {
+			_movements = append(_movements, &stockMovement{
+				InventoryID:    _inventories[i].ID,
+				ProductID:      _inventories[i].ProductID,
+				Cause:          updates.Cause,
+				ReferenceID:    updates.ReferenceID,
+				OperatorID:     updates.OperatorID,
+				Note:           updates.Note,
+				TotalDelta:     updates.TotalQuantity.Delta(),
+				AvailableDelta: updates.AvailableQuantity.Delta(),
+				ReservedDelta:  updates.ReservedQuantity.Delta(),
+				TotalAfter:     _inventories[i].TotalQuantity,
+				AvailableAfter: _inventories[i].AvailableQuantity,
+				ReservedAfter:  _inventories[i].ReservedQuantity,
+			})
+		}
+
+		if err := tx.Create(&_movements).Error; err != nil {
+			return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	return nil
 }
+
+// stockMovement schema，只新增不修改
+type stockMovement struct {
+	ID             int64                    `gorm:"column:id"`
+	InventoryID    int64                    `gorm:"column:inventory_id"`    // 關聯 inventories.id
+	ProductID      int64                    `gorm:"column:product_id"`      // 關聯 products.id
+	Cause          model.StockMovementCause `gorm:"column:cause"`           // 異動原因
+	ReferenceID    string                   `gorm:"column:reference_id"`    // 關聯的單號
+	OperatorID     int64                    `gorm:"column:operator_id"`     // 操作者ID
+	Note           string                   `gorm:"column:note"`            // 備註
+	TotalDelta     int32                    `gorm:"column:total_delta"`     // 總庫存異動量
+	AvailableDelta int32                    `gorm:"column:available_delta"` // 可售庫存異動量
+	ReservedDelta  int32                    `gorm:"column:reserved_delta"`  // 保留庫存異動量
+	TotalAfter     int32                    `gorm:"column:total_after"`     // 異動後的總庫存
+	AvailableAfter int32                    `gorm:"column:available_after"` // 異動後的可售庫存
+	ReservedAfter  int32                    `gorm:"column:reserved_after"`  // 異動後的保留庫存
+	CreatedAt      time.Time                `gorm:"column:created_at"`
+}
+
+func (s stockMovement) TableName() string {
+	return "stock_movements"
+}
+
+func (s *stockMovement) ConvertToModel() *model.StockMovement {
+	return &model.StockMovement{
+		ID:             s.ID,
+		InventoryID:    s.InventoryID,
+		ProductID:      s.ProductID,
+		Cause:          s.Cause,
+		ReferenceID:    s.ReferenceID,
+		OperatorID:     s.OperatorID,
+		Note:           s.Note,
+		TotalDelta:     s.TotalDelta,
+		AvailableDelta: s.AvailableDelta,
+		ReservedDelta:  s.ReservedDelta,
+		TotalAfter:     s.TotalAfter,
+		AvailableAfter: s.AvailableAfter,
+		ReservedAfter:  s.ReservedAfter,
+		CreatedAt:      s.CreatedAt,
+	}
+}
+
+func buildStockMovementWhereCondition(db *gorm.DB, options *query.StockMovementOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.ProductIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.ProductIDIn))
+		for i := range options.ProductIDIn {
+			values = append(values, options.ProductIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "product_id",
+			Values: values,
+		})
+	}
+
+	if len(options.ReferenceIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.ReferenceIDIn))
+		for i := range options.ReferenceIDIn {
+			values = append(values, options.ReferenceIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "reference_id",
+			Values: values,
+		})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// ListStockMovements 取得庫存異動紀錄，依時間排序
+func (db *database) ListStockMovements(ctx context.Context, options *query.StockMovementOptions) ([]*model.StockMovement, error) {
+	var _movements = make([]*stockMovement, 0)
+
+	if err := buildStockMovementWhereCondition(db.ReadDB(ctx), options).
+		Order("id").
+		Find(&_movements).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mMovements = make([]*model.StockMovement, 0, len(_movements))
+	for i := range _movements {
+		mMovements = append(mMovements, _movements[i].ConvertToModel())
+	}
+
+	return mMovements, nil
+}
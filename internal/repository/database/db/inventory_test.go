@@ -7,6 +7,7 @@ import (
 	"cashier/internal/model"
 	"cashier/internal/model/query"
 	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
 	iDB "cashier/internal/repository/database"
 
 	"github.com/stretchr/testify/suite"
@@ -53,3 +54,46 @@ func (s *InventorySuite) TestUpdateProducts() {
 	)
 	s.Require().NoError(err)
 }
+
+func (s *InventorySuite) TestUpdateInventoryWithCause() {
+	err := s.repo.UpdateInventory(s.ctx,
+		&query.InventoryOptions{
+			ProductIDIn: []int64{1},
+		},
+		&updates.Inventory{
+			TotalQuantity: &model.QuantityOperation{
+				Operation: model.NumericOperationAdd,
+				Quantity:  10,
+			},
+			AvailableQuantity: &model.QuantityOperation{
+				Operation: model.NumericOperationAdd,
+				Quantity:  10,
+			},
+			Cause:       model.StockMovementCauseRestock,
+			ReferenceID: "PO-1",
+			OperatorID:  1,
+		},
+	)
+	s.Require().NoError(err)
+}
+
+func (s *InventorySuite) TestUpdateInventoryWithoutOptions() {
+	err := s.repo.UpdateInventory(s.ctx,
+		&query.InventoryOptions{},
+		&updates.Inventory{
+			AvailableQuantity: &model.QuantityOperation{
+				Operation: model.NumericOperationAdd,
+				Quantity:  1,
+			},
+		},
+	)
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+}
+
+func (s *InventorySuite) TestListStockMovements() {
+	_, err := s.repo.ListStockMovements(s.ctx, &query.StockMovementOptions{
+		ProductIDIn:   []int64{1},
+		ReferenceIDIn: []string{"PO-1"},
+	})
+	s.Require().NoError(err)
+}
@@ -2,13 +2,124 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"cashier/internal/model"
 	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// GetMember 取得該用戶的會員方案
+// member schema，user_id 為 unique key
+type member struct {
+	ID        int32            `gorm:"column:id"`         // ID
+	UserID    int64            `gorm:"column:user_id"`    // 用戶ID
+	Type      model.MemberType `gorm:"column:type"`       // 會員類型
+	Level     int8             `gorm:"column:level"`      // 會員等級
+	CreatedAt time.Time        `gorm:"column:created_at"` // 創建時間
+	UpdatedAt time.Time        `gorm:"column:updated_at"` // 更新時間
+}
+
+func (m member) TableName() string {
+	return "members"
+}
+
+func (m *member) ConvertToModel() *model.Member {
+	return &model.Member{
+		ID:        m.ID,
+		UserID:    m.UserID,
+		Type:      m.Type,
+		Level:     m.Level,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+type memberUpdates struct {
+	Type  *model.MemberType `gorm:"column:type"`  // 會員類型
+	Level *int8             `gorm:"column:level"` // 會員等級
+}
+
+func buildMemberWhereCondition(db *gorm.DB, options *query.MemberOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.IDIn) > 0 {
+		values := make([]interface{}, 0, len(options.IDIn))
+		for i := range options.IDIn {
+			values = append(values, options.IDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "id",
+			Values: values,
+		})
+	}
+
+	if len(options.UserIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.UserIDIn))
+		for i := range options.UserIDIn {
+			values = append(values, options.UserIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "user_id",
+			Values: values,
+		})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// GetMember 取得該用戶的會員方案，找不到時返回 errors.ErrResourceNotFound
 func (db *database) GetMember(ctx context.Context, options *query.MemberOptions) (*model.Member, error) {
-	// skip ...
-	return &model.Member{}, nil
+	var _member = &member{}
+
+	if err := buildMemberWhereCondition(db.ReadDB(ctx), options).First(_member).Error; err != nil {
+		return nil, errors.Wrapf(notFoundOrInternalError(err), "%+v", err)
+	}
+
+	return _member.ConvertToModel(), nil
+}
+
+// CreateMember 建立用戶的會員方案，用戶已有會員方案時返回 errors.ErrResourceAlreadyExists
+func (db *database) CreateMember(ctx context.Context, mMember *model.Member) error {
+	var _member = &member{
+		UserID: mMember.UserID,
+		Type:   mMember.Type,
+		Level:  mMember.Level,
+	}
+
+	if err := db.WriteDB(ctx).Create(_member).Error; err != nil {
+		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	}
+
+	mMember.ID = _member.ID
+	mMember.CreatedAt = _member.CreatedAt
+	mMember.UpdatedAt = _member.UpdatedAt
+
+	return nil
+}
+
+// UpdateMember 更新用戶的會員類型 & 等級
+func (db *database) UpdateMember(ctx context.Context, options *query.MemberOptions, updates *updates.Member) error {
+	// 沒有條件時會更新所有會員
+	if len(options.IDIn) == 0 && len(options.UserIDIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "member id or user id is required")
+	}
+
+	var _updates = &memberUpdates{
+		Type:  updates.Type,
+		Level: updates.Level,
+	}
+
+	if err := buildMemberWhereCondition(db.WriteDB(ctx), options).
+		Table(member{}.TableName()).
+		Updates(_updates).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// ################################
+//
+//  超級隨便的測試
+//  只是想測試 sql 語法正常
+//
+// ################################
+
+type MemberSuite struct {
+	suite.Suite
+
+	ctx  context.Context
+	repo iDB.IDatabase
+}
+
+func TestMember(t *testing.T) {
+	suite.Run(t, new(MemberSuite))
+}
+
+func (s *MemberSuite) SetupSuite() {
+	readDB, writeDB, err := newTestDB()
+	s.Require().NoError(err)
+
+	s.ctx = context.Background()
+	s.repo = New(readDB, writeDB)
+}
+
+func (s *MemberSuite) TestMember() {
+	var userID int64 = 87654321
+
+	_, err := s.repo.GetMember(s.ctx, &query.MemberOptions{UserIDIn: []int64{userID}})
+	if errors.Is(err, errors.ErrResourceNotFound) {
+		err = s.repo.CreateMember(s.ctx, &model.Member{
+			UserID: userID,
+			Type:   model.MemberTypeVIP,
+			Level:  1,
+		})
+	}
+	s.Require().NoError(err)
+
+	memberType, level := model.MemberTypePro, int8(2)
+	err = s.repo.UpdateMember(s.ctx,
+		&query.MemberOptions{UserIDIn: []int64{userID}},
+		&updates.Member{Type: &memberType, Level: &level},
+	)
+	s.Require().NoError(err)
+
+	member, err := s.repo.GetMember(s.ctx, &query.MemberOptions{UserIDIn: []int64{userID}})
+	s.Require().NoError(err)
+	s.Require().Equal(model.MemberTypePro, member.Type)
+	s.Require().Equal(level, member.Level)
+}
+
+func (s *MemberSuite) TestUpdateMemberWithoutOptions() {
+	memberType := model.MemberTypePro
+	err := s.repo.UpdateMember(s.ctx, &query.MemberOptions{}, &updates.Member{Type: &memberType})
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+}
@@ -3,24 +3,33 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"time"
 
 	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
 	"cashier/internal/pkg/errors"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type order struct {
-	ID            string          `gorm:"column:id"`
-	UserID        int64           `gorm:"column:user_id"`        // 用戶ID
-	OriginalPrice decimal.Decimal `gorm:"column:original_price"` // 原始價格
-	FinalPrice    decimal.Decimal `gorm:"column:final_price"`    // 最終價格 (扣除優惠活動)
-	UsedPoints    int32           `gorm:"column:used_points"`    // 使用平台點數
-	PromotionIDs  datatypes.JSON  `gorm:"column:promotion_ids"`  // 使用的優惠ID
-	CreatedAt     time.Time       `gorm:"column:created_at"`
-	UpdatedAt     time.Time       `gorm:"column:updated_at"`
+	ID             string            `gorm:"column:id"`
+	UserID         int64             `gorm:"column:user_id"`         // 用戶ID
+	Status         model.OrderStatus `gorm:"column:status"`          // 訂單狀態
+	OriginalPrice  decimal.Decimal   `gorm:"column:original_price"`  // 原始價格
+	FinalPrice     decimal.Decimal   `gorm:"column:final_price"`     // 最終價格 (扣除優惠活動)
+	UsedPoints     int32             `gorm:"column:used_points"`     // 使用平台點數
+	PromotionIDs   datatypes.JSON    `gorm:"column:promotion_ids"`   // 使用的優惠ID
+	PriceBreakdown datatypes.JSON    `gorm:"column:price_breakdown"` // 優惠計算明細
+	CouponCodes    datatypes.JSON    `gorm:"column:coupon_codes"`    // 使用的優惠碼
+	CreatedAt      time.Time         `gorm:"column:created_at"`
+	UpdatedAt      time.Time         `gorm:"column:updated_at"`
 
 	Items []*orderItem `gorm:"foreignKey:OrderID;references:ID"`
 }
@@ -29,10 +38,130 @@ func (o order) TableName() string {
 	return "orders"
 }
 
+func (o *order) ConvertToModel() (*model.Order, error) {
+	mo := &model.Order{
+		ID:            o.ID,
+		UserID:        o.UserID,
+		Status:        o.Status,
+		OriginalPrice: o.OriginalPrice,
+		FinalPrice:    o.FinalPrice,
+		UsedPoints:    o.UsedPoints,
+		CreatedAt:     o.CreatedAt,
+		UpdatedAt:     o.UpdatedAt,
+		Items:         make([]*model.OrderItem, 0, len(o.Items)),
+	}
+
+	if len(o.PromotionIDs) > 0 {
+		if err := json.Unmarshal(o.PromotionIDs, &mo.PromotionIDs); err != nil {
+			return nil, errors.Wrapf(errors.ErrInternalError, "%+v", err)
+		}
+	}
+
+	if len(o.PriceBreakdown) > 0 {
+		if err := json.Unmarshal(o.PriceBreakdown, &mo.PriceBreakdown); err != nil {
+			return nil, errors.Wrapf(errors.ErrInternalError, "%+v", err)
+		}
+	}
+
+	if len(o.CouponCodes) > 0 {
+		if err := json.Unmarshal(o.CouponCodes, &mo.CouponCodes); err != nil {
+			return nil, errors.Wrapf(errors.ErrInternalError, "%+v", err)
+		}
+	}
+
+	for i := range o.Items {
+		mo.Items = append(mo.Items, o.Items[i].ConvertToModel())
+	}
+
+	return mo, nil
+}
+
+type orderUpdates struct {
+	Status *model.OrderStatus `gorm:"column:status"` // 訂單狀態
+}
+
+func buildOrderWhereCondition(db *gorm.DB, options *query.OrderOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.IDIn) > 0 {
+		values := make([]interface{}, 0, len(options.IDIn))
+		for i := range options.IDIn {
+			values = append(values, options.IDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "id",
+			Values: values,
+		})
+	}
+
+	if len(options.UserIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.UserIDIn))
+		for i := range options.UserIDIn {
+			values = append(values, options.UserIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "user_id",
+			Values: values,
+		})
+	}
+
+	if len(options.StatusIn) > 0 {
+		values := make([]interface{}, 0, len(options.StatusIn))
+		for i := range options.StatusIn {
+			values = append(values, options.StatusIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "status",
+			Values: values,
+		})
+	}
+
+	if options.CreatedAtGte != nil {
+		clauses = append(clauses, clause.Gte{
+			Column: "created_at",
+			Value:  options.CreatedAtGte,
+		})
+	}
+
+	if options.CreatedAtLt != nil {
+		clauses = append(clauses, clause.Lt{
+			Column: "created_at",
+			Value:  options.CreatedAtLt,
+		})
+	}
+
+	if options.PromotionID > 0 {
+		clauses = append(clauses, clause.Expr{
+			SQL:  "JSON_CONTAINS(promotion_ids, ?)",
+			Vars: []interface{}{strconv.FormatInt(options.PromotionID, 10)},
+		})
+	}
+
+	if options.Cursor != "" {
+		clauses = append(clauses, clause.Lt{
+			Column: "id",
+			Value:  options.Cursor,
+		})
+	}
+
+	if options.Lock {
+		clauses = append(clauses, clause.Locking{Strength: "UPDATE"})
+	}
+
+	if options.WithItems {
+		db = db.Preload("Items")
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
 func (db *database) CreateOrder(ctx context.Context, mOrder *model.Order) (err error) {
 	var _order = &order{
 		ID:            mOrder.ID,
 		UserID:        mOrder.UserID,
+		Status:        mOrder.Status,
 		OriginalPrice: mOrder.OriginalPrice,
 		FinalPrice:    mOrder.FinalPrice,
 		UsedPoints:    mOrder.UsedPoints,
@@ -44,6 +173,19 @@ func (db *database) CreateOrder(ctx context.Context, mOrder *model.Order) (err e
 		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
 	}
 
+	_order.PriceBreakdown, err = json.Marshal(mOrder.PriceBreakdown)
+	if err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	if mOrder.CouponCodes == nil {
+		mOrder.CouponCodes = make([]string, 0)
+	}
+	_order.CouponCodes, err = json.Marshal(mOrder.CouponCodes)
+	if err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
 	for i := range mOrder.Items {
 		_order.Items = append(_order.Items, newOrderItem(mOrder.Items[i]))
 	}
@@ -55,13 +197,75 @@ func (db *database) CreateOrder(ctx context.Context, mOrder *model.Order) (err e
 	return nil
 }
 
+// GetOrder 取得單筆訂單，找不到時返回 errors.ErrResourceNotFound
+func (db *database) GetOrder(ctx context.Context, options *query.OrderOptions) (*model.Order, error) {
+	var _order = &order{}
+
+	if err := buildOrderWhereCondition(db.ReadDB(ctx), options).First(_order).Error; err != nil {
+		return nil, errors.Wrapf(notFoundOrInternalError(err), "%+v", err)
+	}
+
+	return _order.ConvertToModel()
+}
+
+// ListOrders 取得多筆訂單，依訂單ID由新到舊排序
+func (db *database) ListOrders(ctx context.Context, options *query.OrderOptions) ([]*model.Order, error) {
+	var _orders = make([]*order, 0)
+
+	tx := buildOrderWhereCondition(db.ReadDB(ctx), options).Order("id DESC")
+	if options.Limit > 0 {
+		tx = tx.Limit(options.Limit)
+	}
+
+	if err := tx.Find(&_orders).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mOrders = make([]*model.Order, 0, len(_orders))
+	for i := range _orders {
+		mOrder, err := _orders[i].ConvertToModel()
+		if err != nil {
+			return nil, err
+		}
+		mOrders = append(mOrders, mOrder)
+	}
+
+	return mOrders, nil
+}
+
+// UpdateOrder 更新訂單
+func (db *database) UpdateOrder(ctx context.Context, options *query.OrderOptions, updates *updates.Order) error {
+	// 沒有條件時會更新所有訂單
+	if len(options.IDIn) == 0 && len(options.UserIDIn) == 0 && len(options.StatusIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "order id, user id or status is required")
+	}
+
+	var _updates = &orderUpdates{
+		Status: updates.Status,
+	}
+
+	if err := buildOrderWhereCondition(db.WriteDB(ctx), options).
+		Table(order{}.TableName()).
+		Updates(_updates).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
+}
+
 type orderItem struct {
-	ID        int64           `gorm:"column:id"`
-	OrderID   string          `gorm:"column:order_id"`   // 關聯的 OrderID
-	ProductID int64           `gorm:"column:product_id"` // Product 的 ID
-	Name      string          `gorm:"column:name"`       // 商品名稱
-	UnitPrice decimal.Decimal `gorm:"column:unit_price"` // 平台幣/單價
-	Quantity  int32           `gorm:"column:quantity"`   // 數量
+	ID               int64           `gorm:"column:id"`
+	OrderID          string          `gorm:"column:order_id"`          // 關聯的 OrderID
+	ProductID        int64           `gorm:"column:product_id"`        // Product 的 ID
+	Name             string          `gorm:"column:name"`              // 商品名稱
+	UnitPrice        decimal.Decimal `gorm:"column:unit_price"`        // 平台幣/單價
+	Quantity         int32           `gorm:"column:quantity"`          // 數量
+	DiscountAmount   decimal.Decimal `gorm:"column:discount_amount"`   // 分攤到的折扣金額
+	FinalPrice       decimal.Decimal `gorm:"column:final_price"`       // 分攤折扣後實付的平台幣
+	UsedPoints       int32           `gorm:"column:used_points"`       // 分攤到的平台點數
+	RefundedQuantity int32           `gorm:"column:refunded_quantity"` // 已退款數量
+	RefundedToken    decimal.Decimal `gorm:"column:refunded_token"`    // 已退回的平台幣
+	RefundedPoints   int32           `gorm:"column:refunded_points"`   // 已退回的平台點數
 }
 
 func (o orderItem) TableName() string {
@@ -70,10 +274,344 @@ func (o orderItem) TableName() string {
 
 func newOrderItem(item *model.OrderItem) *orderItem {
 	return &orderItem{
-		OrderID:   item.OrderID,
-		ProductID: item.ProductID,
-		Name:      item.Name,
-		UnitPrice: item.UnitPrice,
-		Quantity:  item.Quantity,
+		OrderID:        item.OrderID,
+		ProductID:      item.ProductID,
+		Name:           item.Name,
+		UnitPrice:      item.UnitPrice,
+		Quantity:       item.Quantity,
+		DiscountAmount: item.DiscountAmount,
+		FinalPrice:     item.FinalPrice,
+		UsedPoints:     item.UsedPoints,
+	}
+}
+
+func (o *orderItem) ConvertToModel() *model.OrderItem {
+	return &model.OrderItem{
+		ID:               o.ID,
+		OrderID:          o.OrderID,
+		ProductID:        o.ProductID,
+		Name:             o.Name,
+		UnitPrice:        o.UnitPrice,
+		Quantity:         o.Quantity,
+		DiscountAmount:   o.DiscountAmount,
+		FinalPrice:       o.FinalPrice,
+		UsedPoints:       o.UsedPoints,
+		RefundedQuantity: o.RefundedQuantity,
+		RefundedToken:    o.RefundedToken,
+		RefundedPoints:   o.RefundedPoints,
+	}
+}
+
+type orderItemUpdates struct {
+	RefundedQuantity *gormExpr `gorm:"column:refunded_quantity"`
+	RefundedToken    *gormExpr `gorm:"column:refunded_token"`
+	RefundedPoints   *gormExpr `gorm:"column:refunded_points"`
+}
+
+func buildOrderItemWhereCondition(db *gorm.DB, options *query.OrderItemOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.IDIn) > 0 {
+		values := make([]interface{}, 0, len(options.IDIn))
+		for i := range options.IDIn {
+			values = append(values, options.IDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "id",
+			Values: values,
+		})
+	}
+
+	if len(options.OrderIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.OrderIDIn))
+		for i := range options.OrderIDIn {
+			values = append(values, options.OrderIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "order_id",
+			Values: values,
+		})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// UpdateOrderItem 更新訂單詳情的退款紀錄
+func (db *database) UpdateOrderItem(ctx context.Context, options *query.OrderItemOptions, updates *updates.OrderItem) error {
+	// 沒有條件時會更新所有訂單品項
+	if len(options.IDIn) == 0 && len(options.OrderIDIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "order item id or order id is required")
+	}
+
+	var _updates = &orderItemUpdates{}
+
+	if updates.RefundedQuantity != nil {
+		_updates.RefundedQuantity = &gormExpr{clause.Expr{
+			SQL:  fmt.Sprintf("%s %s ?", "refunded_quantity", updates.RefundedQuantity.Operation.Sql()),
+			Vars: []interface{}{updates.RefundedQuantity.Quantity},
+		}}
+	}
+
+	if updates.RefundedToken != nil {
+		_updates.RefundedToken = &gormExpr{clause.Expr{
+			SQL:  fmt.Sprintf("%s %s ?", "refunded_token", updates.RefundedToken.Operation.Sql()),
+			Vars: []interface{}{updates.RefundedToken.Token},
+		}}
 	}
+
+	if updates.RefundedPoints != nil {
+		_updates.RefundedPoints = &gormExpr{clause.Expr{
+			SQL:  fmt.Sprintf("%s %s ?", "refunded_points", updates.RefundedPoints.Operation.Sql()),
+			Vars: []interface{}{updates.RefundedPoints.Points},
+		}}
+	}
+
+	if err := buildOrderItemWhereCondition(db.WriteDB(ctx), options).
+		Table(orderItem{}.TableName()).
+		Updates(_updates).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
+}
+
+type orderStatusHistory struct {
+	ID         int64             `gorm:"column:id"`
+	OrderID    string            `gorm:"column:order_id"`    // 關聯的 OrderID
+	FromStatus model.OrderStatus `gorm:"column:from_status"` // 變更前狀態
+	ToStatus   model.OrderStatus `gorm:"column:to_status"`   // 變更後狀態
+	OperatorID int64             `gorm:"column:operator_id"` // 操作者ID，0 為系統
+	Reason     string            `gorm:"column:reason"`      // 變更原因
+	CreatedAt  time.Time         `gorm:"column:created_at"`  // 變更時間
+}
+
+func (o orderStatusHistory) TableName() string {
+	return "order_status_history"
+}
+
+func (o *orderStatusHistory) ConvertToModel() *model.OrderStatusHistory {
+	return &model.OrderStatusHistory{
+		ID:         o.ID,
+		OrderID:    o.OrderID,
+		FromStatus: o.FromStatus,
+		ToStatus:   o.ToStatus,
+		OperatorID: o.OperatorID,
+		Reason:     o.Reason,
+		CreatedAt:  o.CreatedAt,
+	}
+}
+
+func buildOrderStatusHistoryWhereCondition(db *gorm.DB, options *query.OrderStatusHistoryOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.OrderIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.OrderIDIn))
+		for i := range options.OrderIDIn {
+			values = append(values, options.OrderIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "order_id",
+			Values: values,
+		})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// CreateOrderStatusHistory 新增訂單狀態變更紀錄
+func (db *database) CreateOrderStatusHistory(ctx context.Context, history *model.OrderStatusHistory) error {
+	var _history = &orderStatusHistory{
+		OrderID:    history.OrderID,
+		FromStatus: history.FromStatus,
+		ToStatus:   history.ToStatus,
+		OperatorID: history.OperatorID,
+		Reason:     history.Reason,
+	}
+
+	if err := db.WriteDB(ctx).Create(_history).Error; err != nil {
+		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	}
+
+	history.ID = _history.ID
+	history.CreatedAt = _history.CreatedAt
+
+	return nil
+}
+
+// ListOrderStatusHistories 取得訂單狀態變更紀錄，依時間排序
+func (db *database) ListOrderStatusHistories(ctx context.Context, options *query.OrderStatusHistoryOptions) ([]*model.OrderStatusHistory, error) {
+	var _histories = make([]*orderStatusHistory, 0)
+
+	if err := buildOrderStatusHistoryWhereCondition(db.ReadDB(ctx), options).
+		Order("id").
+		Find(&_histories).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mHistories = make([]*model.OrderStatusHistory, 0, len(_histories))
+	for i := range _histories {
+		mHistories = append(mHistories, _histories[i].ConvertToModel())
+	}
+
+	return mHistories, nil
+}
+
+// orderIdempotencyKey schema，(user_id, idempotency_key) 為 unique key
+type orderIdempotencyKey struct {
+	ID           int64     `gorm:"column:id"`
+	UserID       int64     `gorm:"column:user_id"`         // 用戶ID
+	Key          string    `gorm:"column:idempotency_key"` // 客戶端提供的冪等鍵
+	RequestHash  string    `gorm:"column:request_hash"`    // 請求內容的雜湊
+	OrderID      string    `gorm:"column:order_id"`        // 成功建立的訂單ID
+	ErrorCode    string    `gorm:"column:error_code"`      // 建立訂單失敗的錯誤代碼
+	ErrorMessage string    `gorm:"column:error_message"`   // 建立訂單失敗的錯誤訊息
+	CreatedAt    time.Time `gorm:"column:created_at"`      // 創建時間
+	UpdatedAt    time.Time `gorm:"column:updated_at"`      // 更新時間
+}
+
+func (o orderIdempotencyKey) TableName() string {
+	return "order_idempotency_keys"
+}
+
+func (o *orderIdempotencyKey) ConvertToModel() *model.OrderIdempotencyKey {
+	return &model.OrderIdempotencyKey{
+		ID:           o.ID,
+		UserID:       o.UserID,
+		Key:          o.Key,
+		RequestHash:  o.RequestHash,
+		OrderID:      o.OrderID,
+		ErrorCode:    o.ErrorCode,
+		ErrorMessage: o.ErrorMessage,
+		CreatedAt:    o.CreatedAt,
+		UpdatedAt:    o.UpdatedAt,
+	}
+}
+
+type orderIdempotencyKeyUpdates struct {
+	OrderID      *string `gorm:"column:order_id"`
+	ErrorCode    *string `gorm:"column:error_code"`
+	ErrorMessage *string `gorm:"column:error_message"`
+}
+
+func buildOrderIdempotencyKeyWhereCondition(db *gorm.DB, options *query.OrderIdempotencyKeyOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.IDIn) > 0 {
+		values := make([]interface{}, 0, len(options.IDIn))
+		for i := range options.IDIn {
+			values = append(values, options.IDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "id",
+			Values: values,
+		})
+	}
+
+	if len(options.UserIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.UserIDIn))
+		for i := range options.UserIDIn {
+			values = append(values, options.UserIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "user_id",
+			Values: values,
+		})
+	}
+
+	if len(options.KeyIn) > 0 {
+		values := make([]interface{}, 0, len(options.KeyIn))
+		for i := range options.KeyIn {
+			values = append(values, options.KeyIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "idempotency_key",
+			Values: values,
+		})
+	}
+
+	if options.Processing {
+		clauses = append(clauses, clause.Eq{
+			Column: "order_id",
+			Value:  "",
+		}, clause.Eq{
+			Column: "error_code",
+			Value:  "",
+		})
+	}
+
+	if options.UpdatedAtLt != nil {
+		clauses = append(clauses, clause.Lt{
+			Column: "updated_at",
+			Value:  options.UpdatedAtLt,
+		})
+	}
+
+	if options.Lock {
+		clauses = append(clauses, clause.Locking{Strength: "UPDATE"})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// CreateOrderIdempotencyKey 新增冪等紀錄，(UserID, Key) 重複時返回 errors.ErrResourceAlreadyExists
+func (db *database) CreateOrderIdempotencyKey(ctx context.Context, key *model.OrderIdempotencyKey) error {
+	var _key = &orderIdempotencyKey{
+		UserID:      key.UserID,
+		Key:         key.Key,
+		RequestHash: key.RequestHash,
+	}
+
+	if err := db.WriteDB(ctx).Create(_key).Error; err != nil {
+		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	}
+
+	key.ID = _key.ID
+	key.CreatedAt = _key.CreatedAt
+	key.UpdatedAt = _key.UpdatedAt
+
+	return nil
+}
+
+// GetOrderIdempotencyKey 取得冪等紀錄，找不到時返回 errors.ErrResourceNotFound
+func (db *database) GetOrderIdempotencyKey(ctx context.Context, options *query.OrderIdempotencyKeyOptions) (*model.OrderIdempotencyKey, error) {
+	var _key = &orderIdempotencyKey{}
+
+	if err := buildOrderIdempotencyKeyWhereCondition(db.ReadDB(ctx), options).First(_key).Error; err != nil {
+		return nil, errors.Wrapf(notFoundOrInternalError(err), "%+v", err)
+	}
+
+	return _key.ConvertToModel(), nil
+}
+
+// UpdateOrderIdempotencyKey 更新冪等紀錄的結果
+func (db *database) UpdateOrderIdempotencyKey(ctx context.Context, options *query.OrderIdempotencyKeyOptions, updates *updates.OrderIdempotencyKey) error {
+	var _updates = &orderIdempotencyKeyUpdates{
+		OrderID:      updates.OrderID,
+		ErrorCode:    updates.ErrorCode,
+		ErrorMessage: updates.ErrorMessage,
+	}
+
+	if err := buildOrderIdempotencyKeyWhereCondition(db.WriteDB(ctx), options).
+		Table(orderIdempotencyKey{}.TableName()).
+		Updates(_updates).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
+}
+
+// DeleteOrderIdempotencyKey 刪除冪等紀錄
+func (db *database) DeleteOrderIdempotencyKey(ctx context.Context, options *query.OrderIdempotencyKeyOptions) error {
+	if err := buildOrderIdempotencyKeyWhereCondition(db.WriteDB(ctx), options).
+		Delete(&orderIdempotencyKey{}).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
 }
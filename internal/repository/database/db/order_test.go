@@ -2,9 +2,14 @@ package db
 
 import (
 	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
 	iDB "cashier/internal/repository/database"
 	"context"
+	"log"
 	"testing"
+	"time"
 
 	"github.com/rs/xid"
 	"github.com/shopspring/decimal"
@@ -42,10 +47,27 @@ func (s *OrderSuite) TestCreateOrder() {
 	_order := &model.Order{
 		ID:            xid.New().String(),
 		UserID:        12345678,
+		Status:        model.OrderStatusPaid,
 		OriginalPrice: decimal.NewFromInt32(100),
 		FinalPrice:    decimal.NewFromInt32(85),
 		UsedPoints:    5,
 		PromotionIDs:  []int64{111, 222},
+		PriceBreakdown: []*model.PriceStep{
+			{
+				PromotionID:   111,
+				PromotionType: model.PromotionTypeMember,
+				BeforePrice:   decimal.NewFromInt32(100),
+				AfterPrice:    decimal.NewFromInt32(90),
+				SavedAmount:   decimal.NewFromInt32(10),
+			},
+			{
+				PromotionID:   222,
+				PromotionType: model.PromotionTypePoint,
+				BeforePrice:   decimal.NewFromInt32(90),
+				AfterPrice:    decimal.NewFromInt32(85),
+				SavedAmount:   decimal.NewFromInt32(5),
+			},
+		},
 		Items: []*model.OrderItem{
 			{
 				OrderID:   orderID,
@@ -66,4 +88,117 @@ func (s *OrderSuite) TestCreateOrder() {
 
 	err := s.repo.CreateOrder(s.ctx, _order)
 	s.Require().NoError(err)
+
+	status := model.OrderStatusCancelled
+	err = s.repo.UpdateOrder(s.ctx,
+		&query.OrderOptions{IDIn: []string{_order.ID}},
+		&updates.Order{Status: &status},
+	)
+	s.Require().NoError(err)
+
+	mOrder, err := s.repo.GetOrder(s.ctx, &query.OrderOptions{
+		IDIn:      []string{_order.ID},
+		WithItems: true,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(model.OrderStatusCancelled, mOrder.Status)
+	s.Require().Len(mOrder.Items, len(_order.Items))
+	s.Require().Len(mOrder.PriceBreakdown, len(_order.PriceBreakdown))
+}
+
+func (s *OrderSuite) TestUpdateOrderItem() {
+	err := s.repo.UpdateOrderItem(s.ctx,
+		&query.OrderItemOptions{IDIn: []int64{1}},
+		&updates.OrderItem{
+			RefundedQuantity: &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: 1},
+			RefundedToken:    &model.TokenOperation{Operation: model.NumericOperationAdd, Token: decimal.NewFromInt32(42)},
+			RefundedPoints:   &model.PointOperation{Operation: model.NumericOperationAdd, Points: 2},
+		},
+	)
+	s.Require().NoError(err)
+}
+
+func (s *OrderSuite) TestUpdateOrderWithoutOptions() {
+	status := model.OrderStatusCancelled
+	err := s.repo.UpdateOrder(s.ctx, &query.OrderOptions{}, &updates.Order{Status: &status})
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+}
+
+func (s *OrderSuite) TestUpdateOrderItemWithoutOptions() {
+	err := s.repo.UpdateOrderItem(s.ctx, &query.OrderItemOptions{}, &updates.OrderItem{RefundedQuantity: &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: 1}})
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+}
+
+func (s *OrderSuite) TestOrderStatusHistory() {
+	orderID := xid.New().String()
+	err := s.repo.CreateOrderStatusHistory(s.ctx, &model.OrderStatusHistory{
+		OrderID:    orderID,
+		FromStatus: model.OrderStatusPaid,
+		ToStatus:   model.OrderStatusCancelled,
+		OperatorID: 9527,
+		Reason:     "customer request",
+	})
+	s.Require().NoError(err)
+
+	histories, err := s.repo.ListOrderStatusHistories(s.ctx, &query.OrderStatusHistoryOptions{
+		OrderIDIn: []string{orderID},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(histories, 1)
+	s.Require().Equal(model.OrderStatusCancelled, histories[0].ToStatus)
+}
+
+func (s *OrderSuite) TestListOrders() {
+	createdAtGte := time.Now().Add(-24 * time.Hour)
+	orders, err := s.repo.ListOrders(s.ctx, &query.OrderOptions{
+		UserIDIn:     []int64{12345678},
+		StatusIn:     []model.OrderStatus{model.OrderStatusPaid, model.OrderStatusCancelled},
+		CreatedAtGte: &createdAtGte,
+		PromotionID:  111,
+		Limit:        10,
+		WithItems:    true,
+	})
+	s.Require().NoError(err)
+	for i := range orders {
+		log.Printf("order: %+v", orders[i])
+	}
+}
+
+func (s *OrderSuite) TestOrderIdempotencyKey() {
+	key := &model.OrderIdempotencyKey{
+		UserID:      12345678,
+		Key:         xid.New().String(),
+		RequestHash: "hash",
+	}
+	err := s.repo.CreateOrderIdempotencyKey(s.ctx, key)
+	s.Require().NoError(err)
+
+	err = s.repo.CreateOrderIdempotencyKey(s.ctx, key)
+	s.Require().ErrorIs(err, errors.ErrResourceAlreadyExists)
+
+	options := &query.OrderIdempotencyKeyOptions{
+		UserIDIn: []int64{key.UserID},
+		KeyIn:    []string{key.Key},
+	}
+	// 處理中且逾時的紀錄
+	staleBefore := time.Now().Add(time.Hour)
+	stale, err := s.repo.GetOrderIdempotencyKey(s.ctx, &query.OrderIdempotencyKeyOptions{
+		IDIn:        []int64{key.ID},
+		Processing:  true,
+		UpdatedAtLt: &staleBefore,
+		Lock:        true,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(key.ID, stale.ID)
+
+	orderID := xid.New().String()
+	err = s.repo.UpdateOrderIdempotencyKey(s.ctx, options, &updates.OrderIdempotencyKey{OrderID: &orderID})
+	s.Require().NoError(err)
+
+	stored, err := s.repo.GetOrderIdempotencyKey(s.ctx, options)
+	s.Require().NoError(err)
+	s.Require().Equal(orderID, stored.OrderID)
+
+	err = s.repo.DeleteOrderIdempotencyKey(s.ctx, options)
+	s.Require().NoError(err)
 }
@@ -2,13 +2,16 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"cashier/internal/model"
 	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
 	"cashier/internal/pkg/errors"
 
 	"github.com/shopspring/decimal"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -21,6 +24,8 @@ type product struct {
 	Price             decimal.Decimal     `gorm:"column:price"`              // 價格(單位：平台幣)
 	Quantity          int32               `gorm:"column:quantity"`           // 總數量
 	InventoryQuantity int32               `gorm:"column:inventory_quantity"` // 庫存數量
+	CategoryID        int64               `gorm:"column:category_id"`        // 商品分類ID
+	Tags              datatypes.JSON      `gorm:"column:tags"`               // 商品標籤
 	CreatedAt         time.Time           `gorm:"column:created_at"`         // 創建時間
 	UpdatedAt         time.Time           `gorm:"column:updated_at"`         // 更新時間
 
@@ -31,24 +36,44 @@ func (p product) TableName() string {
 	return "products"
 }
 
-func (p *product) ConvertToModel() *model.Product {
-	return &model.Product{
-		ID:        p.ID,
-		Name:      p.Name,
-		Status:    p.Status,
-		Price:     p.Price,
-		CreatedAt: p.CreatedAt,
-		UpdatedAt: p.UpdatedAt,
+func (p *product) ConvertToModel() (*model.Product, error) {
+	mp := &model.Product{
+		ID:         p.ID,
+		Name:       p.Name,
+		Status:     p.Status,
+		Price:      p.Price,
+		CategoryID: p.CategoryID,
+		Tags:       make([]string, 0),
+		CreatedAt:  p.CreatedAt,
+		UpdatedAt:  p.UpdatedAt,
+	}
 
-		Inventory: p.Inventory.ConvertToModel(),
+	if len(p.Tags) > 0 {
+		if err := json.Unmarshal(p.Tags, &mp.Tags); err != nil {
+			return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
 	}
+
+	// 未查詢 Inventory 時為 nil
+	if p.Inventory != nil {
+		mp.Inventory = p.Inventory.ConvertToModel()
+	}
+
+	return mp, nil
 }
 
 type productUpdates struct {
-	Name      *string              `gorm:"column:name"`       // 商品名稱
-	Status    *model.ProductStatus `gorm:"column:status"`     // 商品上下架狀態
-	Price     *decimal.Decimal     `gorm:"column:price"`      // 價格(單位：平台幣)
-	UpdatedAt *time.Time           `gorm:"column:updated_at"` // 更新時間
+	Name       *string              `gorm:"column:name"`        // 商品名稱
+	Status     *model.ProductStatus `gorm:"column:status"`      // 商品上下架狀態
+	Price      *decimal.Decimal     `gorm:"column:price"`       // 價格(單位：平台幣)
+	CategoryID *int64               `gorm:"column:category_id"` // 商品分類ID
+	Tags       datatypes.JSON       `gorm:"column:tags"`        // 商品標籤
+	UpdatedAt  *time.Time           `gorm:"column:updated_at"`  // 更新時間
+}
+
+// productColumn 返回帶有資料表名稱的欄位，避免 join inventories 時欄位名稱重複
+func productColumn(name string) clause.Column {
+	return clause.Column{Table: product{}.TableName(), Name: name}
 }
 
 func buildProductWhereCondition(db *gorm.DB, options *query.ProductOptions) *gorm.DB {
@@ -60,11 +85,71 @@ func buildProductWhereCondition(db *gorm.DB, options *query.ProductOptions) *gor
 			values = append(values, options.IDIn[i])
 		}
 		clauses = append(clauses, clause.IN{
-			Column: "id",
+			Column: productColumn("id"),
+			Values: values,
+		})
+	}
+
+	if options.NameContains != "" {
+		clauses = append(clauses, clause.Like{
+			Column: productColumn("name"),
+			Value:  "%" + likeEscaper.Replace(options.NameContains) + "%",
+		})
+	}
+
+	if len(options.StatusIn) > 0 {
+		values := make([]interface{}, 0, len(options.StatusIn))
+		for i := range options.StatusIn {
+			values = append(values, options.StatusIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: productColumn("status"),
 			Values: values,
 		})
 	}
 
+	if options.PriceGte != nil {
+		clauses = append(clauses, clause.Gte{
+			Column: productColumn("price"),
+			Value:  options.PriceGte,
+		})
+	}
+
+	if options.PriceLte != nil {
+		clauses = append(clauses, clause.Lte{
+			Column: productColumn("price"),
+			Value:  options.PriceLte,
+		})
+	}
+
+	if len(options.CategoryIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.CategoryIDIn))
+		for i := range options.CategoryIDIn {
+			values = append(values, options.CategoryIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: productColumn("category_id"),
+			Values: values,
+		})
+	}
+
+	if options.Tag != "" {
+		tag, _ := json.Marshal(options.Tag)
+		clauses = append(clauses, clause.Expr{
+			SQL:  "JSON_CONTAINS(products.tags, ?)",
+			Vars: []interface{}{string(tag)},
+		})
+	}
+
+	if options.InStock {
+		db = db.Select(product{}.TableName() + ".*").
+			Joins("JOIN inventories ON inventories.product_id = products.id")
+		clauses = append(clauses, clause.Gt{
+			Column: clause.Column{Table: inventory{}.TableName(), Name: "available_quantity"},
+			Value:  0,
+		})
+	}
+
 	if options.Lock {
 		var lockingOption string
 		if options.LockNoWait {
@@ -82,17 +167,141 @@ func buildProductWhereCondition(db *gorm.DB, options *query.ProductOptions) *gor
 	return db
 }
 
+// buildProductPagination 依 options.Sort 排序，並從 options.Cursor 之後開始查詢
+func buildProductPagination(db *gorm.DB, options *query.ProductOptions) (*gorm.DB, error) {
+	var cursor *query.ProductCursor
+	if options.Cursor != "" {
+		var err error
+		if cursor, err = query.DecodeProductCursor(options.Cursor); err != nil {
+			return nil, errors.Wrapf(errors.ErrInvalidInput, "invalid cursor %q: %+v", options.Cursor, err)
+		}
+	}
+
+	switch options.Sort {
+	case query.ProductSortPriceAsc:
+		db = db.Order("products.price, products.id")
+		if cursor != nil {
+			db = db.Where("(products.price, products.id) > (?, ?)", cursor.Price, cursor.ID)
+		}
+	case query.ProductSortPriceDesc:
+		db = db.Order("products.price DESC, products.id DESC")
+		if cursor != nil {
+			db = db.Where("(products.price, products.id) < (?, ?)", cursor.Price, cursor.ID)
+		}
+	case query.ProductSortCreatedAtDesc:
+		db = db.Order("products.created_at DESC, products.id DESC")
+		if cursor != nil {
+			db = db.Where("(products.created_at, products.id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+	default:
+		db = db.Order("products.id")
+		if cursor != nil {
+			db = db.Where("products.id > ?", cursor.ID)
+		}
+	}
+
+	if options.Limit > 0 {
+		db = db.Limit(options.Limit)
+	}
+
+	return db, nil
+}
+
+// ListProducts 依條件取得多筆商品，依 options.Sort 排序
 func (db *database) ListProducts(ctx context.Context, options *query.ProductOptions) ([]*model.Product, error) {
 	var products = make([]*product, 0)
 
-	if err := buildProductWhereCondition(db.ReadDB(ctx), options).Find(&products).Error; err != nil {
+	tx, err := buildProductPagination(buildProductWhereCondition(db.ReadDB(ctx), options), options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Find(&products).Error; err != nil {
 		return nil, errors.Wrapf(notFoundOrInternalError(err), "%+v", err)
 	}
 
 	var mProducts = make([]*model.Product, 0, len(products))
 	for i := range products {
-		mProducts = append(mProducts, products[i].ConvertToModel())
+		mProduct, err := products[i].ConvertToModel()
+		if err != nil {
+			return nil, err
+		}
+		mProducts = append(mProducts, mProduct)
 	}
 
 	return mProducts, nil
 }
+
+// GetProduct 取得單筆商品，找不到時返回 errors.ErrResourceNotFound
+func (db *database) GetProduct(ctx context.Context, options *query.ProductOptions) (*model.Product, error) {
+	var _product = &product{}
+
+	if err := buildProductWhereCondition(db.ReadDB(ctx), options).First(_product).Error; err != nil {
+		return nil, errors.Wrapf(notFoundOrInternalError(err), "%+v", err)
+	}
+
+	return _product.ConvertToModel()
+}
+
+// CreateProduct 建立商品，並同時建立數量為 0 的庫存
+func (db *database) CreateProduct(ctx context.Context, mProduct *model.Product) (err error) {
+	var _product = &product{
+		Name:       mProduct.Name,
+		Status:     mProduct.Status,
+		Price:      mProduct.Price,
+		CategoryID: mProduct.CategoryID,
+		Inventory:  &inventory{},
+	}
+
+	if mProduct.Tags == nil {
+		mProduct.Tags = make([]string, 0)
+	}
+	_product.Tags, err = json.Marshal(mProduct.Tags)
+	if err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	if err := db.WriteDB(ctx).Create(_product).Error; err != nil {
+		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	}
+
+	mProduct.ID = _product.ID
+	mProduct.CreatedAt = _product.CreatedAt
+	mProduct.UpdatedAt = _product.UpdatedAt
+	mProduct.Inventory = _product.Inventory.ConvertToModel()
+
+	return nil
+}
+
+// UpdateProduct 更新商品
+func (db *database) UpdateProduct(ctx context.Context, options *query.ProductOptions, updates *updates.Product) error {
+	// 沒有條件時會更新所有商品
+	if len(options.IDIn) == 0 && len(options.CategoryIDIn) == 0 && len(options.StatusIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "product id, category id or status is required")
+	}
+
+	var now = time.Now().UTC()
+	var _updates = &productUpdates{
+		Name:       updates.Name,
+		Status:     updates.Status,
+		Price:      updates.Price,
+		CategoryID: updates.CategoryID,
+		UpdatedAt:  &now,
+	}
+
+	if updates.Tags != nil {
+		tags, err := json.Marshal(*updates.Tags)
+		if err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+		_updates.Tags = tags
+	}
+
+	if err := buildProductWhereCondition(db.WriteDB(ctx), options).
+		Table(product{}.TableName()).
+		Updates(_updates).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
+}
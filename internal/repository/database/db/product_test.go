@@ -5,9 +5,13 @@ import (
 	"log"
 	"testing"
 
+	"cashier/internal/model"
 	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
 	iDB "cashier/internal/repository/database"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -48,3 +52,60 @@ func (s *ProductSuite) TestListProducts() {
 		log.Printf("Inventory: %+v", products[i].Inventory)
 	}
 }
+
+func (s *ProductSuite) TestCreateAndUpdateProduct() {
+	product := &model.Product{
+		Name:   "test product",
+		Status: model.ProductStatusDown,
+		Price:  decimal.NewFromInt(100),
+	}
+	err := s.repo.CreateProduct(s.ctx, product)
+	s.Require().NoError(err)
+	s.Require().NotNil(product.Inventory)
+
+	status := model.ProductStatusOn
+	err = s.repo.UpdateProduct(s.ctx,
+		&query.ProductOptions{IDIn: []int64{product.ID}},
+		&updates.Product{Status: &status},
+	)
+	s.Require().NoError(err)
+
+	got, err := s.repo.GetProduct(s.ctx, &query.ProductOptions{
+		IDIn:          []int64{product.ID},
+		WithInventory: true,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(status, got.Status)
+}
+
+func (s *ProductSuite) TestUpdateProductWithoutOptions() {
+	status := model.ProductStatusDown
+	err := s.repo.UpdateProduct(s.ctx, &query.ProductOptions{}, &updates.Product{Status: &status})
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+}
+
+func (s *ProductSuite) TestListProductsWithFilters() {
+	priceGte := decimal.NewFromInt(10)
+	priceLte := decimal.NewFromInt(1000)
+	products, err := s.repo.ListProducts(s.ctx, &query.ProductOptions{
+		NameContains: "test_%",
+		StatusIn:     []model.ProductStatus{model.ProductStatusOn},
+		PriceGte:     &priceGte,
+		PriceLte:     &priceLte,
+		InStock:      true,
+		Sort:         query.ProductSortPriceDesc,
+		Limit:        2,
+	})
+	s.Require().NoError(err)
+	if len(products) == 0 {
+		return
+	}
+
+	_, err = s.repo.ListProducts(s.ctx, &query.ProductOptions{
+		InStock: true,
+		Sort:    query.ProductSortPriceDesc,
+		Cursor:  query.NewProductCursor(products[len(products)-1]).Encode(),
+		Limit:   2,
+	})
+	s.Require().NoError(err)
+}
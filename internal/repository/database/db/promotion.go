@@ -2,12 +2,16 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"cashier/internal/model"
 	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
 	"cashier/internal/pkg/errors"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -21,10 +25,27 @@ type promotion struct {
 	Type        model.PromotionType `gorm:"column:type"`        // 活動類型
 	Extension   datatypes.JSON      `gorm:"column:extension"`   // 活動內容
 	IsDefault   bool                `gorm:"column:is_default"`  // 是否為預設活動
+	CouponOnly  bool                `gorm:"column:coupon_only"` // 只能透過優惠碼使用
 	StartAt     time.Time           `gorm:"column:start_at"`    // 活動開始時間
 	EndAt       time.Time           `gorm:"column:end_at"`      // 活動結束時間
 	CreatedAt   time.Time           `gorm:"column:created_at"`  // 創建時間
 	UpdatedAt   time.Time           `gorm:"column:updated_at"`  // 更新時間
+
+	MaxRedemptions int32           `gorm:"column:max_redemptions"` // 總共可使用次數，0 為不限制
+	MaxPerUser     int32           `gorm:"column:max_per_user"`    // 每個用戶可使用次數，0 為不限制
+	Budget         decimal.Decimal `gorm:"column:budget"`          // 總共可折抵的平台幣，0 為不限制
+	RedeemedCount  int32           `gorm:"column:redeemed_count"`  // 已使用次數
+	UsedBudget     decimal.Decimal `gorm:"column:used_budget"`     // 已折抵的平台幣
+
+	Priority   int32  `gorm:"column:priority"`    // 優先順序，越大越先計算
+	Exclusive  bool   `gorm:"column:exclusive"`   // 是否為獨佔活動
+	StackGroup string `gorm:"column:stack_group"` // 疊加群組
+
+	Timezone  string         `gorm:"column:timezone"`  // IANA 時區
+	Schedules datatypes.JSON `gorm:"column:schedules"` // 重複時段
+
+	Status  model.PromotionStatus `gorm:"column:status"`  // 活動狀態
+	Version int32                 `gorm:"column:version"` // 目前活動內容的版本
 }
 
 func (p promotion) TableName() string {
@@ -32,11 +53,23 @@ func (p promotion) TableName() string {
 }
 
 func newPromotion(mPromotion *model.Promotion) (*promotion, error) {
+	if err := mPromotion.Validate(); err != nil {
+		return nil, err
+	}
+
 	extB, err := mPromotion.ToExtByte()
 	if err != nil {
 		return nil, err
 	}
 
+	if mPromotion.Schedules == nil {
+		mPromotion.Schedules = make([]*model.PromotionSchedule, 0)
+	}
+	schedulesB, err := json.Marshal(mPromotion.Schedules)
+	if err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
 	return &promotion{
 		ID:          mPromotion.ID,
 		Name:        mPromotion.Name,
@@ -44,8 +77,23 @@ func newPromotion(mPromotion *model.Promotion) (*promotion, error) {
 		Type:        mPromotion.Type,
 		Extension:   extB,
 		IsDefault:   mPromotion.IsDefault,
+		CouponOnly:  mPromotion.CouponOnly,
 		StartAt:     mPromotion.StartAt,
 		EndAt:       mPromotion.EndAt,
+
+		MaxRedemptions: mPromotion.MaxRedemptions,
+		MaxPerUser:     mPromotion.MaxPerUser,
+		Budget:         mPromotion.Budget,
+
+		Priority:   mPromotion.Priority,
+		Exclusive:  mPromotion.Exclusive,
+		StackGroup: mPromotion.StackGroup,
+
+		Timezone:  mPromotion.Timezone,
+		Schedules: schedulesB,
+
+		Status:  mPromotion.Status,
+		Version: mPromotion.Version,
 	}, nil
 }
 
@@ -56,11 +104,38 @@ func (p *promotion) ConvertToModel() (mp *model.Promotion, err error) {
 		Description: p.Description,
 		Type:        p.Type,
 		IsDefault:   p.IsDefault,
+		CouponOnly:  p.CouponOnly,
 		StartAt:     p.StartAt,
 		EndAt:       p.EndAt,
 		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+
+		MaxRedemptions: p.MaxRedemptions,
+		MaxPerUser:     p.MaxPerUser,
+		Budget:         p.Budget,
+		RedeemedCount:  p.RedeemedCount,
+		UsedBudget:     p.UsedBudget,
+
+		Priority:   p.Priority,
+		Exclusive:  p.Exclusive,
+		StackGroup: p.StackGroup,
+
+		Timezone:  p.Timezone,
+		Schedules: make([]*model.PromotionSchedule, 0),
+
+		Status:  p.Status,
+		Version: p.Version,
+	}
+
+	if len(p.Schedules) > 0 {
+		if err := json.Unmarshal(p.Schedules, &mp.Schedules); err != nil {
+			return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
 	}
 
+	// 只載入一次時區，無效的時區在 IsActive 時視為不在時段內
+	_ = mp.LoadLocation()
+
 	mp.Extension, err = mp.FromExtByteTo(p.Extension)
 	return
 }
@@ -97,28 +172,87 @@ func buildPromotionWhereCondition(db *gorm.DB, options *query.PromotionOptions)
 		})
 	}
 
+	if options.StartAtLte != nil {
+		clauses = append(clauses, clause.Lte{
+			Column: "start_at",
+			Value:  options.StartAtLte,
+		})
+	}
+
+	if options.EndAtGt != nil {
+		clauses = append(clauses, clause.Gt{
+			Column: "end_at",
+			Value:  options.EndAtGt,
+		})
+	}
+
 	if options.EndAtLt != nil {
-		clauses = append(clauses, clause.Gte{
+		clauses = append(clauses, clause.Lt{
 			Column: "end_at",
 			Value:  options.EndAtLt,
 		})
 	}
 
+	if options.CouponOnly != nil {
+		clauses = append(clauses, clause.Eq{
+			Column: "coupon_only",
+			Value:  *options.CouponOnly,
+		})
+	}
+
+	if len(options.StatusIn) > 0 {
+		values := make([]interface{}, 0, len(options.StatusIn))
+		for i := range options.StatusIn {
+			values = append(values, options.StatusIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "status",
+			Values: values,
+		})
+	}
+
+	if options.Lock {
+		clauses = append(clauses, clause.Locking{Strength: "UPDATE"})
+	}
+
 	db = db.Clauses(clauses...)
 
 	return db
 }
 
+// CreatePromotion 建立優惠活動，並將活動內容紀錄為第一個版本
 func (db *database) CreatePromotion(ctx context.Context, mPromotion *model.Promotion) error {
+	mPromotion.Version = 1
 	_promotion, err := newPromotion(mPromotion)
 	if err != nil {
 		return err
 	}
 
-	if err := db.WriteDB(ctx).Create(_promotion).Error; err != nil {
-		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	// 已在 transaction 內時 gorm 會使用 savepoint
+	err = db.WriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(_promotion).Error; err != nil {
+			return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+		}
+
+		if err := tx.Create(&promotionVersion{
+			PromotionID: _promotion.ID,
+			Version:     _promotion.Version,
+			Type:        _promotion.Type,
+			Extension:   _promotion.Extension,
+		}).Error; err != nil {
+			return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
+	mPromotion.ID = _promotion.ID
+	mPromotion.CreatedAt = _promotion.CreatedAt
+	mPromotion.UpdatedAt = _promotion.UpdatedAt
+
 	return nil
 }
 
@@ -139,3 +273,360 @@ func (db *database) ListPromotions(ctx context.Context, options *query.Promotion
 
 	return mPromotions, nil
 }
+
+type promotionUpdates struct {
+	Name           *string                `gorm:"column:name"`
+	Description    *string                `gorm:"column:description"`
+	Extension      datatypes.JSON         `gorm:"column:extension"`
+	Version        *gormExpr              `gorm:"column:version"`
+	Status         *model.PromotionStatus `gorm:"column:status"`
+	StartAt        *time.Time             `gorm:"column:start_at"`
+	EndAt          *time.Time             `gorm:"column:end_at"`
+	CouponOnly     *bool                  `gorm:"column:coupon_only"`
+	MaxRedemptions *int32                 `gorm:"column:max_redemptions"`
+	MaxPerUser     *int32                 `gorm:"column:max_per_user"`
+	Budget         *decimal.Decimal       `gorm:"column:budget"`
+	Priority       *int32                 `gorm:"column:priority"`
+	Exclusive      *bool                  `gorm:"column:exclusive"`
+	StackGroup     *string                `gorm:"column:stack_group"`
+	Timezone       *string                `gorm:"column:timezone"`
+	Schedules      datatypes.JSON         `gorm:"column:schedules"`
+	UpdatedAt      *time.Time             `gorm:"column:updated_at"`
+	RedeemedCount  *gormExpr              `gorm:"column:redeemed_count"`
+	UsedBudget     *gormExpr              `gorm:"column:used_budget"`
+}
+
+// pricingChanged 是否異動會影響訂單金額計算的欄位，異動時需建立新的版本
+func pricingChanged(updates *updates.Promotion) bool {
+	return updates.Extension != nil ||
+		updates.CouponOnly != nil ||
+		updates.Priority != nil ||
+		updates.Exclusive != nil ||
+		updates.StackGroup != nil ||
+		updates.Timezone != nil ||
+		updates.Schedules != nil
+}
+
+// UpdatePromotion 更新優惠活動
+// 異動 Extension、疊加規則或重複時段時，為每個異動的活動增加版本並寫入一筆 promotion_versions
+func (db *database) UpdatePromotion(ctx context.Context, options *query.PromotionOptions, updates *updates.Promotion) error {
+	// 沒有條件時會更新所有活動
+	if len(options.IDIn) == 0 && len(options.TypeIn) == 0 && len(options.StatusIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "promotion id, type or status is required")
+	}
+
+	now := time.Now().UTC()
+	var _updates = &promotionUpdates{
+		Name:        updates.Name,
+		Description: updates.Description,
+		Status:      updates.Status,
+		StartAt:     updates.StartAt,
+		EndAt:       updates.EndAt,
+		CouponOnly:  updates.CouponOnly,
+		UpdatedAt:   &now,
+
+		MaxRedemptions: updates.MaxRedemptions,
+		MaxPerUser:     updates.MaxPerUser,
+		Budget:         updates.Budget,
+
+		Priority:   updates.Priority,
+		Exclusive:  updates.Exclusive,
+		StackGroup: updates.StackGroup,
+		Timezone:   updates.Timezone,
+	}
+
+	if updates.Schedules != nil {
+		schedules := *updates.Schedules
+		if schedules == nil {
+			schedules = make([]*model.PromotionSchedule, 0)
+		}
+		schedulesB, err := json.Marshal(schedules)
+		if err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+		_updates.Schedules = schedulesB
+	}
+
+	if updates.RedeemedCount != nil {
+		_updates.RedeemedCount = &gormExpr{clause.Expr{
+			SQL:  fmt.Sprintf("%s %s ?", "redeemed_count", updates.RedeemedCount.Operation.Sql()),
+			Vars: []interface{}{updates.RedeemedCount.Quantity},
+		}}
+	}
+
+	if updates.UsedBudget != nil {
+		_updates.UsedBudget = &gormExpr{clause.Expr{
+			SQL:  fmt.Sprintf("%s %s ?", "used_budget", updates.UsedBudget.Operation.Sql()),
+			Vars: []interface{}{updates.UsedBudget.Token},
+		}}
+	}
+
+	if !pricingChanged(updates) {
+		if err := buildPromotionWhereCondition(db.WriteDB(ctx), options).
+			Table(promotion{}.TableName()).
+			Updates(_updates).Error; err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+
+		return nil
+	}
+
+	// 沒有異動 Extension 時，新的版本沿用目前的活動內容
+	var extB datatypes.JSON
+	if updates.Extension != nil {
+		if err := updates.Extension.Validate(); err != nil {
+			return err
+		}
+		var err error
+		if extB, err = (&model.Promotion{Extension: updates.Extension}).ToExtByte(); err != nil {
+			return err
+		}
+		_updates.Extension = extB
+	}
+	_updates.Version = &gormExpr{clause.Expr{SQL: "version + 1"}}
+
+	// 已在 transaction 內時 gorm 會使用 savepoint
+	return db.WriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		// 鎖定要異動的活動
+		lockOptions := *options
+		lockOptions.Lock = true
+		var _promotions = make([]*promotion, 0)
+		if err := buildPromotionWhereCondition(tx, &lockOptions).Find(&_promotions).Error; err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+		if len(_promotions) == 0 {
+			return errors.Wrapf(errors.ErrResourceNotFound, "promotion not found, options: %+v", options)
+		}
+
+		var (
+			promotionIDs = make([]int64, 0, len(_promotions))
+			_versions    = make([]*promotionVersion, 0, len(_promotions))
+		)
+		for i := range _promotions {
+			ext := extB
+			if ext == nil {
+				ext = _promotions[i].Extension
+			}
+
+			promotionIDs = append(promotionIDs, _promotions[i].ID)
+			_versions = append(_versions, &promotionVersion{
+				PromotionID: _promotions[i].ID,
+				Version:     _promotions[i].Version + 1,
+				Type:        _promotions[i].Type,
+				Extension:   ext,
+				OperatorID:  updates.OperatorID,
+			})
+		}
+
+		if err := buildPromotionWhereCondition(tx, &query.PromotionOptions{IDIn: promotionIDs}).
+			Table(promotion{}.TableName()).
+			Updates(_updates).Error; err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+
+		if err := tx.Create(&_versions).Error; err != nil {
+			return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+		}
+
+		return nil
+	})
+}
+
+// promotionVersion schema，只新增不修改，(promotion_id, version) 為 unique key
+type promotionVersion struct {
+	ID          int64               `gorm:"column:id"`
+	PromotionID int64               `gorm:"column:promotion_id"` // 關聯 promotions.id
+	Version     int32               `gorm:"column:version"`      // 版本
+	Type        model.PromotionType `gorm:"column:type"`         // 活動類型
+	Extension   datatypes.JSON      `gorm:"column:extension"`    // 這個版本的活動內容
+	OperatorID  int64               `gorm:"column:operator_id"`  // 操作者ID
+	CreatedAt   time.Time           `gorm:"column:created_at"`   // 創建時間
+}
+
+func (p promotionVersion) TableName() string {
+	return "promotion_versions"
+}
+
+func (p *promotionVersion) ConvertToModel() (mv *model.PromotionVersion, err error) {
+	mv = &model.PromotionVersion{
+		ID:          p.ID,
+		PromotionID: p.PromotionID,
+		Version:     p.Version,
+		Type:        p.Type,
+		OperatorID:  p.OperatorID,
+		CreatedAt:   p.CreatedAt,
+	}
+
+	mv.Extension, err = (&model.Promotion{Type: p.Type}).FromExtByteTo(p.Extension)
+	return
+}
+
+func buildPromotionVersionWhereCondition(db *gorm.DB, options *query.PromotionVersionOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.PromotionIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.PromotionIDIn))
+		for i := range options.PromotionIDIn {
+			values = append(values, options.PromotionIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "promotion_id",
+			Values: values,
+		})
+	}
+
+	if len(options.VersionIn) > 0 {
+		values := make([]interface{}, 0, len(options.VersionIn))
+		for i := range options.VersionIn {
+			values = append(values, options.VersionIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "version",
+			Values: values,
+		})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// ListPromotionVersions 取得活動內容的版本，依活動及版本排序
+func (db *database) ListPromotionVersions(ctx context.Context, options *query.PromotionVersionOptions) ([]*model.PromotionVersion, error) {
+	var _versions = make([]*promotionVersion, 0)
+
+	if err := buildPromotionVersionWhereCondition(db.ReadDB(ctx), options).
+		Order("promotion_id").
+		Order("version").
+		Find(&_versions).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mVersions = make([]*model.PromotionVersion, 0, len(_versions))
+	for i := range _versions {
+		mv, err := _versions[i].ConvertToModel()
+		if err != nil {
+			return nil, err
+		}
+		mVersions = append(mVersions, mv)
+	}
+
+	return mVersions, nil
+}
+
+type promotionRedemption struct {
+	ID             int64           `gorm:"column:id"`
+	PromotionID    int64           `gorm:"column:promotion_id"`    // 關聯 promotions.id
+	UserID         int64           `gorm:"column:user_id"`         // 用戶ID
+	OrderID        string          `gorm:"column:order_id"`        // 關聯的 OrderID
+	DiscountAmount decimal.Decimal `gorm:"column:discount_amount"` // 折抵的平台幣
+	CreatedAt      time.Time       `gorm:"column:created_at"`      // 創建時間
+}
+
+func (p promotionRedemption) TableName() string {
+	return "promotion_redemptions"
+}
+
+func (p *promotionRedemption) ConvertToModel() *model.PromotionRedemption {
+	return &model.PromotionRedemption{
+		ID:             p.ID,
+		PromotionID:    p.PromotionID,
+		UserID:         p.UserID,
+		OrderID:        p.OrderID,
+		DiscountAmount: p.DiscountAmount,
+		CreatedAt:      p.CreatedAt,
+	}
+}
+
+func buildPromotionRedemptionWhereCondition(db *gorm.DB, options *query.PromotionRedemptionOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.PromotionIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.PromotionIDIn))
+		for i := range options.PromotionIDIn {
+			values = append(values, options.PromotionIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "promotion_id",
+			Values: values,
+		})
+	}
+
+	if len(options.UserIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.UserIDIn))
+		for i := range options.UserIDIn {
+			values = append(values, options.UserIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "user_id",
+			Values: values,
+		})
+	}
+
+	if len(options.OrderIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.OrderIDIn))
+		for i := range options.OrderIDIn {
+			values = append(values, options.OrderIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "order_id",
+			Values: values,
+		})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// CreatePromotionRedemption 紀錄優惠活動使用
+func (db *database) CreatePromotionRedemption(ctx context.Context, redemption *model.PromotionRedemption) error {
+	var _redemption = &promotionRedemption{
+		PromotionID:    redemption.PromotionID,
+		UserID:         redemption.UserID,
+		OrderID:        redemption.OrderID,
+		DiscountAmount: redemption.DiscountAmount,
+	}
+
+	if err := db.WriteDB(ctx).Create(_redemption).Error; err != nil {
+		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	}
+
+	redemption.ID = _redemption.ID
+	redemption.CreatedAt = _redemption.CreatedAt
+
+	return nil
+}
+
+// ListPromotionRedemptions 取得優惠活動使用紀錄，依時間排序
+func (db *database) ListPromotionRedemptions(ctx context.Context, options *query.PromotionRedemptionOptions) ([]*model.PromotionRedemption, error) {
+	var _redemptions = make([]*promotionRedemption, 0)
+
+	if err := buildPromotionRedemptionWhereCondition(db.ReadDB(ctx), options).
+		Order("id").
+		Find(&_redemptions).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mRedemptions = make([]*model.PromotionRedemption, 0, len(_redemptions))
+	for i := range _redemptions {
+		mRedemptions = append(mRedemptions, _redemptions[i].ConvertToModel())
+	}
+
+	return mRedemptions, nil
+}
+
+// DeletePromotionRedemptions 刪除優惠活動使用紀錄，取消訂單或全額退款時歸還使用次數
+func (db *database) DeletePromotionRedemptions(ctx context.Context, options *query.PromotionRedemptionOptions) error {
+	// 沒有條件時會刪除所有紀錄
+	if len(options.PromotionIDIn) == 0 && len(options.UserIDIn) == 0 && len(options.OrderIDIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "delete promotion redemptions without options")
+	}
+
+	if err := buildPromotionRedemptionWhereCondition(db.WriteDB(ctx), options).
+		Delete(&promotionRedemption{}).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
+}
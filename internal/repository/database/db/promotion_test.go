@@ -8,6 +8,8 @@ import (
 
 	"cashier/internal/model"
 	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
 	iDB "cashier/internal/repository/database"
 
 	"github.com/shopspring/decimal"
@@ -92,3 +94,324 @@ func (s *PromotionSuite) TestCreatePromotion() {
 	err = s.repo.CreatePromotion(s.ctx, mpPoint)
 	s.Require().NoError(err)
 }
+
+func (s *PromotionSuite) TestCreateProductDiscountPromotion() {
+	mp := &model.Promotion{
+		Name:        "product discount",
+		Description: "product discount",
+		Type:        model.PromotionTypeProductDiscount,
+		Extension: &model.PromotionExtProductDiscount{
+			ProductIDs:     []int64{1, 2},
+			DiscountType:   model.DiscountTypeAmount,
+			DiscountAmount: decimal.NewFromInt(5),
+		},
+		StartAt: time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:   time.Now().Add(15 * 24 * time.Hour),
+	}
+
+	err := s.repo.CreatePromotion(s.ctx, mp)
+	s.Require().NoError(err)
+
+	mps, err := s.repo.ListPromotions(s.ctx, &query.PromotionOptions{IDIn: []int64{mp.ID}})
+	s.Require().NoError(err)
+	s.Require().Len(mps, 1)
+	s.Require().IsType(&model.PromotionExtProductDiscount{}, mps[0].Extension)
+}
+
+func (s *PromotionSuite) TestCreateBuyXGetYAndBundlePromotion() {
+	mpBuyXGetY := &model.Promotion{
+		Name:        "buy 2 get 1",
+		Description: "buy 2 get 1 free",
+		Type:        model.PromotionTypeBuyXGetY,
+		Extension: &model.PromotionExtBuyXGetY{
+			ProductIDs:   []int64{1, 2},
+			BuyQuantity:  2,
+			FreeQuantity: 1,
+		},
+		StartAt: time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:   time.Now().Add(15 * 24 * time.Hour),
+	}
+
+	err := s.repo.CreatePromotion(s.ctx, mpBuyXGetY)
+	s.Require().NoError(err)
+
+	mpBundle := &model.Promotion{
+		Name:        "A+B",
+		Description: "buy A+B together for 99",
+		Type:        model.PromotionTypeBundle,
+		Extension: &model.PromotionExtBundle{
+			Items: []*model.BundleItem{
+				{ProductID: 1, Quantity: 1},
+				{ProductID: 2, Quantity: 1},
+			},
+			BundlePrice: decimal.NewFromInt(99),
+		},
+		StartAt: time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:   time.Now().Add(15 * 24 * time.Hour),
+	}
+
+	err = s.repo.CreatePromotion(s.ctx, mpBundle)
+	s.Require().NoError(err)
+}
+
+func (s *PromotionSuite) TestCreateSpendTierPromotion() {
+	mp := &model.Promotion{
+		Name:        "spend tier",
+		Description: "spend 500 get 50 off, spend 1000 get 150 off",
+		Type:        model.PromotionTypeSpendTier,
+		Extension: &model.PromotionExtSpendTier{
+			Tiers: []*model.SpendTier{
+				{MinAmount: decimal.NewFromInt(500), DiscountType: model.DiscountTypeAmount, DiscountAmount: decimal.NewFromInt(50)},
+				{MinAmount: decimal.NewFromInt(1000), DiscountType: model.DiscountTypeAmount, DiscountAmount: decimal.NewFromInt(150)},
+			},
+		},
+		StartAt: time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:   time.Now().Add(15 * 24 * time.Hour),
+	}
+
+	err := s.repo.CreatePromotion(s.ctx, mp)
+	s.Require().NoError(err)
+}
+
+func (s *PromotionSuite) TestUpdatePromotionAndRedemptions() {
+	mp := &model.Promotion{
+		Name:        "limited",
+		Description: "first 100 orders, budget 1000",
+		Type:        model.PromotionTypeSpendTier,
+		Extension: &model.PromotionExtSpendTier{
+			Tiers: []*model.SpendTier{
+				{MinAmount: decimal.NewFromInt(100), DiscountType: model.DiscountTypeAmount, DiscountAmount: decimal.NewFromInt(10)},
+			},
+		},
+		StartAt:        time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:          time.Now().Add(15 * 24 * time.Hour),
+		MaxRedemptions: 100,
+		MaxPerUser:     1,
+		Budget:         decimal.NewFromInt(1000),
+	}
+
+	err := s.repo.CreatePromotion(s.ctx, mp)
+	s.Require().NoError(err)
+
+	err = s.repo.UpdatePromotion(s.ctx,
+		&query.PromotionOptions{IDIn: []int64{mp.ID}},
+		&updates.Promotion{
+			RedeemedCount: &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: 1},
+			UsedBudget:    &model.TokenOperation{Operation: model.NumericOperationAdd, Token: decimal.NewFromInt(10)},
+		},
+	)
+	s.Require().NoError(err)
+
+	err = s.repo.CreatePromotionRedemption(s.ctx, &model.PromotionRedemption{
+		PromotionID:    mp.ID,
+		UserID:         1,
+		OrderID:        "test-order",
+		DiscountAmount: decimal.NewFromInt(10),
+	})
+	s.Require().NoError(err)
+
+	mps, err := s.repo.ListPromotions(s.ctx, &query.PromotionOptions{IDIn: []int64{mp.ID}, Lock: true})
+	s.Require().NoError(err)
+	s.Require().Len(mps, 1)
+	s.Require().Equal(int32(1), mps[0].RedeemedCount)
+
+	redemptions, err := s.repo.ListPromotionRedemptions(s.ctx, &query.PromotionRedemptionOptions{
+		PromotionIDIn: []int64{mp.ID},
+		UserIDIn:      []int64{1},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(redemptions, 1)
+
+	err = s.repo.DeletePromotionRedemptions(s.ctx, &query.PromotionRedemptionOptions{OrderIDIn: []string{"test-order"}})
+	s.Require().NoError(err)
+
+	redemptions, err = s.repo.ListPromotionRedemptions(s.ctx, &query.PromotionRedemptionOptions{
+		PromotionIDIn: []int64{mp.ID},
+		UserIDIn:      []int64{1},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(redemptions, 0)
+}
+
+func (s *PromotionSuite) TestUpdatePromotionWithoutOptions() {
+	status := model.PromotionStatusEnded
+	err := s.repo.UpdatePromotion(s.ctx, &query.PromotionOptions{}, &updates.Promotion{Status: &status})
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+}
+
+func (s *PromotionSuite) TestCreateExclusivePromotion() {
+	mp := &model.Promotion{
+		Name:        "exclusive",
+		Description: "cannot combine with member discount",
+		Type:        model.PromotionTypeExtraDiscount,
+		Extension: &model.PromotionExtExtraDiscount{
+			DiscountType:   model.DiscountTypeAmount,
+			DiscountAmount: decimal.NewFromInt(10),
+		},
+		StartAt:    time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:      time.Now().Add(15 * 24 * time.Hour),
+		Priority:   10,
+		Exclusive:  true,
+		StackGroup: "member",
+	}
+
+	err := s.repo.CreatePromotion(s.ctx, mp)
+	s.Require().NoError(err)
+
+	mps, err := s.repo.ListPromotions(s.ctx, &query.PromotionOptions{IDIn: []int64{mp.ID}})
+	s.Require().NoError(err)
+	s.Require().Len(mps, 1)
+	s.Require().Equal(mp.Priority, mps[0].Priority)
+	s.Require().True(mps[0].Exclusive)
+	s.Require().Equal(mp.StackGroup, mps[0].StackGroup)
+}
+
+func (s *PromotionSuite) TestCreateRecurringPromotion() {
+	mp := &model.Promotion{
+		Name:        "happy hour",
+		Description: "weekday 18:00-20:00",
+		Type:        model.PromotionTypeExtraDiscount,
+		Extension: &model.PromotionExtExtraDiscount{
+			DiscountType: model.DiscountTypeRate,
+			DiscountRate: decimal.NewFromFloat(0.9),
+		},
+		StartAt:  time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:    time.Now().Add(15 * 24 * time.Hour),
+		Timezone: "Asia/Taipei",
+		Schedules: []*model.PromotionSchedule{
+			{
+				Weekdays:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+				StartTime: "18:00",
+				EndTime:   "20:00",
+			},
+		},
+	}
+
+	err := s.repo.CreatePromotion(s.ctx, mp)
+	s.Require().NoError(err)
+
+	now := time.Now()
+	mps, err := s.repo.ListPromotions(s.ctx, &query.PromotionOptions{
+		IDIn:       []int64{mp.ID},
+		StartAtLte: &now,
+		EndAtGt:    &now,
+	})
+	s.Require().NoError(err)
+	s.Require().Len(mps, 1)
+	s.Require().Equal(mp.Timezone, mps[0].Timezone)
+	s.Require().Len(mps[0].Schedules, 1)
+}
+
+func (s *PromotionSuite) TestUpdatePromotionExtensionVersion() {
+	mp := &model.Promotion{
+		Name:        "versioned",
+		Description: "versioned",
+		Type:        model.PromotionTypePoint,
+		Extension: &model.PromotionExtPoint{
+			Ratio: decimal.NewFromFloat(1.1),
+		},
+		StartAt: time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:   time.Now().Add(15 * 24 * time.Hour),
+		Status:  model.PromotionStatusDraft,
+	}
+
+	err := s.repo.CreatePromotion(s.ctx, mp)
+	s.Require().NoError(err)
+
+	status := model.PromotionStatusLive
+	err = s.repo.UpdatePromotion(s.ctx,
+		&query.PromotionOptions{IDIn: []int64{mp.ID}},
+		&updates.Promotion{
+			Extension: &model.PromotionExtPoint{Ratio: decimal.NewFromFloat(1.2)},
+			Status:    &status,
+		},
+	)
+	s.Require().NoError(err)
+
+	mps, err := s.repo.ListPromotions(s.ctx, &query.PromotionOptions{
+		IDIn:     []int64{mp.ID},
+		StatusIn: []model.PromotionStatus{model.PromotionStatusLive},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(mps, 1)
+	s.Require().Equal(int32(2), mps[0].Version)
+
+	versions, err := s.repo.ListPromotionVersions(s.ctx, &query.PromotionVersionOptions{PromotionIDIn: []int64{mp.ID}})
+	s.Require().NoError(err)
+	s.Require().Len(versions, 2)
+	for i := range versions {
+		log.Printf("version %d: %+v", versions[i].Version, versions[i].Extension)
+	}
+}
+
+func (s *PromotionSuite) TestUpdatePromotionStackingVersion() {
+	mp := &model.Promotion{
+		Name:        "stacking",
+		Description: "stacking",
+		Type:        model.PromotionTypePoint,
+		Extension: &model.PromotionExtPoint{
+			Ratio: decimal.NewFromFloat(1.1),
+		},
+		StartAt: time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:   time.Now().Add(15 * 24 * time.Hour),
+		Status:  model.PromotionStatusDraft,
+	}
+
+	err := s.repo.CreatePromotion(s.ctx, mp)
+	s.Require().NoError(err)
+
+	// 只修改使用限制不建立新的版本
+	maxPerUser := int32(3)
+	err = s.repo.UpdatePromotion(s.ctx,
+		&query.PromotionOptions{IDIn: []int64{mp.ID}},
+		&updates.Promotion{MaxPerUser: &maxPerUser},
+	)
+	s.Require().NoError(err)
+
+	// 修改疊加規則及重複時段時建立新的版本，沿用目前的活動內容
+	exclusive, timezone := true, "Asia/Taipei"
+	schedules := []*model.PromotionSchedule{{StartTime: "10:00", EndTime: "12:00"}}
+	err = s.repo.UpdatePromotion(s.ctx,
+		&query.PromotionOptions{IDIn: []int64{mp.ID}},
+		&updates.Promotion{Exclusive: &exclusive, Timezone: &timezone, Schedules: &schedules},
+	)
+	s.Require().NoError(err)
+
+	mps, err := s.repo.ListPromotions(s.ctx, &query.PromotionOptions{IDIn: []int64{mp.ID}})
+	s.Require().NoError(err)
+	s.Require().Len(mps, 1)
+	s.Require().Equal(int32(2), mps[0].Version)
+	s.Require().Equal(maxPerUser, mps[0].MaxPerUser)
+	s.Require().True(mps[0].Exclusive)
+	s.Require().Equal(timezone, mps[0].Timezone)
+	s.Require().Len(mps[0].Schedules, 1)
+
+	versions, err := s.repo.ListPromotionVersions(s.ctx, &query.PromotionVersionOptions{PromotionIDIn: []int64{mp.ID}})
+	s.Require().NoError(err)
+	s.Require().Len(versions, 2)
+	s.Require().Equal(mp.Extension, versions[1].Extension)
+}
+
+func (s *PromotionSuite) TestCreateInvalidPromotion() {
+	mp := &model.Promotion{
+		Name:        "invalid",
+		Description: "invalid spend tier",
+		Type:        model.PromotionTypeSpendTier,
+		Extension: &model.PromotionExtSpendTier{
+			Tiers: []*model.SpendTier{
+				{MinAmount: decimal.NewFromInt(1000), DiscountType: model.DiscountTypeRate, DiscountRate: decimal.NewFromFloat(1.5)},
+				{MinAmount: decimal.NewFromInt(500), DiscountType: model.DiscountTypeAmount, DiscountAmount: decimal.NewFromInt(-50)},
+			},
+		},
+		StartAt: time.Now().Add(-5 * 24 * time.Hour),
+		EndAt:   time.Now().Add(15 * 24 * time.Hour),
+	}
+
+	err := s.repo.CreatePromotion(s.ctx, mp)
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+
+	details := errors.Details(err)
+	s.Require().Contains(details, "Extension.Tiers[0].DiscountRate")
+	s.Require().Contains(details, "Extension.Tiers[1].DiscountAmount")
+	s.Require().Contains(details, "Extension.Tiers[1].MinAmount")
+}
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reservation schema
+type reservation struct {
+	ID        string                  `gorm:"column:id"`
+	UserID    int64                   `gorm:"column:user_id"`    // 用戶ID
+	Status    model.ReservationStatus `gorm:"column:status"`     // 保留單狀態
+	OrderID   string                  `gorm:"column:order_id"`   // 確認後建立的訂單ID
+	ExpiredAt time.Time               `gorm:"column:expired_at"` // 保留到期時間
+	CreatedAt time.Time               `gorm:"column:created_at"` // 創建時間
+	UpdatedAt time.Time               `gorm:"column:updated_at"` // 更新時間
+
+	Items []*reservationItem `gorm:"foreignKey:ReservationID;references:ID"`
+}
+
+func (r reservation) TableName() string {
+	return "inventory_reservations"
+}
+
+func (r *reservation) ConvertToModel() *model.Reservation {
+	mr := &model.Reservation{
+		ID:        r.ID,
+		UserID:    r.UserID,
+		Status:    r.Status,
+		OrderID:   r.OrderID,
+		ExpiredAt: r.ExpiredAt,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+		Items:     make([]*model.ReservationItem, 0, len(r.Items)),
+	}
+
+	for i := range r.Items {
+		mr.Items = append(mr.Items, r.Items[i].ConvertToModel())
+	}
+
+	return mr
+}
+
+type reservationUpdates struct {
+	Status  *model.ReservationStatus `gorm:"column:status"`
+	OrderID *string                  `gorm:"column:order_id"`
+}
+
+func buildReservationWhereCondition(db *gorm.DB, options *query.ReservationOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.IDIn) > 0 {
+		values := make([]interface{}, 0, len(options.IDIn))
+		for i := range options.IDIn {
+			values = append(values, options.IDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "id",
+			Values: values,
+		})
+	}
+
+	if len(options.UserIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.UserIDIn))
+		for i := range options.UserIDIn {
+			values = append(values, options.UserIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "user_id",
+			Values: values,
+		})
+	}
+
+	if len(options.StatusIn) > 0 {
+		values := make([]interface{}, 0, len(options.StatusIn))
+		for i := range options.StatusIn {
+			values = append(values, options.StatusIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "status",
+			Values: values,
+		})
+	}
+
+	if options.ExpiredAtLt != nil {
+		clauses = append(clauses, clause.Lt{
+			Column: "expired_at",
+			Value:  options.ExpiredAtLt,
+		})
+	}
+
+	if options.Lock {
+		clauses = append(clauses, clause.Locking{Strength: "UPDATE"})
+	}
+
+	if options.WithItems {
+		db = db.Preload("Items")
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// CreateReservation 建立庫存保留單 & 保留的商品
+func (db *database) CreateReservation(ctx context.Context, mReservation *model.Reservation) error {
+	var _reservation = &reservation{
+		ID:        mReservation.ID,
+		UserID:    mReservation.UserID,
+		Status:    mReservation.Status,
+		OrderID:   mReservation.OrderID,
+		ExpiredAt: mReservation.ExpiredAt,
+		Items:     make([]*reservationItem, 0, len(mReservation.Items)),
+	}
+
+	for i := range mReservation.Items {
+		_reservation.Items = append(_reservation.Items, &reservationItem{
+			ReservationID: mReservation.ID,
+			ProductID:     mReservation.Items[i].ProductID,
+			Quantity:      mReservation.Items[i].Quantity,
+		})
+	}
+
+	if err := db.WriteDB(ctx).Create(_reservation).Error; err != nil {
+		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	}
+
+	return nil
+}
+
+// GetReservation 取得單筆庫存保留單，找不到時返回 errors.ErrResourceNotFound
+func (db *database) GetReservation(ctx context.Context, options *query.ReservationOptions) (*model.Reservation, error) {
+	var _reservation = &reservation{}
+
+	if err := buildReservationWhereCondition(db.ReadDB(ctx), options).First(_reservation).Error; err != nil {
+		return nil, errors.Wrapf(notFoundOrInternalError(err), "%+v", err)
+	}
+
+	return _reservation.ConvertToModel(), nil
+}
+
+// ListReservations 取得多筆庫存保留單，依到期時間排序
+func (db *database) ListReservations(ctx context.Context, options *query.ReservationOptions) ([]*model.Reservation, error) {
+	var _reservations = make([]*reservation, 0)
+
+	tx := buildReservationWhereCondition(db.ReadDB(ctx), options).Order("expired_at")
+	if options.Limit > 0 {
+		tx = tx.Limit(options.Limit)
+	}
+
+	if err := tx.Find(&_reservations).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mReservations = make([]*model.Reservation, 0, len(_reservations))
+	for i := range _reservations {
+		mReservations = append(mReservations, _reservations[i].ConvertToModel())
+	}
+
+	return mReservations, nil
+}
+
+// UpdateReservation 更新庫存保留單
+func (db *database) UpdateReservation(ctx context.Context, options *query.ReservationOptions, updates *updates.Reservation) error {
+	// 沒有條件時會更新所有庫存保留單
+	if len(options.IDIn) == 0 && len(options.UserIDIn) == 0 && len(options.StatusIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "reservation id, user id or status is required")
+	}
+
+	var _updates = &reservationUpdates{
+		Status:  updates.Status,
+		OrderID: updates.OrderID,
+	}
+
+	if err := buildReservationWhereCondition(db.WriteDB(ctx), options).
+		Table(reservation{}.TableName()).
+		Updates(_updates).Error; err != nil {
+		return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	return nil
+}
+
+type reservationItem struct {
+	ID            int64  `gorm:"column:id"`
+	ReservationID string `gorm:"column:reservation_id"` // 關聯的 Reservation.ID
+	ProductID     int64  `gorm:"column:product_id"`     // Product 的 ID
+	Quantity      int32  `gorm:"column:quantity"`       // 保留數量
+}
+
+func (r reservationItem) TableName() string {
+	return "inventory_reservation_items"
+}
+
+func (r *reservationItem) ConvertToModel() *model.ReservationItem {
+	return &model.ReservationItem{
+		ID:            r.ID,
+		ReservationID: r.ReservationID,
+		ProductID:     r.ProductID,
+		Quantity:      r.Quantity,
+	}
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/suite"
+)
+
+// ################################
+//
+//  超級隨便的測試
+//  只是想測試 sql 語法正常
+//
+// ################################
+
+type ReservationSuite struct {
+	suite.Suite
+
+	ctx  context.Context
+	repo iDB.IDatabase
+}
+
+func TestReservation(t *testing.T) {
+	suite.Run(t, new(ReservationSuite))
+}
+
+func (s *ReservationSuite) SetupSuite() {
+	readDB, writeDB, err := newTestDB()
+	s.Require().NoError(err)
+
+	s.ctx = context.Background()
+	s.repo = New(readDB, writeDB)
+}
+
+func (s *ReservationSuite) TestReservation() {
+	reservationID := xid.New().String()
+	err := s.repo.CreateReservation(s.ctx, &model.Reservation{
+		ID:        reservationID,
+		UserID:    12345678,
+		Status:    model.ReservationStatusReserved,
+		ExpiredAt: time.Now().Add(-time.Minute),
+		Items: []*model.ReservationItem{
+			{ReservationID: reservationID, ProductID: 1, Quantity: 1},
+			{ReservationID: reservationID, ProductID: 2, Quantity: 2},
+		},
+	})
+	s.Require().NoError(err)
+
+	now := time.Now()
+	reservations, err := s.repo.ListReservations(s.ctx, &query.ReservationOptions{
+		StatusIn:    []model.ReservationStatus{model.ReservationStatusReserved},
+		ExpiredAtLt: &now,
+		Limit:       10,
+	})
+	s.Require().NoError(err)
+	s.Require().NotEmpty(reservations)
+
+	status := model.ReservationStatusReleased
+	err = s.repo.UpdateReservation(s.ctx,
+		&query.ReservationOptions{IDIn: []string{reservationID}},
+		&updates.Reservation{Status: &status},
+	)
+	s.Require().NoError(err)
+
+	reservation, err := s.repo.GetReservation(s.ctx, &query.ReservationOptions{
+		IDIn:      []string{reservationID},
+		WithItems: true,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(model.ReservationStatusReleased, reservation.Status)
+	s.Require().Len(reservation.Items, 2)
+}
+
+func (s *ReservationSuite) TestUpdateReservationWithoutOptions() {
+	status := model.ReservationStatusReleased
+	err := s.repo.UpdateReservation(s.ctx, &query.ReservationOptions{}, &updates.Reservation{Status: &status})
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+}
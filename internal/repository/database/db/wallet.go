@@ -1,20 +1,307 @@
 package db
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"cashier/internal/model"
 	"cashier/internal/model/query"
 	"cashier/internal/model/updates"
-	"context"
+	"cashier/internal/pkg/errors"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// GetWallet 取得用戶錢包
+// wallet schema，user_id 為 unique key
+type wallet struct {
+	ID        int64           `gorm:"column:id"`         // ID
+	UserID    int64           `gorm:"column:user_id"`    // 用戶ID
+	Token     decimal.Decimal `gorm:"column:token"`      // 平台幣
+	Points    int32           `gorm:"column:points"`     // 平台點數
+	CreatedAt time.Time       `gorm:"column:created_at"` // 創建時間
+	UpdatedAt time.Time       `gorm:"column:updated_at"` // 更新時間
+}
+
+func (w wallet) TableName() string {
+	return "wallets"
+}
+
+func (w *wallet) ConvertToModel() *model.Wallet {
+	return &model.Wallet{
+		ID:        w.ID,
+		UserID:    w.UserID,
+		Token:     w.Token,
+		Points:    w.Points,
+		CreatedAt: w.CreatedAt,
+		UpdatedAt: w.UpdatedAt,
+	}
+}
+
+type walletUpdates struct {
+	Token  *gormExpr `gorm:"column:token"`
+	Points *gormExpr `gorm:"column:points"`
+}
+
+func buildWalletWhereCondition(db *gorm.DB, options *query.WalletOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.IDIn) > 0 {
+		values := make([]interface{}, 0, len(options.IDIn))
+		for i := range options.IDIn {
+			values = append(values, options.IDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "id",
+			Values: values,
+		})
+	}
+
+	if len(options.UserIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.UserIDIn))
+		for i := range options.UserIDIn {
+			values = append(values, options.UserIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "user_id",
+			Values: values,
+		})
+	}
+
+	if options.Lock {
+		clauses = append(clauses, clause.Locking{Strength: "UPDATE"})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// GetWallet 取得用戶錢包，找不到時返回 errors.ErrResourceNotFound
 func (db *database) GetWallet(ctx context.Context, options *query.WalletOptions) (*model.Wallet, error) {
-	// skip
-	return &model.Wallet{}, nil
+	var _wallet = &wallet{}
+
+	if err := buildWalletWhereCondition(db.ReadDB(ctx), options).First(_wallet).Error; err != nil {
+		return nil, errors.Wrapf(notFoundOrInternalError(err), "%+v", err)
+	}
+
+	return _wallet.ConvertToModel(), nil
+}
+
+// CreateWallet 建立用戶錢包，用戶已有錢包時返回 errors.ErrResourceAlreadyExists
+func (db *database) CreateWallet(ctx context.Context, mWallet *model.Wallet) error {
+	var _wallet = &wallet{
+		UserID: mWallet.UserID,
+		Token:  mWallet.Token,
+		Points: mWallet.Points,
+	}
+
+	if err := db.WriteDB(ctx).Create(_wallet).Error; err != nil {
+		return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+	}
+
+	mWallet.ID = _wallet.ID
+	mWallet.CreatedAt = _wallet.CreatedAt
+	mWallet.UpdatedAt = _wallet.UpdatedAt
+
+	return nil
 }
 
-// UpdateWallet 更新用戶錢包
+// UpdateWallet 更新用戶錢包，並為每個異動的錢包寫入一筆 wallet_transactions
 func (db *database) UpdateWallet(ctx context.Context, options *query.WalletOptions, updates *updates.Wallet) error {
-	// skip
+	// 沒有條件時會更新所有錢包
+	if len(options.IDIn) == 0 && len(options.UserIDIn) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "wallet id or user id is required")
+	}
+
+	var (
+		_updates    = &walletUpdates{}
+		tokenDelta  = decimal.Zero
+		pointsDelta int32
+	)
+
+	if updates.TokenOperation != nil {
+		_updates.Token = &gormExpr{clause.Expr{
+			SQL:  fmt.Sprintf("%s %s ?", "token", updates.TokenOperation.Operation.Sql()),
+			Vars: []interface{}{updates.TokenOperation.Token},
+		}}
+		tokenDelta = updates.TokenOperation.Token
+		if updates.TokenOperation.Operation == model.NumericOperationSub {
+			tokenDelta = tokenDelta.Neg()
+		}
+	}
+
+	if updates.PointsOperation != nil {
+		_updates.Points = &gormExpr{clause.Expr{
+			SQL:  fmt.Sprintf("%s %s ?", "points", updates.PointsOperation.Operation.Sql()),
+			Vars: []interface{}{updates.PointsOperation.Points},
+		}}
+		pointsDelta = updates.PointsOperation.Points
+		if updates.PointsOperation.Operation == model.NumericOperationSub {
+			pointsDelta = -pointsDelta
+		}
+	}
+
+	if _updates.Token == nil && _updates.Points == nil {
+		return nil
+	}
+
+	// 已在 transaction 內時 gorm 會使用 savepoint
+	err := db.WriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		// 鎖定要異動的錢包
+		var _wallets = make([]*wallet, 0)
+		if err := buildWalletWhereCondition(tx, &query.WalletOptions{
+			IDIn:     options.IDIn,
+			UserIDIn: options.UserIDIn,
+			Lock:     true,
+		}).Find(&_wallets).Error; err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+		if len(_wallets) == 0 {
+			return errors.Wrapf(errors.ErrResourceNotFound, "wallet not found, options: %+v", options)
+		}
+
+		var walletIDs = make([]int64, 0, len(_wallets))
+		for i := range _wallets {
+			walletIDs = append(walletIDs, _wallets[i].ID)
+		}
+
+		if err := buildWalletWhereCondition(tx, &query.WalletOptions{IDIn: walletIDs}).
+			Table(wallet{}.TableName()).
+			Updates(_updates).Error; err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+
+		// 取得異動後的餘額
+		_wallets = make([]*wallet, 0, len(walletIDs))
+		if err := buildWalletWhereCondition(tx, &query.WalletOptions{IDIn: walletIDs}).
+			Find(&_wallets).Error; err != nil {
+			return errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+		}
+
+		var _transactions = make([]*walletTransaction, 0, len(_wallets))
+		for i := range _wallets {
+			_transactions = append(_transactions, &walletTransaction{
+				WalletID:    _wallets[i].ID,
+				UserID:      _wallets[i].UserID,
+				OrderID:     updates.OrderID,
+				Reason:      updates.Reason,
+				ReasonCode:  updates.ReasonCode,
+				OperatorID:  updates.OperatorID,
+				TokenDelta:  tokenDelta,
+				PointsDelta: pointsDelta,
+				TokenAfter:  _wallets[i].Token,
+				PointsAfter: _wallets[i].Points,
+			})
+		}
+
+		if err := tx.Create(&_transactions).Error; err != nil {
+			return errors.Wrapf(duplicateOrInternalError(err), "%+v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// walletTransaction schema，只新增不修改
+type walletTransaction struct {
+	ID          int64                         `gorm:"column:id"`
+	WalletID    int64                         `gorm:"column:wallet_id"`    // 關聯 wallets.id
+	UserID      int64                         `gorm:"column:user_id"`      // 用戶ID
+	OrderID     string                        `gorm:"column:order_id"`     // 關聯的 OrderID
+	Reason      model.WalletTransactionReason `gorm:"column:reason"`       // 異動原因
+	ReasonCode  string                        `gorm:"column:reason_code"`  // 異動原因代碼
+	OperatorID  int64                         `gorm:"column:operator_id"`  // 操作者ID
+	TokenDelta  decimal.Decimal               `gorm:"column:token_delta"`  // 平台幣異動量
+	PointsDelta int32                         `gorm:"column:points_delta"` // 平台點數異動量
+	TokenAfter  decimal.Decimal               `gorm:"column:token_after"`  // 異動後的平台幣餘額
+	PointsAfter int32                         `gorm:"column:points_after"` // 異動後的平台點數餘額
+	CreatedAt   time.Time                     `gorm:"column:created_at"`   // 創建時間
+}
+
+func (w walletTransaction) TableName() string {
+	return "wallet_transactions"
+}
+
+func (w *walletTransaction) ConvertToModel() *model.WalletTransaction {
+	return &model.WalletTransaction{
+		ID:          w.ID,
+		WalletID:    w.WalletID,
+		UserID:      w.UserID,
+		OrderID:     w.OrderID,
+		Reason:      w.Reason,
+		ReasonCode:  w.ReasonCode,
+		OperatorID:  w.OperatorID,
+		TokenDelta:  w.TokenDelta,
+		PointsDelta: w.PointsDelta,
+		TokenAfter:  w.TokenAfter,
+		PointsAfter: w.PointsAfter,
+		CreatedAt:   w.CreatedAt,
+	}
+}
+
+func buildWalletTransactionWhereCondition(db *gorm.DB, options *query.WalletTransactionOptions) *gorm.DB {
+	var clauses []clause.Expression
+
+	if len(options.WalletIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.WalletIDIn))
+		for i := range options.WalletIDIn {
+			values = append(values, options.WalletIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "wallet_id",
+			Values: values,
+		})
+	}
+
+	if len(options.UserIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.UserIDIn))
+		for i := range options.UserIDIn {
+			values = append(values, options.UserIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "user_id",
+			Values: values,
+		})
+	}
+
+	if len(options.OrderIDIn) > 0 {
+		values := make([]interface{}, 0, len(options.OrderIDIn))
+		for i := range options.OrderIDIn {
+			values = append(values, options.OrderIDIn[i])
+		}
+		clauses = append(clauses, clause.IN{
+			Column: "order_id",
+			Values: values,
+		})
+	}
+
+	db = db.Clauses(clauses...)
+
+	return db
+}
+
+// ListWalletTransactions 取得錢包異動紀錄，依時間排序
+func (db *database) ListWalletTransactions(ctx context.Context, options *query.WalletTransactionOptions) ([]*model.WalletTransaction, error) {
+	var _transactions = make([]*walletTransaction, 0)
+
+	if err := buildWalletTransactionWhereCondition(db.ReadDB(ctx), options).
+		Order("id").
+		Find(&_transactions).Error; err != nil {
+		return nil, errors.Wrapf(errors.ErrInternalServerError, "%+v", err)
+	}
+
+	var mTransactions = make([]*model.WalletTransaction, 0, len(_transactions))
+	for i := range _transactions {
+		mTransactions = append(mTransactions, _transactions[i].ConvertToModel())
+	}
+
+	return mTransactions, nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"log"
+	"testing"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/suite"
+)
+
+// ################################
+//
+//  超級隨便的測試
+//  只是想測試 sql 語法正常
+//
+// ################################
+
+type WalletSuite struct {
+	suite.Suite
+
+	ctx  context.Context
+	repo iDB.IDatabase
+}
+
+func TestWallet(t *testing.T) {
+	suite.Run(t, new(WalletSuite))
+}
+
+func (s *WalletSuite) SetupSuite() {
+	readDB, writeDB, err := newTestDB()
+	s.Require().NoError(err)
+
+	s.ctx = context.Background()
+	s.repo = New(readDB, writeDB)
+}
+
+func (s *WalletSuite) TestGetWallet() {
+	wallet, err := s.repo.GetWallet(s.ctx, &query.WalletOptions{
+		UserIDIn: []int64{12345678},
+		Lock:     true,
+	})
+	s.Require().NoError(err)
+	log.Printf("wallet: %+v", wallet)
+}
+
+func (s *WalletSuite) TestUpdateWallet() {
+	orderID := xid.New().String()
+	err := s.repo.UpdateWallet(s.ctx,
+		&query.WalletOptions{UserIDIn: []int64{12345678}},
+		&updates.Wallet{
+			TokenOperation: &model.TokenOperation{
+				Operation: model.NumericOperationSub,
+				Token:     decimal.NewFromInt32(10),
+			},
+			PointsOperation: &model.PointOperation{
+				Operation: model.NumericOperationSub,
+				Points:    1,
+			},
+			OrderID: orderID,
+			Reason:  model.WalletTransactionReasonOrderPayment,
+		},
+	)
+	s.Require().NoError(err)
+
+	transactions, err := s.repo.ListWalletTransactions(s.ctx, &query.WalletTransactionOptions{
+		OrderIDIn: []string{orderID},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(transactions, 1)
+	s.Require().True(transactions[0].TokenDelta.Equal(decimal.NewFromInt32(-10)))
+	s.Require().Equal(int32(-1), transactions[0].PointsDelta)
+}
+
+func (s *WalletSuite) TestUpdateWalletWithoutOptions() {
+	err := s.repo.UpdateWallet(s.ctx,
+		&query.WalletOptions{},
+		&updates.Wallet{
+			TokenOperation: &model.TokenOperation{
+				Operation: model.NumericOperationAdd,
+				Token:     decimal.NewFromInt32(10),
+			},
+		},
+	)
+	s.Require().ErrorIs(err, errors.ErrInvalidInput)
+}
+
+func (s *WalletSuite) TestCreateWallet() {
+	err := s.repo.CreateWallet(s.ctx, &model.Wallet{
+		UserID: xid.New().Time().UnixNano(),
+		Token:  decimal.NewFromInt32(100),
+		Points: 10,
+	})
+	s.Require().NoError(err)
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+	"context"
+)
+
+// CreateCategory 建立商品分類，parentID 為 0 時建立最上層分類
+func (s *service) CreateCategory(ctx context.Context, name string, parentID int64) (*model.Category, error) {
+	if name == "" {
+		return nil, errors.Wrap(errors.ErrInvalidInput, "category name is required")
+	}
+
+	var category = &model.Category{
+		ParentID: parentID,
+		Name:     name,
+		Path:     "/",
+	}
+
+	if parentID > 0 {
+		parent, err := s.db.GetCategory(ctx, &query.CategoryOptions{IDIn: []int64{parentID}})
+		if err != nil {
+			return nil, err
+		}
+		category.Path = parent.ChildPath()
+	}
+
+	if err := s.db.CreateCategory(ctx, category); err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// ListCategories 取得 parentID 下一層的商品分類，parentID 為 0 時取得最上層分類
+func (s *service) ListCategories(ctx context.Context, parentID int64) ([]*model.Category, error) {
+	return s.db.ListCategories(ctx, &query.CategoryOptions{
+		ParentIDIn: []int64{parentID},
+	})
+}
+
+// SetProductCategory 設定商品分類，categoryID 為 0 時移除商品分類
+func (s *service) SetProductCategory(ctx context.Context, productID, categoryID int64) error {
+	if categoryID > 0 {
+		if _, err := s.db.GetCategory(ctx, &query.CategoryOptions{IDIn: []int64{categoryID}}); err != nil {
+			return err
+		}
+	}
+
+	return s.updateProduct(ctx, productID, &updates.Product{CategoryID: &categoryID})
+}
+
+// SetProductTags 設定商品標籤，會取代原本的標籤
+func (s *service) SetProductTags(ctx context.Context, productID int64, tags []string) error {
+	var (
+		uniqueTags = make([]string, 0, len(tags))
+		seen       = make(map[string]struct{}, len(tags))
+	)
+	for _, tag := range tags {
+		if tag == "" {
+			return errors.Wrap(errors.ErrInvalidInput, "product tag can not be empty")
+		}
+		if _, exist := seen[tag]; exist {
+			continue
+		}
+		seen[tag] = struct{}{}
+		uniqueTags = append(uniqueTags, tag)
+	}
+
+	return s.updateProduct(ctx, productID, &updates.Product{Tags: &uniqueTags})
+}
+
+// updateProduct 鎖定並更新商品，商品不存在時返回 errors.ErrResourceNotFound
+func (s *service) updateProduct(ctx context.Context, productID int64, updatesProduct *updates.Product) error {
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		if _, err := txRepo.GetProduct(txCtx, &query.ProductOptions{
+			IDIn: []int64{productID},
+			Lock: true,
+		}); err != nil {
+			return err
+		}
+
+		return txRepo.UpdateProduct(txCtx, &query.ProductOptions{IDIn: []int64{productID}}, updatesProduct)
+	})
+}
+
+// newPriceItems 依訂單商品建立計算優惠用的商品，包含商品的分類及標籤
+func (s *service) newPriceItems(ctx context.Context, items []*model.OrderItem, products []*model.Product) ([]*model.PriceItem, error) {
+	var (
+		productMap  = make(map[int64]*model.Product, len(products))
+		categoryIDs = make([]int64, 0, len(products))
+	)
+	for _, product := range products {
+		productMap[product.ID] = product
+		if product.CategoryID > 0 {
+			categoryIDs = append(categoryIDs, product.CategoryID)
+		}
+	}
+
+	// 商品分類ID -> 商品分類及所有上層分類ID
+	var ancestorMap = make(map[int64][]int64, len(categoryIDs))
+	if len(categoryIDs) > 0 {
+		categories, err := s.db.ListCategories(ctx, &query.CategoryOptions{IDIn: categoryIDs})
+		if err != nil {
+			return nil, err
+		}
+		for _, category := range categories {
+			ancestorMap[category.ID] = category.AncestorIDs()
+		}
+	}
+
+	var priceItems = make([]*model.PriceItem, 0, len(items))
+	for _, item := range items {
+		priceItem := &model.PriceItem{OrderItem: item}
+		if product, exist := productMap[item.ProductID]; exist {
+			priceItem.CategoryIDs = ancestorMap[product.CategoryID]
+			priceItem.Tags = product.Tags
+		}
+		priceItems = append(priceItems, priceItem)
+	}
+
+	return priceItems, nil
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+	"context"
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	// couponCodeAlphabet 優惠碼使用的字元，排除容易混淆的 0、O、1、I
+	couponCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// couponCodeLength 優惠碼隨機部分的長度，不包含前綴
+	couponCodeLength = 10
+	// maxGenerateCoupons 單次最多產生的優惠碼數量
+	maxGenerateCoupons = 10000
+	// generateCouponRetries 優惠碼重複時重新產生的次數
+	generateCouponRetries = 3
+)
+
+// GenerateCoupons 依 template 的活動、使用次數及到期時間批次產生 count 個優惠碼
+// 優惠碼為 prefix 加上隨機字元，關聯的活動必須是只能透過優惠碼使用的活動
+func (s *service) GenerateCoupons(ctx context.Context, template *model.Coupon, count int, prefix string) ([]*model.Coupon, error) {
+	if count <= 0 || count > maxGenerateCoupons {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "coupon count %d must be between 1 and %d", count, maxGenerateCoupons)
+	}
+	if template.MaxRedemptions < 0 || template.MaxPerUser < 0 {
+		return nil, errors.Wrapf(errors.ErrInvalidInput,
+			"invalid coupon limits, max redemptions: %d, max per user: %d", template.MaxRedemptions, template.MaxPerUser,
+		)
+	}
+	if !template.ExpiredAt.After(s.now()) {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "coupon expired at %s is in the past", template.ExpiredAt)
+	}
+
+	promotions, err := s.db.ListPromotions(ctx, &query.PromotionOptions{IDIn: []int64{template.PromotionID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(promotions) == 0 {
+		return nil, errors.Wrapf(errors.ErrResourceNotFound, "promotion(%d) not found", template.PromotionID)
+	}
+	if !promotions[0].CouponOnly {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "promotion(%d) is not coupon only", template.PromotionID)
+	}
+
+	prefix = normalizeCouponCode(prefix)
+	for retry := 0; ; retry++ {
+		coupons, err := newCoupons(template, count, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.db.CreateCoupons(ctx, coupons)
+		if err == nil {
+			return coupons, nil
+		}
+		// 與已存在的優惠碼重複時重新產生
+		if !errors.Is(err, errors.ErrResourceAlreadyExists) || retry >= generateCouponRetries {
+			return nil, err
+		}
+	}
+}
+
+// ListCoupons 取得活動的優惠碼
+func (s *service) ListCoupons(ctx context.Context, promotionID int64) ([]*model.Coupon, error) {
+	return s.db.ListCoupons(ctx, &query.CouponOptions{
+		PromotionIDIn: []int64{promotionID},
+	})
+}
+
+// newCoupons 產生 count 個不重複的優惠碼
+func newCoupons(template *model.Coupon, count int, prefix string) ([]*model.Coupon, error) {
+	var (
+		coupons = make([]*model.Coupon, 0, count)
+		seen    = make(map[string]struct{}, count)
+		max     = big.NewInt(int64(len(couponCodeAlphabet)))
+	)
+
+	for len(coupons) < count {
+		var b strings.Builder
+		b.WriteString(prefix)
+		for i := 0; i < couponCodeLength; i++ {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, errors.Wrapf(errors.ErrInternalError, "%+v", err)
+			}
+			b.WriteByte(couponCodeAlphabet[n.Int64()])
+		}
+
+		code := b.String()
+		if _, exist := seen[code]; exist {
+			continue
+		}
+		seen[code] = struct{}{}
+
+		coupons = append(coupons, &model.Coupon{
+			Code:           code,
+			PromotionID:    template.PromotionID,
+			MaxRedemptions: template.MaxRedemptions,
+			MaxPerUser:     template.MaxPerUser,
+			ExpiredAt:      template.ExpiredAt,
+		})
+	}
+
+	return coupons, nil
+}
+
+// normalizeCouponCode 優惠碼不分大小寫，統一轉為大寫
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// normalizeCouponCodes 統一優惠碼格式並移除重複的優惠碼，保留原本的順序
+func normalizeCouponCodes(codes []string) []string {
+	var (
+		res  = make([]string, 0, len(codes))
+		seen = make(map[string]struct{}, len(codes))
+	)
+	for _, code := range codes {
+		code = normalizeCouponCode(code)
+		if _, exist := seen[code]; exist {
+			continue
+		}
+		seen[code] = struct{}{}
+		res = append(res, code)
+	}
+	return res
+}
+
+// getRedeemableCoupons 取得用戶可以使用的優惠碼及關聯的活動，依 codes 的順序返回
+// lock 為 true 時鎖定優惠碼，必須在 transaction 內執行，now 為檢查是否有效的時間
+func getRedeemableCoupons(ctx context.Context, repo iDB.IDatabase, userID int64, codes []string, lock bool, now time.Time) ([]*model.Coupon, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	coupons, err := repo.ListCoupons(ctx, &query.CouponOptions{
+		CodeIn: codes,
+		Lock:   lock,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		couponMap    = make(map[string]*model.Coupon, len(coupons))
+		couponIDs    = make([]int64, 0, len(coupons))
+		promotionIDs = make([]int64, 0, len(coupons))
+	)
+	for _, coupon := range coupons {
+		couponMap[coupon.Code] = coupon
+		couponIDs = append(couponIDs, coupon.ID)
+		promotionIDs = append(promotionIDs, coupon.PromotionID)
+	}
+	for _, code := range codes {
+		if _, exist := couponMap[code]; !exist {
+			return nil, errors.Wrapf(errors.ErrResourceNotFound, "coupon %s not found", code)
+		}
+	}
+
+	promotions, err := repo.ListPromotions(ctx, &query.PromotionOptions{IDIn: promotionIDs})
+	if err != nil {
+		return nil, err
+	}
+	var promotionMap = make(map[int64]*model.Promotion, len(promotions))
+	for _, promotion := range promotions {
+		promotionMap[promotion.ID] = promotion
+	}
+
+	// 用戶已使用各優惠碼的次數
+	redemptions, err := repo.ListCouponRedemptions(ctx, &query.CouponRedemptionOptions{
+		CouponIDIn: couponIDs,
+		UserIDIn:   []int64{userID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var userRedeemed = make(map[int64]int32, len(couponIDs))
+	for _, redemption := range redemptions {
+		userRedeemed[redemption.CouponID]++
+	}
+
+	var (
+		res                = make([]*model.Coupon, 0, len(codes))
+		usedPromotionCodes = make(map[int64]string, len(codes))
+	)
+	for _, code := range codes {
+		coupon := couponMap[code]
+
+		if coupon.IsExpired(now) {
+			return nil, errors.Wrapf(errors.ErrResourceUnavailable, "coupon %s is expired", code)
+		}
+		if coupon.IsExhausted() {
+			return nil, errors.Wrapf(errors.ErrResourceInsufficient, "coupon %s is fully redeemed", code)
+		}
+		if coupon.MaxPerUser > 0 && userRedeemed[coupon.ID] >= coupon.MaxPerUser {
+			return nil, errors.Wrapf(errors.ErrResourceInsufficient,
+				"coupon %s is redeemed %d times by user(%d)", code, userRedeemed[coupon.ID], userID,
+			)
+		}
+
+		promotion, exist := promotionMap[coupon.PromotionID]
+		if !exist || !promotion.IsActive(now) {
+			return nil, errors.Wrapf(errors.ErrResourceUnavailable, "promotion of coupon %s is not active", code)
+		}
+		if err := promotion.Validate(); err != nil {
+			return nil, errors.Wrapf(errors.ErrInternalServerError, "promotion(%d) of coupon %s is invalid: %+v", promotion.ID, code, err)
+		}
+		// 同一個活動只能使用一個優惠碼
+		if other, exist := usedPromotionCodes[promotion.ID]; exist {
+			return nil, errors.Wrapf(errors.ErrInvalidInput, "coupons %s and %s belong to the same promotion", other, code)
+		}
+		usedPromotionCodes[promotion.ID] = code
+
+		coupon.Promotion = promotion
+		res = append(res, coupon)
+	}
+
+	return res, nil
+}
+
+// redeemCoupons 鎖定並重新檢查訂單使用的優惠碼，增加使用次數並紀錄使用的訂單
+// 必須在 transaction 內執行，避免同時結帳超過可使用次數
+func redeemCoupons(ctx context.Context, txRepo iDB.IDatabase, order *model.Order, now time.Time) error {
+	coupons, err := getRedeemableCoupons(ctx, txRepo, order.UserID, order.CouponCodes, true, now)
+	if err != nil {
+		return err
+	}
+
+	for _, coupon := range coupons {
+		if err := txRepo.UpdateCoupon(ctx,
+			&query.CouponOptions{IDIn: []int64{coupon.ID}},
+			&updates.Coupon{RedeemedCount: &model.QuantityOperation{
+				Operation: model.NumericOperationAdd,
+				Quantity:  1,
+			}},
+		); err != nil {
+			return err
+		}
+
+		if err := txRepo.CreateCouponRedemption(ctx, &model.CouponRedemption{
+			CouponID: coupon.ID,
+			UserID:   order.UserID,
+			OrderID:  order.ID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseCoupons 取消訂單或全額退款時歸還訂單使用的優惠碼，扣回使用次數並刪除使用紀錄
+// 必須在 transaction 內執行
+func releaseCoupons(ctx context.Context, txRepo iDB.IDatabase, order *model.Order) error {
+	redemptions, err := txRepo.ListCouponRedemptions(ctx, &query.CouponRedemptionOptions{
+		OrderIDIn: []string{order.ID},
+	})
+	if err != nil {
+		return err
+	}
+	if len(redemptions) == 0 {
+		return nil
+	}
+
+	for _, r := range redemptions {
+		if err := txRepo.UpdateCoupon(ctx,
+			&query.CouponOptions{IDIn: []int64{r.CouponID}},
+			&updates.Coupon{RedeemedCount: &model.QuantityOperation{
+				Operation: model.NumericOperationSub,
+				Quantity:  1,
+			}},
+		); err != nil {
+			return err
+		}
+	}
+
+	return txRepo.DeleteCouponRedemptions(ctx, &query.CouponRedemptionOptions{
+		OrderIDIn: []string{order.ID},
+	})
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cashier/internal/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedeemAndReleaseCoupons(t *testing.T) {
+	s, db := newOrderTestService()
+	ctx := context.Background()
+
+	orderID, err := s.CreateOrder(ctx, testUserID, 0, map[int64]int32{2: 1}, []string{" save10 "}, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), db.coupons[0].RedeemedCount)
+	require.Len(t, db.couponRedemptions, 1)
+	require.Equal(t, orderID, db.couponRedemptions[0].OrderID)
+
+	// 每個用戶只能使用一次
+	_, err = s.CreateOrder(ctx, testUserID, 0, map[int64]int32{2: 1}, []string{"SAVE10"}, "")
+	require.ErrorIs(t, err, errors.ErrResourceInsufficient)
+	require.Equal(t, int32(1), db.coupons[0].RedeemedCount)
+
+	// 全額退款後歸還使用次數，可以再次使用
+	require.NoError(t, s.RefundOrderItems(ctx, orderID, map[int64]int32{db.orders[0].Items[0].ID: 1}, 99, "refund"))
+	require.Zero(t, db.coupons[0].RedeemedCount)
+	require.Empty(t, db.couponRedemptions)
+
+	_, err = s.CreateOrder(ctx, testUserID, 0, map[int64]int32{2: 1}, []string{"SAVE10"}, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), db.coupons[0].RedeemedCount)
+}
+
+func TestGetRedeemableCoupons(t *testing.T) {
+	_, db := newOrderTestService()
+	ctx := context.Background()
+
+	_, err := getRedeemableCoupons(ctx, db, testUserID, []string{"UNKNOWN"}, false, testNow)
+	require.ErrorIs(t, err, errors.ErrResourceNotFound)
+
+	_, err = getRedeemableCoupons(ctx, db, testUserID, []string{"SAVE10"}, false, testNow.Add(24*time.Hour))
+	require.ErrorIs(t, err, errors.ErrResourceUnavailable)
+
+	// 已達總共可使用次數
+	db.coupons[0].MaxRedemptions, db.coupons[0].RedeemedCount = 5, 5
+	_, err = getRedeemableCoupons(ctx, db, testUserID, []string{"SAVE10"}, false, testNow)
+	require.ErrorIs(t, err, errors.ErrResourceInsufficient)
+
+	db.coupons[0].RedeemedCount = 4
+	coupons, err := getRedeemableCoupons(ctx, db, testUserID, []string{"SAVE10"}, false, testNow)
+	require.NoError(t, err)
+	require.Len(t, coupons, 1)
+	require.Equal(t, int64(2), coupons[0].Promotion.ID)
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+)
+
+// fakeDB 以記憶體實作 service 測試需要的 IDatabase，活動相關的方法由 fakePromotionDB 實作
+// transaction 直接在同一份資料上執行，失敗時不會 rollback
+type fakeDB struct {
+	*fakePromotionDB
+
+	inventories  map[int64]*model.Inventory // Product.ID -> 庫存
+	reservations []*model.Reservation
+
+	products []*model.Product
+	members  map[int64]*model.Member // 用戶ID -> 會員
+	wallets  map[int64]*model.Wallet // 用戶ID -> 錢包
+
+	orders    []*model.Order
+	histories []*model.OrderStatusHistory
+
+	coupons           []*model.Coupon
+	couponRedemptions []*model.CouponRedemption
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		fakePromotionDB: &fakePromotionDB{},
+		inventories:     make(map[int64]*model.Inventory),
+		members:         make(map[int64]*model.Member),
+		wallets:         make(map[int64]*model.Wallet),
+	}
+}
+
+func (db *fakeDB) Transaction(ctx context.Context, callback func(ctx context.Context, txRepo iDB.IDatabase) error) error {
+	return callback(ctx, db)
+}
+
+func (db *fakeDB) UpdateInventory(ctx context.Context, options *query.InventoryOptions, updates *updates.Inventory) error {
+	for _, productID := range options.ProductIDIn {
+		inventory, exist := db.inventories[productID]
+		if !exist {
+			return errors.Wrapf(errors.ErrResourceNotFound, "inventory of product(%d) not found", productID)
+		}
+		inventory.TotalQuantity += updates.TotalQuantity.Delta()
+		inventory.AvailableQuantity += updates.AvailableQuantity.Delta()
+		inventory.ReservedQuantity += updates.ReservedQuantity.Delta()
+	}
+	return nil
+}
+
+func (db *fakeDB) matchReservation(r *model.Reservation, options *query.ReservationOptions) bool {
+	if len(options.IDIn) > 0 && !containsValue(options.IDIn, r.ID) {
+		return false
+	}
+	if len(options.StatusIn) > 0 && !containsValue(options.StatusIn, r.Status) {
+		return false
+	}
+	if options.ExpiredAtLt != nil && !r.ExpiredAt.Before(*options.ExpiredAtLt) {
+		return false
+	}
+	return true
+}
+
+func (db *fakeDB) GetReservation(ctx context.Context, options *query.ReservationOptions) (*model.Reservation, error) {
+	for _, r := range db.reservations {
+		if db.matchReservation(r, options) {
+			return r, nil
+		}
+	}
+	return nil, errors.Wrap(errors.ErrResourceNotFound, "reservation not found")
+}
+
+func (db *fakeDB) ListReservations(ctx context.Context, options *query.ReservationOptions) ([]*model.Reservation, error) {
+	var res = make([]*model.Reservation, 0, len(db.reservations))
+	for _, r := range db.reservations {
+		if db.matchReservation(r, options) {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+func (db *fakeDB) UpdateReservation(ctx context.Context, options *query.ReservationOptions, updates *updates.Reservation) error {
+	for _, r := range db.reservations {
+		if !db.matchReservation(r, options) {
+			continue
+		}
+		if updates.Status != nil {
+			r.Status = *updates.Status
+		}
+		if updates.OrderID != nil {
+			r.OrderID = *updates.OrderID
+		}
+	}
+	return nil
+}
+
+func (db *fakeDB) ListInventories(ctx context.Context, options *query.InventoryOptions) ([]*model.Inventory, error) {
+	var res = make([]*model.Inventory, 0, len(options.ProductIDIn))
+	for _, productID := range options.ProductIDIn {
+		if inventory, exist := db.inventories[productID]; exist {
+			cp := *inventory
+			res = append(res, &cp)
+		}
+	}
+	return res, nil
+}
+
+func (db *fakeDB) ListProducts(ctx context.Context, options *query.ProductOptions) ([]*model.Product, error) {
+	var res = make([]*model.Product, 0, len(db.products))
+	for _, p := range db.products {
+		if len(options.IDIn) > 0 && !containsValue(options.IDIn, p.ID) {
+			continue
+		}
+		cp := *p
+		if options.WithInventory {
+			if inventory, exist := db.inventories[p.ID]; exist {
+				inventoryCp := *inventory
+				cp.Inventory = &inventoryCp
+			}
+		}
+		res = append(res, &cp)
+	}
+	return res, nil
+}
+
+func (db *fakeDB) GetMember(ctx context.Context, options *query.MemberOptions) (*model.Member, error) {
+	for _, userID := range options.UserIDIn {
+		if member, exist := db.members[userID]; exist {
+			return member, nil
+		}
+	}
+	return nil, errors.Wrap(errors.ErrResourceNotFound, "member not found")
+}
+
+func (db *fakeDB) GetWallet(ctx context.Context, options *query.WalletOptions) (*model.Wallet, error) {
+	for userID, wallet := range db.wallets {
+		if len(options.IDIn) > 0 && !containsValue(options.IDIn, wallet.ID) {
+			continue
+		}
+		if len(options.UserIDIn) > 0 && !containsValue(options.UserIDIn, userID) {
+			continue
+		}
+		cp := *wallet
+		return &cp, nil
+	}
+	return nil, errors.Wrap(errors.ErrResourceNotFound, "wallet not found")
+}
+
+func (db *fakeDB) CreateWallet(ctx context.Context, wallet *model.Wallet) error {
+	wallet.ID = int64(len(db.wallets) + 1)
+	cp := *wallet
+	db.wallets[wallet.UserID] = &cp
+	return nil
+}
+
+func (db *fakeDB) UpdateWallet(ctx context.Context, options *query.WalletOptions, updates *updates.Wallet) error {
+	for userID, wallet := range db.wallets {
+		if !containsValue(options.IDIn, wallet.ID) && !containsValue(options.UserIDIn, userID) {
+			continue
+		}
+		if op := updates.TokenOperation; op != nil {
+			if op.Operation == model.NumericOperationAdd {
+				wallet.Token = wallet.Token.Add(op.Token)
+			} else {
+				wallet.Token = wallet.Token.Sub(op.Token)
+			}
+		}
+		if op := updates.PointsOperation; op != nil {
+			if op.Operation == model.NumericOperationAdd {
+				wallet.Points += op.Points
+			} else {
+				wallet.Points -= op.Points
+			}
+		}
+	}
+	return nil
+}
+
+func (db *fakeDB) CreateOrder(ctx context.Context, order *model.Order) error {
+	for i, item := range order.Items {
+		item.ID = int64(len(db.orders)*100 + i + 1)
+	}
+	db.orders = append(db.orders, copyOrder(order))
+	return nil
+}
+
+// copyOrder 複製訂單及訂單詳情，與資料庫相同不會被呼叫端修改
+func copyOrder(order *model.Order) *model.Order {
+	cp := *order
+	cp.Items = make([]*model.OrderItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		itemCp := *item
+		cp.Items = append(cp.Items, &itemCp)
+	}
+	return &cp
+}
+
+func (db *fakeDB) GetOrder(ctx context.Context, options *query.OrderOptions) (*model.Order, error) {
+	for _, order := range db.orders {
+		if containsValue(options.IDIn, order.ID) {
+			return copyOrder(order), nil
+		}
+	}
+	return nil, errors.Wrap(errors.ErrResourceNotFound, "order not found")
+}
+
+func (db *fakeDB) UpdateOrder(ctx context.Context, options *query.OrderOptions, updates *updates.Order) error {
+	for _, order := range db.orders {
+		if containsValue(options.IDIn, order.ID) && updates.Status != nil {
+			order.Status = *updates.Status
+		}
+	}
+	return nil
+}
+
+func (db *fakeDB) UpdateOrderItem(ctx context.Context, options *query.OrderItemOptions, updates *updates.OrderItem) error {
+	for _, order := range db.orders {
+		for _, item := range order.Items {
+			if !containsValue(options.IDIn, item.ID) {
+				continue
+			}
+			item.RefundedQuantity += updates.RefundedQuantity.Delta()
+			if op := updates.RefundedToken; op != nil {
+				item.RefundedToken = item.RefundedToken.Add(op.Token)
+			}
+			if op := updates.RefundedPoints; op != nil {
+				item.RefundedPoints += op.Points
+			}
+		}
+	}
+	return nil
+}
+
+func (db *fakeDB) CreateOrderStatusHistory(ctx context.Context, history *model.OrderStatusHistory) error {
+	db.histories = append(db.histories, history)
+	return nil
+}
+
+func (db *fakeDB) ListCoupons(ctx context.Context, options *query.CouponOptions) ([]*model.Coupon, error) {
+	var res = make([]*model.Coupon, 0, len(db.coupons))
+	for _, c := range db.coupons {
+		if len(options.IDIn) > 0 && !containsValue(options.IDIn, c.ID) {
+			continue
+		}
+		if len(options.CodeIn) > 0 && !containsValue(options.CodeIn, c.Code) {
+			continue
+		}
+		if len(options.PromotionIDIn) > 0 && !containsValue(options.PromotionIDIn, c.PromotionID) {
+			continue
+		}
+		cp := *c
+		res = append(res, &cp)
+	}
+	return res, nil
+}
+
+func (db *fakeDB) UpdateCoupon(ctx context.Context, options *query.CouponOptions, updates *updates.Coupon) error {
+	for _, c := range db.coupons {
+		if containsValue(options.IDIn, c.ID) {
+			c.RedeemedCount += updates.RedeemedCount.Delta()
+		}
+	}
+	return nil
+}
+
+func (db *fakeDB) CreateCouponRedemption(ctx context.Context, redemption *model.CouponRedemption) error {
+	db.couponRedemptions = append(db.couponRedemptions, redemption)
+	return nil
+}
+
+func (db *fakeDB) ListCouponRedemptions(ctx context.Context, options *query.CouponRedemptionOptions) ([]*model.CouponRedemption, error) {
+	var res = make([]*model.CouponRedemption, 0, len(db.couponRedemptions))
+	for _, r := range db.couponRedemptions {
+		if len(options.CouponIDIn) > 0 && !containsValue(options.CouponIDIn, r.CouponID) {
+			continue
+		}
+		if len(options.UserIDIn) > 0 && !containsValue(options.UserIDIn, r.UserID) {
+			continue
+		}
+		if len(options.OrderIDIn) > 0 && !containsValue(options.OrderIDIn, r.OrderID) {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func (db *fakeDB) DeleteCouponRedemptions(ctx context.Context, options *query.CouponRedemptionOptions) error {
+	var res = make([]*model.CouponRedemption, 0, len(db.couponRedemptions))
+	for _, r := range db.couponRedemptions {
+		if !containsValue(options.OrderIDIn, r.OrderID) {
+			res = append(res, r)
+		}
+	}
+	db.couponRedemptions = res
+	return nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+	"context"
+)
+
+// Restock 進貨，同時增加總庫存及可售庫存
+func (s *service) Restock(ctx context.Context, productID int64, quantity int32, referenceID string, operatorID int64) error {
+	if quantity <= 0 {
+		return errors.Wrapf(errors.ErrInvalidInput, "restock quantity %d must be positive", quantity)
+	}
+
+	return s.adjustInventory(ctx, productID, quantity, quantity, &updates.Inventory{
+		Cause:       model.StockMovementCauseRestock,
+		ReferenceID: referenceID,
+		OperatorID:  operatorID,
+	})
+}
+
+// AdjustStock 人工校正總庫存及可售庫存，負數為扣除
+func (s *service) AdjustStock(ctx context.Context, productID int64, totalDelta, availableDelta int32, note string, operatorID int64) error {
+	if totalDelta == 0 && availableDelta == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "nothing to adjust")
+	}
+	if note == "" {
+		return errors.Wrap(errors.ErrInvalidInput, "note is required for stock adjustment")
+	}
+
+	return s.adjustInventory(ctx, productID, totalDelta, availableDelta, &updates.Inventory{
+		Cause:      model.StockMovementCauseManualCorrection,
+		OperatorID: operatorID,
+		Note:       note,
+	})
+}
+
+// ListStockMovements 取得商品的庫存異動紀錄
+func (s *service) ListStockMovements(ctx context.Context, productID int64) ([]*model.StockMovement, error) {
+	return s.db.ListStockMovements(ctx, &query.StockMovementOptions{
+		ProductIDIn: []int64{productID},
+	})
+}
+
+// adjustInventory 在 transaction 內異動商品庫存
+// 異動後的庫存不可小於 0，且可售庫存加上保留庫存不可大於總庫存
+func (s *service) adjustInventory(ctx context.Context, productID int64, totalDelta, availableDelta int32, updatesInventory *updates.Inventory) error {
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		inventories, err := txRepo.ListInventories(txCtx, &query.InventoryOptions{
+			ProductIDIn: []int64{productID},
+			Lock:        true,
+		})
+		if err != nil {
+			return err
+		}
+		if len(inventories) == 0 {
+			return errors.Wrapf(errors.ErrResourceNotFound, "inventory of product(%d) not found", productID)
+		}
+
+		var (
+			inventory = inventories[0]
+			total     = inventory.TotalQuantity + totalDelta
+			available = inventory.AvailableQuantity + availableDelta
+		)
+		if total < 0 || available < 0 {
+			return errors.Wrapf(errors.ErrInsufficientBalance,
+				"product(%d) stock can not be negative, total: %d, available: %d", productID, total, available,
+			)
+		}
+		if available+inventory.ReservedQuantity > total {
+			return errors.Wrapf(errors.ErrInvalidInput,
+				"product(%d) available %d + reserved %d exceeds total %d",
+				productID, available, inventory.ReservedQuantity, total,
+			)
+		}
+
+		updatesInventory.TotalQuantity = quantityOperation(totalDelta)
+		updatesInventory.AvailableQuantity = quantityOperation(availableDelta)
+
+		return txRepo.UpdateInventory(txCtx, &query.InventoryOptions{ProductIDIn: []int64{productID}}, updatesInventory)
+	})
+}
+
+// quantityOperation 將異動量轉為 model.QuantityOperation，異動量為 0 時返回 nil
+func quantityOperation(delta int32) *model.QuantityOperation {
+	switch {
+	case delta > 0:
+		return &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: delta}
+	case delta < 0:
+		return &model.QuantityOperation{Operation: model.NumericOperationSub, Quantity: -delta}
+	default:
+		return nil
+	}
+}
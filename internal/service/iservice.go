@@ -3,18 +3,123 @@ package service
 import (
 	"cashier/internal/model"
 	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
 	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type IService interface {
 	IOrderService
 	IPromotionService
+	IWalletService
+	IReservationService
+	IInventoryService
+	IProductService
+	ICategoryService
+	ICouponService
 }
 
 type IOrderService interface {
-	CreateOrder(ctx context.Context, userID int64, points int32, shoppingCart map[int64]int32) (orderID string, err error)
+	// CreateOrder 建立訂單並使用 couponCodes 優惠碼，idempotencyKey 不為空時重送相同的請求不會重複建立訂單
+	CreateOrder(ctx context.Context, userID int64, points int32, shoppingCart map[int64]int32, couponCodes []string, idempotencyKey string) (orderID string, err error)
+	// QuoteOrder 試算訂單金額及套用的優惠，不會異動錢包、庫存、優惠碼及訂單
+	QuoteOrder(ctx context.Context, userID int64, points int32, shoppingCart map[int64]int32, couponCodes []string) (*model.Order, error)
+	// CancelOrder 取消訂單，歸還庫存及優惠的使用次數並全額退款
+	CancelOrder(ctx context.Context, orderID string, operatorID int64, reason string) error
+	// RefundOrderItems 依 OrderItem.ID 及數量部分退款
+	RefundOrderItems(ctx context.Context, orderID string, refundItems map[int64]int32, operatorID int64, reason string) error
+	// FulfillOrder 完成訂單
+	FulfillOrder(ctx context.Context, orderID string, operatorID int64, reason string) error
+	// GetOrder 取得訂單，包含訂單詳情及使用的優惠
+	GetOrder(ctx context.Context, orderID string) (*model.Order, error)
+	// ListOrders 依條件分頁取得訂單，nextCursor 為空表示沒有下一頁
+	ListOrders(ctx context.Context, options query.OrderOptions) (orders []*model.Order, nextCursor string, err error)
+	// ListOrderStatusHistories 取得訂單的狀態變更紀錄
+	ListOrderStatusHistories(ctx context.Context, orderID string) ([]*model.OrderStatusHistory, error)
 }
 
 type IPromotionService interface {
 	ListPromotions(ctx context.Context, promotion query.PromotionOptions) ([]*model.Promotion, error)
+	// CreatePromotion 建立草稿狀態的優惠活動
+	CreatePromotion(ctx context.Context, promotion *model.Promotion) (*model.Promotion, error)
+	// UpdatePromotion 修改優惠活動，修改活動內容時會建立新的版本
+	UpdatePromotion(ctx context.Context, promotionID int64, updatesPromotion *updates.Promotion) error
+	// PublishPromotion 發布草稿狀態的優惠活動
+	PublishPromotion(ctx context.Context, promotionID int64) error
+	// ArchivePromotion 封存優惠活動
+	ArchivePromotion(ctx context.Context, promotionID int64) error
+	// ClonePromotion 複製優惠活動為新的草稿，name 為空時沿用原本的名稱
+	ClonePromotion(ctx context.Context, promotionID int64, name string) (*model.Promotion, error)
+	// ListPromotionVersions 取得優惠活動所有版本的活動內容
+	ListPromotionVersions(ctx context.Context, promotionID int64) ([]*model.PromotionVersion, error)
+	// SyncPromotionStatuses 依目前時間更新已開始及已結束的活動狀態
+	SyncPromotionStatuses(ctx context.Context) error
+	// RunPromotionScheduler 定期同步活動狀態，直到 ctx 結束
+	RunPromotionScheduler(ctx context.Context, interval time.Duration)
+}
+
+type IWalletService interface {
+	// TopUp 儲值平台幣，用戶沒有錢包時會建立
+	TopUp(ctx context.Context, userID int64, token decimal.Decimal, reasonCode string, operatorID int64) (*model.Wallet, error)
+	// GrantPoints 發放平台點數，用戶沒有錢包時會建立
+	GrantPoints(ctx context.Context, userID int64, points int32, reasonCode string, operatorID int64) (*model.Wallet, error)
+	// AdminAdjust 管理員調整平台幣及平台點數，負數為扣除，餘額不可小於 0
+	AdminAdjust(ctx context.Context, userID int64, tokenDelta decimal.Decimal, pointsDelta int32, reasonCode string, operatorID int64) (*model.Wallet, error)
+}
+
+type IReservationService interface {
+	// ReserveInventory 保留購物車商品的庫存 ttl 時間，返回保留單
+	ReserveInventory(ctx context.Context, userID int64, shoppingCart map[int64]int32, ttl time.Duration) (*model.Reservation, error)
+	// ConfirmReservation 確認保留單並建立訂單，返回訂單ID
+	ConfirmReservation(ctx context.Context, reservationID string, points int32) (orderID string, err error)
+	// ReleaseReservation 釋放保留單，歸還可售庫存
+	ReleaseReservation(ctx context.Context, reservationID string) error
+	// ReleaseExpiredReservations 釋放已過期的保留單，返回釋放的數量
+	ReleaseExpiredReservations(ctx context.Context) (released int, err error)
+	// RunReservationSweeper 每隔 interval 釋放已過期的保留單，直到 ctx 結束
+	RunReservationSweeper(ctx context.Context, interval time.Duration)
+}
+
+type IInventoryService interface {
+	// Restock 進貨，增加總庫存及可售庫存，referenceID 為進貨單號
+	Restock(ctx context.Context, productID int64, quantity int32, referenceID string, operatorID int64) error
+	// AdjustStock 人工校正總庫存及可售庫存，負數為扣除，note 為必填
+	AdjustStock(ctx context.Context, productID int64, totalDelta, availableDelta int32, note string, operatorID int64) error
+	// ListStockMovements 取得商品的庫存異動紀錄
+	ListStockMovements(ctx context.Context, productID int64) ([]*model.StockMovement, error)
+}
+
+type IProductService interface {
+	// CreateProduct 建立下架狀態的商品及庫存，quantity 為初始庫存
+	CreateProduct(ctx context.Context, name string, price decimal.Decimal, quantity int32, operatorID int64) (*model.Product, error)
+	// UpdateProduct 更新商品名稱及價格，nil 表示不更新
+	UpdateProduct(ctx context.Context, productID int64, name *string, price *decimal.Decimal) (*model.Product, error)
+	// ShelveProduct 上架商品，商品必須是下架狀態
+	ShelveProduct(ctx context.Context, productID int64) error
+	// UnshelveProduct 下架商品，商品必須是上架狀態
+	UnshelveProduct(ctx context.Context, productID int64) error
+	// GetProduct 取得商品，包含商品的庫存
+	GetProduct(ctx context.Context, productID int64) (*model.Product, error)
+	// ListProducts 依條件分頁取得商品，nextCursor 為空表示沒有下一頁
+	ListProducts(ctx context.Context, options query.ProductOptions) (products []*model.Product, nextCursor string, err error)
+}
+
+type ICategoryService interface {
+	// CreateCategory 建立商品分類，parentID 為 0 時建立最上層分類
+	CreateCategory(ctx context.Context, name string, parentID int64) (*model.Category, error)
+	// ListCategories 取得 parentID 下一層的商品分類
+	ListCategories(ctx context.Context, parentID int64) ([]*model.Category, error)
+	// SetProductCategory 設定商品分類，categoryID 為 0 時移除商品分類
+	SetProductCategory(ctx context.Context, productID, categoryID int64) error
+	// SetProductTags 設定商品標籤，會取代原本的標籤
+	SetProductTags(ctx context.Context, productID int64, tags []string) error
+}
+
+type ICouponService interface {
+	// GenerateCoupons 依 template 的活動、使用次數及到期時間批次產生 count 個不重複的優惠碼
+	GenerateCoupons(ctx context.Context, template *model.Coupon, count int, prefix string) ([]*model.Coupon, error)
+	// ListCoupons 取得活動的優惠碼
+	ListCoupons(ctx context.Context, promotionID int64) ([]*model.Coupon, error)
 }
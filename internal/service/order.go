@@ -7,133 +7,734 @@ import (
 	"cashier/internal/pkg/errors"
 	iDB "cashier/internal/repository/database"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/rs/xid"
 
 	"github.com/shopspring/decimal"
 )
 
-// CreateOrder 建立訂單，返回最終訂單金額
-func (s *service) CreateOrder(ctx context.Context, userID int64, points int32, shoppingCart map[int64]int32) (orderID string, err error) {
-	order := &model.Order{
-		ID:         xid.New().String(),
-		UserID:     userID,
-		UsedPoints: points,
+// orderIdempotencyProcessingTTL 冪等紀錄處理中超過這個時間視為第一次請求已中斷，重送的請求可以接手處理
+const orderIdempotencyProcessingTTL = time.Minute
+
+// CreateOrder 建立訂單，返回訂單ID
+// couponCodes 為使用的優惠碼，在建立訂單的 transaction 內檢查並紀錄使用
+// idempotencyKey 不為空時，相同的 key 及購物車重送會返回第一次請求的訂單ID或錯誤，
+// 相同的 key 搭配不同的購物車則返回 errors.ErrInvalidInput
+func (s *service) CreateOrder(ctx context.Context, userID int64, points int32, shoppingCart map[int64]int32, couponCodes []string, idempotencyKey string) (orderID string, err error) {
+	req := &orderRequest{
+		userID:       userID,
+		points:       points,
+		shoppingCart: shoppingCart,
+		couponCodes:  normalizeCouponCodes(couponCodes),
 	}
 
-	// 清算購物車 (取得原始總金額 & 商品清單)
-	var products []*model.Product
-	order.OriginalPrice, products, err = s.CalculateShoppingCart(ctx, shoppingCart)
+	if idempotencyKey == "" {
+		return s.createOrder(ctx, req, nil)
+	}
+
+	key := &model.OrderIdempotencyKey{
+		UserID:      userID,
+		Key:         idempotencyKey,
+		RequestHash: hashOrderRequest(req),
+	}
+	if err := s.db.CreateOrderIdempotencyKey(ctx, key); err != nil {
+		if !errors.Is(err, errors.ErrResourceAlreadyExists) {
+			return "", err
+		}
+		// 重送的請求，第一次請求中斷時接手建立訂單
+		orderID, takeover, err := s.replayOrderRequest(ctx, key)
+		if !takeover {
+			return orderID, err
+		}
+	}
+
+	orderID, err = s.createOrder(ctx, req, key)
 	if err != nil {
+		s.saveOrderRequestError(ctx, key, err)
 		return "", err
 	}
 
-	// 紀錄該訂單關聯的商品
-	var productIDs = make([]int64, 0, len(products))
-	for _, product := range products {
-		order.Items = append(order.Items, model.NewOrderItem(order.ID, product, shoppingCart[product.ID]))
-		productIDs = append(productIDs, product.ID)
+	return orderID, nil
+}
+
+// replayOrderRequest 返回相同冪等鍵第一次請求的結果
+// 第一次請求處理中超過 orderIdempotencyProcessingTTL 時，以 key 重新建立冪等紀錄並返回 takeover 為 true，由呼叫端建立訂單
+func (s *service) replayOrderRequest(ctx context.Context, key *model.OrderIdempotencyKey) (orderID string, takeover bool, err error) {
+	stored, err := s.db.GetOrderIdempotencyKey(ctx, &query.OrderIdempotencyKeyOptions{
+		UserIDIn: []int64{key.UserID},
+		KeyIn:    []string{key.Key},
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	switch {
+	case stored.RequestHash != key.RequestHash:
+		return "", false, errors.Wrapf(errors.ErrInvalidInput, "idempotency key %s is reused with a different shopping cart", key.Key)
+	case stored.OrderID != "":
+		return stored.OrderID, false, nil
+	case stored.ErrorCode != "" && stored.ErrorMessage == "":
+		return "", false, errors.WithStack(errors.FromCode(stored.ErrorCode))
+	case stored.ErrorCode != "":
+		return "", false, errors.Wrap(errors.FromCode(stored.ErrorCode), stored.ErrorMessage)
+	}
+
+	processingErr := errors.Wrapf(errors.ErrResourceUnavailable, "request with idempotency key %s is processing", key.Key)
+
+	// 第一次請求尚未完成
+	staleBefore := s.now().Add(-orderIdempotencyProcessingTTL)
+	if !stored.UpdatedAt.Before(staleBefore) {
+		return "", false, processingErr
+	}
+
+	// 第一次請求已中斷，只刪除仍在處理中且逾時的紀錄，同時有其他請求接手或第一次請求剛完成時不會刪除
+	if err := s.db.DeleteOrderIdempotencyKey(ctx, &query.OrderIdempotencyKeyOptions{
+		IDIn:        []int64{stored.ID},
+		Processing:  true,
+		UpdatedAtLt: &staleBefore,
+	}); err != nil {
+		return "", false, err
+	}
+	if err := s.db.CreateOrderIdempotencyKey(ctx, key); err != nil {
+		if errors.Is(err, errors.ErrResourceAlreadyExists) {
+			return "", false, processingErr
+		}
+		return "", false, err
+	}
+
+	return "", true, nil
+}
+
+// saveOrderRequestError 紀錄建立訂單失敗的結果
+// 伺服器錯誤不紀錄並刪除冪等紀錄，讓客戶端可以重試
+// 只更新這次請求建立的紀錄，紀錄已被其他請求接手時不覆蓋
+func (s *service) saveOrderRequestError(ctx context.Context, key *model.OrderIdempotencyKey, err error) {
+	options := &query.OrderIdempotencyKeyOptions{IDIn: []int64{key.ID}}
+
+	if errors.HTTPStatus(err) >= http.StatusInternalServerError {
+		_ = s.db.DeleteOrderIdempotencyKey(ctx, options)
+		return
+	}
+
+	// 只保留包裝的訊息，重送時再包裝回相同的錯誤
+	code := errors.Code(err)
+	message := strings.TrimSuffix(strings.TrimSuffix(err.Error(), errors.Cause(err).Error()), ": ")
+	_ = s.db.UpdateOrderIdempotencyKey(ctx, options, &updates.OrderIdempotencyKey{
+		ErrorCode:    &code,
+		ErrorMessage: &message,
+	})
+}
+
+// hashOrderRequest 計算建立訂單請求內容的雜湊
+func hashOrderRequest(req *orderRequest) string {
+	var productIDs = make([]int64, 0, len(req.shoppingCart))
+	for id := range req.shoppingCart {
+		productIDs = append(productIDs, id)
 	}
+	sort.Slice(productIDs, func(i, j int) bool { return productIDs[i] < productIDs[j] })
 
-	// 返回符合條件的優惠 & 優惠後的訂單金額
-	order.FinalPrice, order.PromotionIDs, err = s.CalculateDiscountPrice(ctx, order)
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "points:%d;", req.points)
+	for _, id := range productIDs {
+		_, _ = fmt.Fprintf(h, "%d:%d;", id, req.shoppingCart[id])
+	}
+
+	// 優惠碼的順序會影響計算結果，依原本的順序計算
+	for _, code := range req.couponCodes {
+		_, _ = fmt.Fprintf(h, "coupon:%s;", code)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// createOrder 建立訂單，key 不為空時在同一個 transaction 內紀錄訂單ID
+// 冪等紀錄在 transaction 開始時鎖定，紀錄已被重送的請求接手時不建立訂單
+func (s *service) createOrder(ctx context.Context, req *orderRequest, key *model.OrderIdempotencyKey) (orderID string, err error) {
+	order, err := s.newOrder(ctx, xid.New().String(), req)
 	if err != nil {
 		return "", err
 	}
 
 	//  建立訂單
 	err = s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
-		// 取得用戶錢包
-		wallet, err := txRepo.GetWallet(txCtx, &query.WalletOptions{
-			UserIDIn: []int64{userID},
-			Lock:     true,
-		})
-		if err != nil {
+		if key != nil {
+			if _, err := txRepo.GetOrderIdempotencyKey(txCtx, &query.OrderIdempotencyKeyOptions{
+				IDIn: []int64{key.ID},
+				Lock: true,
+			}); err != nil {
+				if errors.Is(err, errors.ErrResourceNotFound) {
+					return errors.Wrapf(errors.ErrResourceUnavailable, "request with idempotency key %s is taken over", key.Key)
+				}
+				return err
+			}
+		}
+
+		if err := s.placeOrder(txCtx, txRepo, order, nil); err != nil {
 			return err
 		}
 
-		var updatesWallet = updates.Wallet{}
+		// 紀錄使用的優惠碼
+		if err := redeemCoupons(txCtx, txRepo, order, s.now()); err != nil {
+			return err
+		}
 
-		// 檢查錢包的平台幣餘額是否足夠
-		if order.FinalPrice.GreaterThan(wallet.Token) {
-			return errors.Wrapf(errors.ErrInsufficientBalance,
-				"Insufficient token, order token %d is greater than wallet token %d", order.FinalPrice, wallet.Token,
+		// 紀錄冪等鍵對應的訂單
+		if key != nil {
+			return txRepo.UpdateOrderIdempotencyKey(txCtx,
+				&query.OrderIdempotencyKeyOptions{IDIn: []int64{key.ID}},
+				&updates.OrderIdempotencyKey{OrderID: &order.ID},
 			)
 		}
 
-		updatesWallet.TokenOperation = &model.TokenOperation{
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return order.ID, nil
+}
+
+// placeOrder 扣款、扣庫存並寫入訂單，必須在 transaction 內執行
+// reservation 不為空時，扣除該保留單已保留的庫存，否則扣除可售庫存
+func (s *service) placeOrder(ctx context.Context, txRepo iDB.IDatabase, order *model.Order, reservation *model.Reservation) error {
+	// 建立訂單時同時扣款，因此訂單為已付款
+	order.Status = model.OrderStatusPaid
+
+	// 取得用戶錢包
+	wallet, err := txRepo.GetWallet(ctx, &query.WalletOptions{
+		UserIDIn: []int64{order.UserID},
+		Lock:     true,
+	})
+	if err != nil {
+		return err
+	}
+
+	var updatesWallet = updates.Wallet{
+		OrderID: order.ID,
+		Reason:  model.WalletTransactionReasonOrderPayment,
+	}
+
+	// 檢查錢包的平台幣餘額是否足夠
+	if order.FinalPrice.GreaterThan(wallet.Token) {
+		return errors.Wrapf(errors.ErrInsufficientBalance,
+			"Insufficient token, order token %s is greater than wallet token %s", order.FinalPrice, wallet.Token,
+		)
+	}
+
+	updatesWallet.TokenOperation = &model.TokenOperation{
+		Operation: model.NumericOperationSub,
+		Token:     order.FinalPrice,
+	}
+
+	// 訂單有使用到平台點數，則檢查
+	if order.UsedPoints > 0 {
+		if order.UsedPoints > wallet.Points {
+			return errors.Wrapf(errors.ErrInsufficientBalance,
+				"Insufficient point, order point %d is greater than wallet point %d", order.UsedPoints, wallet.Points,
+			)
+		}
+		updatesWallet.PointsOperation = &model.PointOperation{
 			Operation: model.NumericOperationSub,
-			Token:     order.FinalPrice,
+			Points:    order.UsedPoints,
 		}
+	}
 
-		// 訂單有使用到平台點數，則檢查
-		if order.UsedPoints > 0 {
-			if order.UsedPoints > wallet.Points {
-				return errors.Wrapf(errors.ErrInsufficientBalance,
-					"Insufficient point, order point %d is greater than wallet point %d", order.UsedPoints, wallet.Points,
-				)
-			}
-			updatesWallet.PointsOperation = &model.PointOperation{
-				Operation: model.NumericOperationSub,
-				Points:    order.UsedPoints,
+	// 更新用戶錢包 (扣錢 + 扣點數)
+	if err := txRepo.UpdateWallet(ctx,
+		&query.WalletOptions{IDIn: []int64{wallet.ID}},
+		&updatesWallet,
+	); err != nil {
+		return err
+	}
+
+	if reservation == nil {
+		// 檢查 & 扣除可售庫存
+		if err := deductAvailableInventories(ctx, txRepo, order.Items); err != nil {
+			return err
+		}
+	} else {
+		// 扣除保留的庫存
+		for i := range order.Items {
+			if err := txRepo.UpdateInventory(ctx,
+				&query.InventoryOptions{ProductIDIn: []int64{order.Items[i].ProductID}},
+				&updates.Inventory{
+					ReservedQuantity: &model.QuantityOperation{
+						Operation: model.NumericOperationSub,
+						Quantity:  order.Items[i].Quantity,
+					},
+					Cause:       model.StockMovementCauseSale,
+					ReferenceID: order.ID,
+					OperatorID:  model.OperatorSystem,
+				},
+			); err != nil {
+				return err
 			}
 		}
+	}
 
-		// 更新用戶錢包 (扣錢 + 扣點數)
-		if err := txRepo.UpdateWallet(txCtx,
-			&query.WalletOptions{IDIn: []int64{wallet.ID}},
-			&updatesWallet,
+	// 建立訂單 & 訂單詳情
+	if err := txRepo.CreateOrder(ctx, order); err != nil {
+		return err
+	}
+
+	// 檢查 & 紀錄優惠活動的使用限制
+	if err := redeemPromotions(ctx, txRepo, order); err != nil {
+		return err
+	}
+
+	// 紀錄訂單建立的狀態
+	return txRepo.CreateOrderStatusHistory(ctx, &model.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: model.OrderStatusUnknown,
+		ToStatus:   order.Status,
+		OperatorID: model.OperatorSystem,
+		Reason:     "order created",
+	})
+}
+
+// deductAvailableInventories 鎖定並檢查商品可售庫存，足夠時扣除購買數量
+func deductAvailableInventories(ctx context.Context, txRepo iDB.IDatabase, items []*model.OrderItem) error {
+	var (
+		productIDs = make([]int64, 0, len(items))
+		quantities = make(map[int64]int32, len(items))
+	)
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	// 檢查商品庫存
+	inventories, err := txRepo.ListInventories(ctx, &query.InventoryOptions{
+		ProductIDIn: productIDs,
+		Lock:        true,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range inventories {
+		// 商品庫存必須大於等於購買數量
+		if inventories[i].AvailableQuantity < quantities[inventories[i].ProductID] {
+			return errors.Wrapf(errors.ErrInsufficientBalance,
+				"productID(%d) is out of stock. %d < %d",
+				inventories[i].ProductID, inventories[i].AvailableQuantity, quantities[inventories[i].ProductID],
+			)
+		}
+	}
+
+	// 更新庫存
+	for i := range items {
+		if err := txRepo.UpdateInventory(ctx,
+			&query.InventoryOptions{ProductIDIn: []int64{items[i].ProductID}},
+			&updates.Inventory{
+				AvailableQuantity: &model.QuantityOperation{
+					Operation: model.NumericOperationSub,
+					Quantity:  items[i].Quantity,
+				},
+				Cause:       model.StockMovementCauseSale,
+				ReferenceID: items[i].OrderID,
+				OperatorID:  model.OperatorSystem,
+			},
 		); err != nil {
 			return err
 		}
+	}
 
-		// 檢查商品庫存
-		inventories, err := txRepo.ListInventories(txCtx, &query.InventoryOptions{
-			ProductIDIn: productIDs,
-			Lock:        true,
+	return nil
+}
+
+// CancelOrder 取消訂單，歸還庫存、優惠活動及優惠碼的使用次數，並全額退回平台幣及平台點數
+// 已取消或已完成的訂單會返回 errors.ErrResourceUnavailable
+func (s *service) CancelOrder(ctx context.Context, orderID string, operatorID int64, reason string) error {
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		// 鎖定訂單，避免重複取消
+		order, err := txRepo.GetOrder(txCtx, &query.OrderOptions{
+			IDIn:      []string{orderID},
+			Lock:      true,
+			WithItems: true,
 		})
 		if err != nil {
 			return err
 		}
 
-		for i := range inventories {
-			// 商品庫存必須大於等於購買數量
-			if inventories[i].AvailableQuantity < shoppingCart[products[i].ID] {
-				return errors.Wrapf(errors.ErrInsufficientBalance,
-					"productID(%d) is out of stock. %d < %d", inventories[i].AvailableQuantity, shoppingCart[products[i].ID],
-				)
-			}
+		if !order.Status.CanTransitTo(model.OrderStatusCancelled) {
+			return errors.Wrapf(errors.ErrResourceUnavailable,
+				"order(%s) status is %s, cannot be cancelled", order.ID, order.Status.Str(),
+			)
 		}
 
-		// 更新庫存
+		// 歸還庫存
 		for i := range order.Items {
 			if err := txRepo.UpdateInventory(txCtx,
 				&query.InventoryOptions{ProductIDIn: []int64{order.Items[i].ProductID}},
-				&updates.Inventory{AvailableQuantity: &model.QuantityOperation{
-					Operation: model.NumericOperationSub,
-					Quantity:  order.Items[i].Quantity,
-				}},
+				&updates.Inventory{
+					AvailableQuantity: &model.QuantityOperation{
+						Operation: model.NumericOperationAdd,
+						Quantity:  order.Items[i].Quantity,
+					},
+					Cause:       model.StockMovementCauseRefund,
+					ReferenceID: order.ID,
+					OperatorID:  operatorID,
+					Note:        reason,
+				},
 			); err != nil {
 				return err
 			}
 		}
 
-		// 建立訂單 & 訂單詳情
-		if err := txRepo.CreateOrder(txCtx, order); err != nil {
+		// 已付款的訂單，退回平台幣 & 平台點數
+		if order.Status == model.OrderStatusPaid {
+			var updatesWallet = updates.Wallet{
+				TokenOperation: &model.TokenOperation{
+					Operation: model.NumericOperationAdd,
+					Token:     order.FinalPrice,
+				},
+				OrderID: order.ID,
+				Reason:  model.WalletTransactionReasonOrderRefund,
+			}
+			if order.UsedPoints > 0 {
+				updatesWallet.PointsOperation = &model.PointOperation{
+					Operation: model.NumericOperationAdd,
+					Points:    order.UsedPoints,
+				}
+			}
+
+			if err := txRepo.UpdateWallet(txCtx,
+				&query.WalletOptions{UserIDIn: []int64{order.UserID}},
+				&updatesWallet,
+			); err != nil {
+				return err
+			}
+		}
+
+		// 歸還優惠活動 & 優惠碼的使用次數
+		if err := releasePromotions(txCtx, txRepo, order); err != nil {
+			return err
+		}
+		if err := releaseCoupons(txCtx, txRepo, order); err != nil {
 			return err
 		}
 
+		// 更新訂單狀態
+		return transitOrderStatus(txCtx, txRepo, order, model.OrderStatusCancelled, operatorID, reason)
+	})
+}
+
+// RefundOrderItems 部分退款，refundItems 為 OrderItem.ID 對應退款數量
+// 依各商品分攤後的金額退回平台幣及平台點數並歸還庫存
+func (s *service) RefundOrderItems(ctx context.Context, orderID string, refundItems map[int64]int32, operatorID int64, reason string) error {
+	if len(refundItems) == 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "refund items is empty")
+	}
+
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		// 鎖定訂單，避免重複退款
+		order, err := txRepo.GetOrder(txCtx, &query.OrderOptions{
+			IDIn:      []string{orderID},
+			Lock:      true,
+			WithItems: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !order.Status.CanTransitTo(model.OrderStatusPartiallyRefunded) {
+			return errors.Wrapf(errors.ErrResourceUnavailable,
+				"order(%s) status is %s, cannot be refunded", order.ID, order.Status.Str(),
+			)
+		}
+
+		var (
+			itemMap       = make(map[int64]*model.OrderItem, len(order.Items))
+			refundToken   = decimal.Zero
+			refundPoints  int32
+			fullyRefunded = true
+		)
+		for _, item := range order.Items {
+			itemMap[item.ID] = item
+		}
+
+		for itemID, quantity := range refundItems {
+			item, exist := itemMap[itemID]
+			if !exist {
+				return errors.Wrapf(errors.ErrResourceNotFound, "order(%s) has no item(%d)", order.ID, itemID)
+			}
+			if quantity <= 0 || quantity > item.RefundableQuantity() {
+				return errors.Wrapf(errors.ErrInvalidInput,
+					"item(%d) refund quantity %d is invalid, refundable quantity is %d", itemID, quantity, item.RefundableQuantity(),
+				)
+			}
+
+			token, points := item.RefundAmount(quantity)
+			refundToken = refundToken.Add(token)
+			refundPoints += points
+
+			// 紀錄商品已退款的數量 & 金額
+			if err := txRepo.UpdateOrderItem(txCtx,
+				&query.OrderItemOptions{IDIn: []int64{item.ID}},
+				&updates.OrderItem{
+					RefundedQuantity: &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: quantity},
+					RefundedToken:    &model.TokenOperation{Operation: model.NumericOperationAdd, Token: token},
+					RefundedPoints:   &model.PointOperation{Operation: model.NumericOperationAdd, Points: points},
+				},
+			); err != nil {
+				return err
+			}
+			item.RefundedQuantity += quantity
+
+			// 歸還庫存
+			if err := txRepo.UpdateInventory(txCtx,
+				&query.InventoryOptions{ProductIDIn: []int64{item.ProductID}},
+				&updates.Inventory{
+					AvailableQuantity: &model.QuantityOperation{
+						Operation: model.NumericOperationAdd,
+						Quantity:  quantity,
+					},
+					Cause:       model.StockMovementCauseRefund,
+					ReferenceID: order.ID,
+					OperatorID:  operatorID,
+					Note:        reason,
+				},
+			); err != nil {
+				return err
+			}
+		}
+
+		for _, item := range order.Items {
+			if item.RefundableQuantity() > 0 {
+				fullyRefunded = false
+				break
+			}
+		}
+
+		// 退回平台幣 & 平台點數
+		var updatesWallet = updates.Wallet{
+			TokenOperation: &model.TokenOperation{
+				Operation: model.NumericOperationAdd,
+				Token:     refundToken,
+			},
+			OrderID: order.ID,
+			Reason:  model.WalletTransactionReasonOrderRefund,
+		}
+		if refundPoints > 0 {
+			updatesWallet.PointsOperation = &model.PointOperation{
+				Operation: model.NumericOperationAdd,
+				Points:    refundPoints,
+			}
+		}
+
+		if err := txRepo.UpdateWallet(txCtx,
+			&query.WalletOptions{UserIDIn: []int64{order.UserID}},
+			&updatesWallet,
+		); err != nil {
+			return err
+		}
+
+		// 全額退款時歸還優惠活動 & 優惠碼的使用次數，部分退款時訂單仍有使用優惠
+		status := model.OrderStatusPartiallyRefunded
+		if fullyRefunded {
+			status = model.OrderStatusRefunded
+			if err := releasePromotions(txCtx, txRepo, order); err != nil {
+				return err
+			}
+			if err := releaseCoupons(txCtx, txRepo, order); err != nil {
+				return err
+			}
+		}
+
+		// 更新訂單狀態
+		return transitOrderStatus(txCtx, txRepo, order, status, operatorID, reason)
+	})
+}
+
+// GetOrder 取得訂單，包含訂單詳情及使用的優惠
+func (s *service) GetOrder(ctx context.Context, orderID string) (*model.Order, error) {
+	order, err := s.db.GetOrder(ctx, &query.OrderOptions{
+		IDIn:      []string{orderID},
+		WithItems: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.fillOrderPromotions(ctx, []*model.Order{order}); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// ListOrders 取得多筆訂單，包含訂單詳情及使用的優惠
+// 返回的 nextCursor 為下一頁的 query.OrderOptions.Cursor，沒有下一頁時為空
+func (s *service) ListOrders(ctx context.Context, options query.OrderOptions) (orders []*model.Order, nextCursor string, err error) {
+	if options.Limit <= 0 {
+		options.Limit = defaultListLimit
+	}
+	if options.Limit > maxListLimit {
+		options.Limit = maxListLimit
+	}
+	options.Lock = false
+	options.WithItems = true
+
+	orders, err = s.db.ListOrders(ctx, &options)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.fillOrderPromotions(ctx, orders); err != nil {
+		return nil, "", err
+	}
+
+	if len(orders) == options.Limit {
+		nextCursor = orders[len(orders)-1].ID
+	}
+
+	return orders, nextCursor, nil
+}
+
+// fillOrderPromotions 依訂單的 PromotionIDs 查詢並填入 Promotions
+// 活動內容為訂單計算時的版本，不受之後的修改影響
+func (s *service) fillOrderPromotions(ctx context.Context, orders []*model.Order) error {
+	var (
+		promotionIDs = make([]int64, 0)
+		versionNums  = make([]int32, 0)
+	)
+	for _, order := range orders {
+		promotionIDs = append(promotionIDs, order.PromotionIDs...)
+		for _, step := range order.PriceBreakdown {
+			versionNums = append(versionNums, step.PromotionVersion)
+		}
+	}
+	if len(promotionIDs) == 0 {
 		return nil
+	}
+
+	promotions, err := s.db.ListPromotions(ctx, &query.PromotionOptions{IDIn: promotionIDs})
+	if err != nil {
+		return err
+	}
+
+	versions, err := s.db.ListPromotionVersions(ctx, &query.PromotionVersionOptions{
+		PromotionIDIn: promotionIDs,
+		VersionIn:     versionNums,
 	})
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	return order.ID, nil
+	var (
+		promotionMap = make(map[int64]*model.Promotion, len(promotions))
+		versionMap   = make(map[int64]map[int32]*model.PromotionVersion, len(promotions))
+	)
+	for _, promotion := range promotions {
+		promotionMap[promotion.ID] = promotion
+	}
+	for _, version := range versions {
+		if _, exist := versionMap[version.PromotionID]; !exist {
+			versionMap[version.PromotionID] = make(map[int32]*model.PromotionVersion)
+		}
+		versionMap[version.PromotionID][version.Version] = version
+	}
+
+	for _, order := range orders {
+		// 訂單計算時各活動的版本
+		var orderVersions = make(map[int64]int32, len(order.PromotionIDs))
+		for _, step := range order.PriceBreakdown {
+			if step.SkipReason == "" {
+				orderVersions[step.PromotionID] = step.PromotionVersion
+			}
+		}
+
+		order.Promotions = make([]*model.Promotion, 0, len(order.PromotionIDs))
+		for _, id := range order.PromotionIDs {
+			promotion, exist := promotionMap[id]
+			if !exist {
+				continue
+			}
+
+			if version, exist := versionMap[id][orderVersions[id]]; exist && version.Version != promotion.Version {
+				priced := *promotion
+				priced.Version = version.Version
+				priced.Extension = version.Extension
+				promotion = &priced
+			}
+			order.Promotions = append(order.Promotions, promotion)
+		}
+	}
+
+	return nil
+}
+
+// QuoteOrder 試算訂單，返回包含原始金額、最終金額及套用優惠的訂單
+// 不會異動錢包、庫存及訂單
+func (s *service) QuoteOrder(ctx context.Context, userID int64, points int32, shoppingCart map[int64]int32, couponCodes []string) (*model.Order, error) {
+	return s.newOrder(ctx, "", &orderRequest{
+		userID:       userID,
+		points:       points,
+		shoppingCart: shoppingCart,
+		couponCodes:  normalizeCouponCodes(couponCodes),
+	})
+}
+
+// orderRequest 建立或試算訂單的內容
+type orderRequest struct {
+	userID       int64
+	points       int32
+	shoppingCart map[int64]int32 // Product.ID 對應購買數量
+	couponCodes  []string        // 使用的優惠碼，依順序計算
+
+	// 商品庫存已被保留單保留，不檢查可售庫存
+	reserved bool
+}
+
+// newOrder 清算購物車並計算優惠，返回尚未寫入的訂單
+func (s *service) newOrder(ctx context.Context, orderID string, req *orderRequest) (*model.Order, error) {
+	order := &model.Order{
+		ID:         orderID,
+		UserID:     req.userID,
+		UsedPoints: req.points,
+	}
+
+	// 清算購物車 (取得原始總金額 & 商品清單)
+	originalPrice, products, err := s.CalculateShoppingCart(ctx, req.shoppingCart, !req.reserved)
+	if err != nil {
+		return nil, err
+	}
+	order.OriginalPrice = originalPrice
+
+	// 紀錄該訂單關聯的商品
+	for _, product := range products {
+		order.Items = append(order.Items, model.NewOrderItem(order.ID, product, req.shoppingCart[product.ID]))
+	}
+
+	// 檢查優惠碼是否可以使用
+	coupons, err := getRedeemableCoupons(ctx, s.db, req.userID, req.couponCodes, false, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	// 計算符合條件的優惠 & 優惠後的訂單金額
+	if err := s.CalculateDiscountPrice(ctx, order, products, coupons); err != nil {
+		return nil, err
+	}
+
+	// 將訂單折扣 & 使用的點數分攤到各商品，供部分退款使用
+	order.AllocateItemPrices()
+
+	return order, nil
 }
 
 // CalculateShoppingCart 清算購物車的商品，返回總金額 & 商品
-func (s *service) CalculateShoppingCart(ctx context.Context, purchaseList map[int64]int32) (
+// checkStock 為 true 時檢查商品是否還有可售庫存
+func (s *service) CalculateShoppingCart(ctx context.Context, purchaseList map[int64]int32, checkStock bool) (
 	price decimal.Decimal, products []*model.Product, err error,
 ) {
 
@@ -142,7 +743,10 @@ func (s *service) CalculateShoppingCart(ctx context.Context, purchaseList map[in
 		productIDs = append(productIDs, id)
 	}
 
-	products, err = s.db.ListProducts(ctx, &query.ProductOptions{IDIn: productIDs})
+	products, err = s.db.ListProducts(ctx, &query.ProductOptions{
+		IDIn:          productIDs,
+		WithInventory: true,
+	})
 	if err != nil {
 		return decimal.Zero, nil, err
 	}
@@ -157,7 +761,7 @@ func (s *service) CalculateShoppingCart(ctx context.Context, purchaseList map[in
 		if product.Status != model.ProductStatusOn {
 			return decimal.Zero, nil, errors.Wrapf(errors.ErrResourceUnavailable, "product(%d) status is %s", product.ID, product.Status.Str())
 		}
-		if product.Inventory.AvailableQuantity <= 0 {
+		if checkStock && (product.Inventory == nil || product.Inventory.AvailableQuantity <= 0) {
 			return decimal.Zero, nil, errors.Wrapf(errors.ErrResourceUnavailable, "product(%d) is sold out", product.ID)
 		}
 
@@ -168,38 +772,80 @@ func (s *service) CalculateShoppingCart(ctx context.Context, purchaseList map[in
 	return originalPrice, products, nil
 }
 
-// CalculateDiscountPrice 返回訂單折扣後金額 & 該訂單使用的優惠ID
-func (s *service) CalculateDiscountPrice(ctx context.Context, order *model.Order) (afterPrice decimal.Decimal, promotionIDs []int64, err error) {
-	// 取得用戶的會員等級
-	member, err := s.db.GetMember(ctx, &query.MemberOptions{IDIn: []int64{order.UserID}})
+// CalculateDiscountPrice 依優惠活動計算訂單折扣後金額
+// 並將使用的優惠 & 每個優惠的計算明細紀錄在訂單上
+// products 為訂單商品的資料，用來計算指定分類或標籤的優惠
+// coupons 為使用的優惠碼，在自動套用的優惠之後依序計算
+// 活動的優先順序、獨佔及疊加群組依 s.pricingMode 決定最後套用的組合
+func (s *service) CalculateDiscountPrice(ctx context.Context, order *model.Order, products []*model.Product, coupons []*model.Coupon) error {
+	// 取得用戶的會員等級，用戶不是會員時 member 為 nil
+	member, err := s.db.GetMember(ctx, &query.MemberOptions{UserIDIn: []int64{order.UserID}})
 	if err != nil {
-		return decimal.Zero, nil, err
+		if !errors.Is(err, errors.ErrResourceNotFound) {
+			return err
+		}
+		member = nil
 	}
 
 	// 取得當前的優惠活動
 	promotionMap, err := s.GetCurrPromotionsMap(ctx)
 	if err != nil {
-		return decimal.Zero, nil, err
+		return err
 	}
 
-	// 依優惠活動計算訂單金額 & 紀錄使用的優惠
-	promotionIDs = make([]int64, 0)
-	afterPrice = order.OriginalPrice
-	calPriceInput := &model.CalculatePriceInput{
-		Member:     member,
-		UsedPoints: order.UsedPoints,
+	priceItems, err := s.newPriceItems(ctx, order.Items, products)
+	if err != nil {
+		return err
 	}
 
+	// 自動套用的活動依 ValidPromotionTypes 的順序，同類型的活動依 GetCurrPromotionsMap 的順序
+	// 優惠碼在之後依序計算，再依活動的優先順序排序
+	candidates := make([]*model.PricingCandidate, 0, len(promotionMap)+len(coupons))
+	promotions := make([]*model.Promotion, 0, len(promotionMap)+len(coupons))
 	for _, pType := range model.ValidPromotionTypes {
-		if promotion, exist := promotionMap[pType]; exist {
-			var usedPromotion bool
-			usedPromotion, afterPrice = promotion.Extension.CalculatePrice(afterPrice, calPriceInput)
-			if usedPromotion {
-				// 紀錄這個訂單有用到的優惠
-				promotionIDs = append(promotionIDs, promotion.ID)
-			}
+		for _, promotion := range promotionMap[pType] {
+			candidates = append(candidates, &model.PricingCandidate{Promotion: promotion})
+			promotions = append(promotions, promotion)
+		}
+	}
+	for _, coupon := range coupons {
+		candidates = append(candidates, &model.PricingCandidate{Promotion: coupon.Promotion, CouponCode: coupon.Code})
+		promotions = append(promotions, coupon.Promotion)
+	}
+	model.SortPricingCandidates(candidates)
+
+	// 取得用戶已使用各活動的次數
+	userRedemptions, err := getUserRedemptions(ctx, s.db, order.UserID, promotions)
+	if err != nil {
+		return err
+	}
+
+	// 依優惠活動計算訂單金額 & 紀錄使用的優惠
+	result := model.CalculatePricing(s.pricingMode, order.OriginalPrice, candidates, &model.CalculatePriceInput{
+		Member:          member,
+		UsedPoints:      order.UsedPoints,
+		Items:           priceItems,
+		UserRedemptions: userRedemptions,
+	})
+
+	// 紀錄這個訂單有用到的優惠，只紀錄有套用優惠的優惠碼
+	order.Promotions = make([]*model.Promotion, 0, len(result.Applied))
+	order.PromotionIDs = make([]int64, 0, len(result.Applied))
+	order.PriceBreakdown = result.Steps
+	order.CouponCodes = make([]string, 0, len(coupons))
+	for _, c := range result.Applied {
+		order.Promotions = append(order.Promotions, c.Promotion)
+		order.PromotionIDs = append(order.PromotionIDs, c.Promotion.ID)
+		if c.CouponCode != "" {
+			order.CouponCodes = append(order.CouponCodes, c.CouponCode)
 		}
 	}
+	order.FinalPrice = result.FinalPrice
+
+	// 點數折抵的活動因獨佔、疊加群組或最佳價格沒有套用時，不扣除用戶的點數
+	if !result.PointsApplied() {
+		order.UsedPoints = 0
+	}
 
-	return afterPrice, promotionIDs, nil
+	return nil
 }
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+	"context"
+)
+
+// FulfillOrder 完成訂單
+func (s *service) FulfillOrder(ctx context.Context, orderID string, operatorID int64, reason string) error {
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		order, err := txRepo.GetOrder(txCtx, &query.OrderOptions{
+			IDIn: []string{orderID},
+			Lock: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		return transitOrderStatus(txCtx, txRepo, order, model.OrderStatusFulfilled, operatorID, reason)
+	})
+}
+
+// ListOrderStatusHistories 取得訂單的狀態變更紀錄
+func (s *service) ListOrderStatusHistories(ctx context.Context, orderID string) ([]*model.OrderStatusHistory, error) {
+	return s.db.ListOrderStatusHistories(ctx, &query.OrderStatusHistoryOptions{
+		OrderIDIn: []string{orderID},
+	})
+}
+
+// transitOrderStatus 檢查訂單狀態是否可以轉換，更新訂單狀態並紀錄變更
+// 必須在 transaction 內且訂單已被鎖定
+func transitOrderStatus(ctx context.Context, txRepo iDB.IDatabase, order *model.Order, next model.OrderStatus, operatorID int64, reason string) error {
+	if !order.Status.CanTransitTo(next) {
+		return errors.Wrapf(errors.ErrResourceUnavailable,
+			"order(%s) status cannot transit from %s to %s", order.ID, order.Status.Str(), next.Str(),
+		)
+	}
+
+	if err := txRepo.UpdateOrder(ctx,
+		&query.OrderOptions{IDIn: []string{order.ID}},
+		&updates.Order{Status: &next},
+	); err != nil {
+		return err
+	}
+
+	if err := txRepo.CreateOrderStatusHistory(ctx, &model.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   next,
+		OperatorID: operatorID,
+		Reason:     reason,
+	}); err != nil {
+		return err
+	}
+
+	order.Status = next
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIdempotencyDB 只實作冪等紀錄的 IDatabase，其他方法被呼叫時會 panic
+type fakeIdempotencyDB struct {
+	iDB.IDatabase
+
+	keys   []*model.OrderIdempotencyKey
+	nextID int64
+	now    time.Time
+}
+
+func (db *fakeIdempotencyDB) match(key *model.OrderIdempotencyKey, options *query.OrderIdempotencyKeyOptions) bool {
+	if len(options.IDIn) > 0 && !containsValue(options.IDIn, key.ID) {
+		return false
+	}
+	if len(options.UserIDIn) > 0 && !containsValue(options.UserIDIn, key.UserID) {
+		return false
+	}
+	if len(options.KeyIn) > 0 && !containsValue(options.KeyIn, key.Key) {
+		return false
+	}
+	if options.Processing && (key.OrderID != "" || key.ErrorCode != "") {
+		return false
+	}
+	if options.UpdatedAtLt != nil && !key.UpdatedAt.Before(*options.UpdatedAtLt) {
+		return false
+	}
+	return true
+}
+
+func (db *fakeIdempotencyDB) CreateOrderIdempotencyKey(ctx context.Context, key *model.OrderIdempotencyKey) error {
+	for _, k := range db.keys {
+		if k.UserID == key.UserID && k.Key == key.Key {
+			return errors.Wrap(errors.ErrResourceAlreadyExists, "duplicate idempotency key")
+		}
+	}
+
+	db.nextID++
+	key.ID = db.nextID
+	key.CreatedAt = db.now
+	key.UpdatedAt = db.now
+	cp := *key
+	db.keys = append(db.keys, &cp)
+	return nil
+}
+
+func (db *fakeIdempotencyDB) GetOrderIdempotencyKey(ctx context.Context, options *query.OrderIdempotencyKeyOptions) (*model.OrderIdempotencyKey, error) {
+	for _, k := range db.keys {
+		if db.match(k, options) {
+			cp := *k
+			return &cp, nil
+		}
+	}
+	return nil, errors.Wrap(errors.ErrResourceNotFound, "idempotency key not found")
+}
+
+func (db *fakeIdempotencyDB) DeleteOrderIdempotencyKey(ctx context.Context, options *query.OrderIdempotencyKeyOptions) error {
+	var res = make([]*model.OrderIdempotencyKey, 0, len(db.keys))
+	for _, k := range db.keys {
+		if !db.match(k, options) {
+			res = append(res, k)
+		}
+	}
+	db.keys = res
+	return nil
+}
+
+func TestReplayOrderRequestTakeover(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		now   = start
+		db    = &fakeIdempotencyDB{now: start}
+		s     = New(db, WithClock(func() time.Time { return now })).(*service)
+	)
+
+	first := &model.OrderIdempotencyKey{UserID: 1, Key: "key", RequestHash: "hash"}
+	require.NoError(t, db.CreateOrderIdempotencyKey(ctx, first))
+
+	// 第一次請求仍在處理中
+	retry := &model.OrderIdempotencyKey{UserID: 1, Key: "key", RequestHash: "hash"}
+	_, takeover, err := s.replayOrderRequest(ctx, retry)
+	require.ErrorIs(t, err, errors.ErrResourceUnavailable)
+	require.False(t, takeover)
+
+	// 第一次請求逾時未完成，由重送的請求接手並建立新的冪等紀錄
+	now = start.Add(orderIdempotencyProcessingTTL + time.Second)
+	_, takeover, err = s.replayOrderRequest(ctx, retry)
+	require.NoError(t, err)
+	require.True(t, takeover)
+	require.NotEqual(t, first.ID, retry.ID)
+	require.Len(t, db.keys, 1)
+
+	// 被接手的第一次請求無法再更新紀錄
+	_, err = db.GetOrderIdempotencyKey(ctx, &query.OrderIdempotencyKeyOptions{IDIn: []int64{first.ID}})
+	require.ErrorIs(t, err, errors.ErrResourceNotFound)
+}
+
+const testUserID int64 = 1
+
+// newOrderTestService 建立結帳測試用的 service
+// 商品 1 為 100 元、商品 2 為 50 元，各有 10 個庫存，用戶有 1000 平台幣及 100 點
+// 活動 1 為 1 點折抵 1 元，活動 2 只能透過優惠碼 SAVE10 使用，折抵 10 元
+func newOrderTestService() (*service, *fakeDB) {
+	db := newFakeDB()
+	db.products = []*model.Product{
+		{ID: 1, Status: model.ProductStatusOn, Price: decimal.NewFromInt(100)},
+		{ID: 2, Status: model.ProductStatusOn, Price: decimal.NewFromInt(50)},
+	}
+	for _, p := range db.products {
+		db.inventories[p.ID] = &model.Inventory{ProductID: p.ID, TotalQuantity: 10, AvailableQuantity: 10}
+	}
+	db.wallets[testUserID] = &model.Wallet{ID: 1, UserID: testUserID, Token: decimal.NewFromInt(1000), Points: 100}
+
+	couponPromotion := newTestPromotion(2, model.PromotionTypeExtraDiscount, model.PromotionStatusLive)
+	couponPromotion.CouponOnly = true
+	db.promotions = []*model.Promotion{
+		newTestPromotion(1, model.PromotionTypePoint, model.PromotionStatusLive),
+		couponPromotion,
+	}
+	db.coupons = []*model.Coupon{
+		{ID: 1, Code: "SAVE10", PromotionID: 2, MaxPerUser: 1, ExpiredAt: testNow.Add(24 * time.Hour)},
+	}
+
+	return New(db, WithClock(func() time.Time { return testNow })).(*service), db
+}
+
+// requireWallet 檢查用戶錢包的平台幣及平台點數
+func requireWallet(t *testing.T, db *fakeDB, token int64, points int32) {
+	t.Helper()
+	wallet := db.wallets[testUserID]
+	require.True(t, decimal.NewFromInt(token).Equal(wallet.Token), "token %s, expected %d", wallet.Token, token)
+	require.Equal(t, points, wallet.Points)
+}
+
+func TestCancelOrder(t *testing.T) {
+	s, db := newOrderTestService()
+	ctx := context.Background()
+
+	// 250 - 30 點 - 優惠碼 10 元
+	orderID, err := s.CreateOrder(ctx, testUserID, 30, map[int64]int32{1: 2, 2: 1}, []string{"SAVE10"}, "")
+	require.NoError(t, err)
+	requireWallet(t, db, 790, 70)
+	require.Equal(t, int32(8), db.inventories[1].AvailableQuantity)
+	require.Equal(t, int32(1), db.coupons[0].RedeemedCount)
+	require.Len(t, db.couponRedemptions, 1)
+	require.Len(t, db.redemptions, 2)
+
+	// 全額退回平台幣 & 點數，歸還庫存、優惠活動及優惠碼
+	require.NoError(t, s.CancelOrder(ctx, orderID, 99, "cancel"))
+	requireWallet(t, db, 1000, 100)
+	require.Equal(t, int32(10), db.inventories[1].AvailableQuantity)
+	require.Equal(t, int32(10), db.inventories[2].AvailableQuantity)
+	require.Zero(t, db.coupons[0].RedeemedCount)
+	require.Empty(t, db.couponRedemptions)
+	require.Empty(t, db.redemptions)
+	require.Equal(t, model.OrderStatusCancelled, db.orders[0].Status)
+
+	// 重複取消不會再退款或歸還庫存
+	err = s.CancelOrder(ctx, orderID, 99, "cancel again")
+	require.ErrorIs(t, err, errors.ErrResourceUnavailable)
+	requireWallet(t, db, 1000, 100)
+	require.Equal(t, int32(10), db.inventories[1].AvailableQuantity)
+	require.Len(t, db.histories, 2)
+}
+
+func TestRefundOrderItems(t *testing.T) {
+	s, db := newOrderTestService()
+	ctx := context.Background()
+
+	// 250 - 30 點，點數折抵依金額比例分攤，商品 1 實付 176 元 24 點，商品 2 實付 44 元 6 點
+	orderID, err := s.CreateOrder(ctx, testUserID, 30, map[int64]int32{1: 2, 2: 1}, nil, "")
+	require.NoError(t, err)
+	requireWallet(t, db, 780, 70)
+
+	items := db.orders[0].Items
+	require.True(t, decimal.NewFromInt(176).Equal(items[0].FinalPrice))
+	require.Equal(t, int32(24), items[0].UsedPoints)
+
+	// 退款數量超過購買數量
+	err = s.RefundOrderItems(ctx, orderID, map[int64]int32{items[0].ID: 3}, 99, "refund")
+	require.ErrorIs(t, err, errors.ErrInvalidInput)
+	requireWallet(t, db, 780, 70)
+
+	// 部分退款依數量比例退回平台幣 & 點數
+	require.NoError(t, s.RefundOrderItems(ctx, orderID, map[int64]int32{items[0].ID: 1}, 99, "refund"))
+	requireWallet(t, db, 868, 82)
+	require.Equal(t, int32(9), db.inventories[1].AvailableQuantity)
+	require.Equal(t, model.OrderStatusPartiallyRefunded, db.orders[0].Status)
+	require.Len(t, db.redemptions, 1)
+
+	// 已退款的數量不能再退
+	err = s.RefundOrderItems(ctx, orderID, map[int64]int32{items[0].ID: 2}, 99, "refund")
+	require.ErrorIs(t, err, errors.ErrInvalidInput)
+
+	// 退回剩餘的商品時全額退款，歸還優惠活動的使用紀錄
+	require.NoError(t, s.RefundOrderItems(ctx, orderID, map[int64]int32{items[0].ID: 1, items[1].ID: 1}, 99, "refund"))
+	requireWallet(t, db, 1000, 100)
+	require.Equal(t, model.OrderStatusRefunded, db.orders[0].Status)
+	require.Empty(t, db.redemptions)
+}
+
+func TestQuoteOrder(t *testing.T) {
+	s, db := newOrderTestService()
+	ctx := context.Background()
+
+	order, err := s.QuoteOrder(ctx, testUserID, 30, map[int64]int32{1: 2, 2: 1}, []string{"save10"})
+	require.NoError(t, err)
+	require.True(t, decimal.NewFromInt(250).Equal(order.OriginalPrice))
+	require.True(t, decimal.NewFromInt(210).Equal(order.FinalPrice))
+	require.Equal(t, int32(30), order.UsedPoints)
+	require.Equal(t, []string{"SAVE10"}, order.CouponCodes)
+
+	// 計算明細依序紀錄每個活動折抵的金額
+	require.Len(t, order.PriceBreakdown, 2)
+	require.Equal(t, model.PromotionTypePoint, order.PriceBreakdown[0].PromotionType)
+	require.True(t, decimal.NewFromInt(30).Equal(order.PriceBreakdown[0].SavedAmount))
+	require.Equal(t, "SAVE10", order.PriceBreakdown[1].CouponCode)
+	require.True(t, decimal.NewFromInt(220).Equal(order.PriceBreakdown[1].BeforePrice))
+	require.True(t, decimal.NewFromInt(10).Equal(order.PriceBreakdown[1].SavedAmount))
+
+	// 試算不扣款、不扣庫存也不紀錄優惠的使用
+	requireWallet(t, db, 1000, 100)
+	require.Equal(t, int32(10), db.inventories[1].AvailableQuantity)
+	require.Empty(t, db.orders)
+	require.Zero(t, db.coupons[0].RedeemedCount)
+	require.Empty(t, db.couponRedemptions)
+	require.Empty(t, db.redemptions)
+
+	// 獨佔活動優先套用，點數折抵沒有套用時不使用點數
+	exclusive := newTestPromotion(3, model.PromotionTypeExtraDiscount, model.PromotionStatusLive)
+	exclusive.Exclusive, exclusive.Priority = true, 10
+	db.promotions = append(db.promotions, exclusive)
+	order, err = s.QuoteOrder(ctx, testUserID, 30, map[int64]int32{1: 1}, nil)
+	require.NoError(t, err)
+	require.True(t, decimal.NewFromInt(90).Equal(order.FinalPrice))
+	require.Zero(t, order.UsedPoints)
+}
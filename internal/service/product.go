@@ -0,0 +1,170 @@
+package service
+
+import (
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+	"context"
+
+	"github.com/shopspring/decimal"
+)
+
+// CreateProduct 建立下架狀態的商品及庫存，quantity 大於 0 時以進貨紀錄初始庫存
+func (s *service) CreateProduct(ctx context.Context, name string, price decimal.Decimal, quantity int32, operatorID int64) (*model.Product, error) {
+	if name == "" {
+		return nil, errors.Wrap(errors.ErrInvalidInput, "product name is required")
+	}
+	if price.IsNegative() {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "product price %s can not be negative", price)
+	}
+	if quantity < 0 {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "product quantity %d can not be negative", quantity)
+	}
+
+	var product = &model.Product{
+		Name:   name,
+		Status: model.ProductStatusDown,
+		Price:  price,
+	}
+
+	err := s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) (err error) {
+		if err := txRepo.CreateProduct(txCtx, product); err != nil {
+			return err
+		}
+
+		if quantity > 0 {
+			if err := txRepo.UpdateInventory(txCtx,
+				&query.InventoryOptions{ProductIDIn: []int64{product.ID}},
+				&updates.Inventory{
+					TotalQuantity:     &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: quantity},
+					AvailableQuantity: &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: quantity},
+					Cause:             model.StockMovementCauseRestock,
+					OperatorID:        operatorID,
+					Note:              "initial stock",
+				},
+			); err != nil {
+				return err
+			}
+		}
+
+		product, err = txRepo.GetProduct(txCtx, &query.ProductOptions{
+			IDIn:          []int64{product.ID},
+			WithInventory: true,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// UpdateProduct 更新商品名稱及價格，上下架請使用 ShelveProduct 及 UnshelveProduct
+func (s *service) UpdateProduct(ctx context.Context, productID int64, name *string, price *decimal.Decimal) (*model.Product, error) {
+	if name == nil && price == nil {
+		return nil, errors.Wrap(errors.ErrInvalidInput, "nothing to update")
+	}
+	if name != nil && *name == "" {
+		return nil, errors.Wrap(errors.ErrInvalidInput, "product name is required")
+	}
+	if price != nil && price.IsNegative() {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "product price %s can not be negative", price)
+	}
+
+	var product *model.Product
+
+	err := s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) (err error) {
+		if _, err := txRepo.GetProduct(txCtx, &query.ProductOptions{
+			IDIn: []int64{productID},
+			Lock: true,
+		}); err != nil {
+			return err
+		}
+
+		if err := txRepo.UpdateProduct(txCtx,
+			&query.ProductOptions{IDIn: []int64{productID}},
+			&updates.Product{Name: name, Price: price},
+		); err != nil {
+			return err
+		}
+
+		product, err = txRepo.GetProduct(txCtx, &query.ProductOptions{
+			IDIn:          []int64{productID},
+			WithInventory: true,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// ShelveProduct 上架商品
+func (s *service) ShelveProduct(ctx context.Context, productID int64) error {
+	return s.transitProductStatus(ctx, productID, model.ProductStatusOn)
+}
+
+// UnshelveProduct 下架商品
+func (s *service) UnshelveProduct(ctx context.Context, productID int64) error {
+	return s.transitProductStatus(ctx, productID, model.ProductStatusDown)
+}
+
+// GetProduct 取得商品，包含商品的庫存
+func (s *service) GetProduct(ctx context.Context, productID int64) (*model.Product, error) {
+	return s.db.GetProduct(ctx, &query.ProductOptions{
+		IDIn:          []int64{productID},
+		WithInventory: true,
+	})
+}
+
+// ListProducts 依條件分頁取得商品，包含商品的庫存
+func (s *service) ListProducts(ctx context.Context, options query.ProductOptions) (products []*model.Product, nextCursor string, err error) {
+	if options.Limit <= 0 {
+		options.Limit = defaultListLimit
+	}
+	if options.Limit > maxListLimit {
+		options.Limit = maxListLimit
+	}
+	options.Lock = false
+	options.WithInventory = true
+
+	products, err = s.db.ListProducts(ctx, &options)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(products) == options.Limit {
+		nextCursor = query.NewProductCursor(products[len(products)-1]).Encode()
+	}
+
+	return products, nextCursor, nil
+}
+
+// transitProductStatus 檢查商品狀態是否可以轉換並更新商品狀態
+func (s *service) transitProductStatus(ctx context.Context, productID int64, next model.ProductStatus) error {
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		product, err := txRepo.GetProduct(txCtx, &query.ProductOptions{
+			IDIn: []int64{productID},
+			Lock: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !product.Status.CanTransitTo(next) {
+			return errors.Wrapf(errors.ErrResourceUnavailable,
+				"product(%d) status cannot transit from %s to %s", product.ID, product.Status.Str(), next.Str(),
+			)
+		}
+
+		return txRepo.UpdateProduct(txCtx,
+			&query.ProductOptions{IDIn: []int64{product.ID}},
+			&updates.Product{Status: &next},
+		)
+	})
+}
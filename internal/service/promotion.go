@@ -3,8 +3,14 @@ package service
 import (
 	"cashier/internal/model"
 	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
 	"context"
+	"sort"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 func (s *service) ListPromotions(ctx context.Context, options query.PromotionOptions) ([]*model.Promotion, error) {
@@ -15,37 +21,266 @@ func (s *service) ListPromotions(ctx context.Context, options query.PromotionOpt
 	return promotions, nil
 }
 
-// GetCurrPromotionsMap 取得目前進行的活動
-func (s *service) GetCurrPromotionsMap(ctx context.Context) (map[model.PromotionType]*model.Promotion, error) {
-	now := time.Now().UTC()
+// CreatePromotion 建立草稿狀態的優惠活動，需發布後才會被套用
+func (s *service) CreatePromotion(ctx context.Context, promotion *model.Promotion) (*model.Promotion, error) {
+	if err := promotion.Validate(); err != nil {
+		return nil, err
+	}
+
+	promotion.ID = 0
+	promotion.Status = model.PromotionStatusDraft
+	promotion.RedeemedCount = 0
+	promotion.UsedBudget = decimal.Zero
+	if err := s.db.CreatePromotion(ctx, promotion); err != nil {
+		return nil, err
+	}
+
+	return promotion, nil
+}
+
+// UpdatePromotion 修改優惠活動，修改 Extension、疊加規則或重複時段時會建立新的版本，已建立的訂單仍對應原本的版本
+// 以修改後的活動內容檢查，例如修改 EndAt 也需晚於原本的 StartAt
+// 已結束或已封存的活動不能修改，進行中的活動不能修改開始時間
+func (s *service) UpdatePromotion(ctx context.Context, promotionID int64, updatesPromotion *updates.Promotion) error {
+	if updatesPromotion.Status != nil || updatesPromotion.RedeemedCount != nil || updatesPromotion.UsedBudget != nil {
+		return errors.Wrap(errors.ErrInvalidInput, "status and usage of promotion cannot be updated directly")
+	}
+
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		promotion, err := getPromotion(txCtx, txRepo, promotionID, true)
+		if err != nil {
+			return err
+		}
+
+		if promotion.Status == model.PromotionStatusEnded || promotion.Status == model.PromotionStatusArchived {
+			return errors.Wrapf(errors.ErrResourceUnavailable,
+				"promotion(%d) status is %s", promotion.ID, promotion.Status.Str(),
+			)
+		}
+		if promotion.Status.IsLive() && updatesPromotion.StartAt != nil {
+			return errors.Wrapf(errors.ErrInvalidInput, "start time of live promotion(%d) cannot be updated", promotion.ID)
+		}
+
+		// 檢查修改後的活動
+		if updatesPromotion.Extension != nil {
+			promotion.Extension = updatesPromotion.Extension
+		}
+		if updatesPromotion.StartAt != nil {
+			promotion.StartAt = *updatesPromotion.StartAt
+		}
+		if updatesPromotion.EndAt != nil {
+			promotion.EndAt = *updatesPromotion.EndAt
+		}
+		if updatesPromotion.CouponOnly != nil {
+			promotion.CouponOnly = *updatesPromotion.CouponOnly
+		}
+		if updatesPromotion.MaxRedemptions != nil {
+			promotion.MaxRedemptions = *updatesPromotion.MaxRedemptions
+		}
+		if updatesPromotion.MaxPerUser != nil {
+			promotion.MaxPerUser = *updatesPromotion.MaxPerUser
+		}
+		if updatesPromotion.Budget != nil {
+			promotion.Budget = *updatesPromotion.Budget
+		}
+		if updatesPromotion.Priority != nil {
+			promotion.Priority = *updatesPromotion.Priority
+		}
+		if updatesPromotion.Exclusive != nil {
+			promotion.Exclusive = *updatesPromotion.Exclusive
+		}
+		if updatesPromotion.StackGroup != nil {
+			promotion.StackGroup = *updatesPromotion.StackGroup
+		}
+		if updatesPromotion.Timezone != nil {
+			promotion.Timezone = *updatesPromotion.Timezone
+		}
+		if updatesPromotion.Schedules != nil {
+			promotion.Schedules = *updatesPromotion.Schedules
+		}
+		if err := promotion.Validate(); err != nil {
+			return err
+		}
+
+		return txRepo.UpdatePromotion(txCtx, &query.PromotionOptions{IDIn: []int64{promotion.ID}}, updatesPromotion)
+	})
+}
+
+// PublishPromotion 發布草稿狀態的優惠活動，活動已開始時直接進行中
+func (s *service) PublishPromotion(ctx context.Context, promotionID int64) error {
+	now := s.now()
+
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		promotion, err := getPromotion(txCtx, txRepo, promotionID, true)
+		if err != nil {
+			return err
+		}
+
+		if !now.Before(promotion.EndAt) {
+			return errors.Wrapf(errors.ErrInvalidInput, "promotion(%d) is already ended at %s", promotion.ID, promotion.EndAt)
+		}
+
+		next := model.PromotionStatusScheduled
+		if !now.Before(promotion.StartAt) {
+			next = model.PromotionStatusLive
+		}
+
+		return transitPromotionStatus(txCtx, txRepo, promotion, next)
+	})
+}
+
+// ArchivePromotion 封存優惠活動，封存後不會再被套用也不能修改
+func (s *service) ArchivePromotion(ctx context.Context, promotionID int64) error {
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		promotion, err := getPromotion(txCtx, txRepo, promotionID, true)
+		if err != nil {
+			return err
+		}
+
+		return transitPromotionStatus(txCtx, txRepo, promotion, model.PromotionStatusArchived)
+	})
+}
+
+// ClonePromotion 以目前的活動內容複製一個草稿狀態的優惠活動，使用次數及已折抵的平台幣不會被複製
+func (s *service) ClonePromotion(ctx context.Context, promotionID int64, name string) (*model.Promotion, error) {
+	promotion, err := getPromotion(ctx, s.db, promotionID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	clone := *promotion
+	if name != "" {
+		clone.Name = name
+	}
+
+	return s.CreatePromotion(ctx, &clone)
+}
+
+// ListPromotionVersions 取得優惠活動所有版本的活動內容
+func (s *service) ListPromotionVersions(ctx context.Context, promotionID int64) ([]*model.PromotionVersion, error) {
+	return s.db.ListPromotionVersions(ctx, &query.PromotionVersionOptions{PromotionIDIn: []int64{promotionID}})
+}
+
+// SyncPromotionStatuses 依目前時間將已開始的活動改為進行中，已結束的活動改為已結束
+func (s *service) SyncPromotionStatuses(ctx context.Context) error {
+	now := s.now()
+
+	ended := model.PromotionStatusEnded
+	if err := s.db.UpdatePromotion(ctx, &query.PromotionOptions{
+		StatusIn: model.PublishedPromotionStatuses,
+		EndAtLt:  &now,
+	}, &updates.Promotion{Status: &ended}); err != nil {
+		return err
+	}
+
+	live := model.PromotionStatusLive
+	return s.db.UpdatePromotion(ctx, &query.PromotionOptions{
+		StatusIn:   []model.PromotionStatus{model.PromotionStatusScheduled},
+		StartAtLte: &now,
+	}, &updates.Promotion{Status: &live})
+}
+
+// RunPromotionScheduler 每隔 interval 同步活動狀態，直到 ctx 結束
+func (s *service) RunPromotionScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 失敗時會在下一輪重試
+			if err := s.SyncPromotionStatuses(ctx); err != nil {
+				s.errorHandler(ctx, err)
+			}
+		}
+	}
+}
+
+// getPromotion 取得單筆優惠活動，找不到時返回 errors.ErrResourceNotFound
+func getPromotion(ctx context.Context, repo iDB.IDatabase, promotionID int64, lock bool) (*model.Promotion, error) {
+	promotions, err := repo.ListPromotions(ctx, &query.PromotionOptions{
+		IDIn: []int64{promotionID},
+		Lock: lock,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(promotions) == 0 {
+		return nil, errors.Wrapf(errors.ErrResourceNotFound, "promotion(%d) not found", promotionID)
+	}
+
+	return promotions[0], nil
+}
+
+// transitPromotionStatus 檢查並變更活動狀態，必須在 transaction 內且活動已被鎖定
+func transitPromotionStatus(ctx context.Context, txRepo iDB.IDatabase, promotion *model.Promotion, next model.PromotionStatus) error {
+	if !promotion.Status.CanTransitTo(next) {
+		return errors.Wrapf(errors.ErrResourceUnavailable,
+			"promotion(%d) status cannot transit from %s to %s", promotion.ID, promotion.Status.Str(), next.Str(),
+		)
+	}
+
+	return txRepo.UpdatePromotion(ctx,
+		&query.PromotionOptions{IDIn: []int64{promotion.ID}},
+		&updates.Promotion{Status: &next},
+	)
+}
+
+// GetCurrPromotionsMap 取得 s.clock 目前時間進行中的活動，已達使用上限的活動不會被選用
+// 同一個類型可以有多個進行中的活動，依 Priority 由大到小排序，相同時依 ID 由小到大
+// 類型沒有進行中的活動時才使用預設活動
+func (s *service) GetCurrPromotionsMap(ctx context.Context) (map[model.PromotionType][]*model.Promotion, error) {
+	now := s.now()
+	couponOnly := false
 	promotions, err := s.db.ListPromotions(ctx, &query.PromotionOptions{
-		TypeIn:     []model.PromotionType{model.PromotionTypeMember, model.PromotionTypePoint, model.PromotionTypeExtraDiscount},
-		StartAtGte: &now,
-		EndAtLt:    &now,
+		CouponOnly: &couponOnly,
+		TypeIn:     model.ValidPromotionTypes,
+		StartAtLte: &now,
+		EndAtGt:    &now,
+		StatusIn:   model.PublishedPromotionStatuses,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	defaultPromotions := make(map[model.PromotionType]*model.Promotion, 0)    // 預設活動
-	processingPromotions := make(map[model.PromotionType]*model.Promotion, 0) // 進行中的活動
+	// 固定排序，衝突時每次都以相同的順序決定
+	sort.SliceStable(promotions, func(i, j int) bool {
+		if promotions[i].Priority != promotions[j].Priority {
+			return promotions[i].Priority > promotions[j].Priority
+		}
+		return promotions[i].ID < promotions[j].ID
+	})
+
+	defaultPromotions := make(map[model.PromotionType][]*model.Promotion, 0)    // 預設活動
+	processingPromotions := make(map[model.PromotionType][]*model.Promotion, 0) // 進行中的活動
 	for _, p := range promotions {
+		// 不在重複時段內或已達使用次數或預算上限的活動不套用
+		if !p.IsActive(now) || p.IsExhausted() {
+			continue
+		}
+		// 設定錯誤的活動只略過該活動，其他活動照常計算
+		if err := p.Validate(); err != nil {
+			s.errorHandler(ctx, errors.Wrapf(errors.ErrInternalServerError, "skip invalid promotion(%d): %+v", p.ID, err))
+			continue
+		}
 		if p.IsDefault {
-			defaultPromotions[p.Type] = p
+			defaultPromotions[p.Type] = append(defaultPromotions[p.Type], p)
 		} else {
-			processingPromotions[p.Type] = p
+			processingPromotions[p.Type] = append(processingPromotions[p.Type], p)
 		}
 	}
 
-	var res = make(map[model.PromotionType]*model.Promotion, len(model.ValidPromotionTypes))
+	var res = make(map[model.PromotionType][]*model.Promotion, len(model.ValidPromotionTypes))
 	for _, validType := range model.ValidPromotionTypes {
 		// 如果有進行中的則優先
-		if _, exist := processingPromotions[validType]; exist {
+		if len(processingPromotions[validType]) > 0 {
 			res[validType] = processingPromotions[validType]
 			continue
 		}
 
-		if _, exist := defaultPromotions[validType]; exist {
+		if len(defaultPromotions[validType]) > 0 {
 			res[validType] = defaultPromotions[validType]
 			continue
 		}
@@ -53,3 +288,201 @@ func (s *service) GetCurrPromotionsMap(ctx context.Context) (map[model.Promotion
 
 	return res, nil
 }
+
+// getUserRedemptions 取得用戶已使用各活動的次數，只查詢有限制每人使用次數的活動
+func getUserRedemptions(ctx context.Context, repo iDB.IDatabase, userID int64, promotions []*model.Promotion) (map[int64]int32, error) {
+	var promotionIDs = make([]int64, 0, len(promotions))
+	for _, p := range promotions {
+		if p.MaxPerUser > 0 {
+			promotionIDs = append(promotionIDs, p.ID)
+		}
+	}
+
+	var res = make(map[int64]int32, len(promotionIDs))
+	if len(promotionIDs) == 0 {
+		return res, nil
+	}
+
+	redemptions, err := repo.ListPromotionRedemptions(ctx, &query.PromotionRedemptionOptions{
+		PromotionIDIn: promotionIDs,
+		UserIDIn:      []int64{userID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range redemptions {
+		res[r.PromotionID]++
+	}
+
+	return res, nil
+}
+
+// redeemPromotions 重新檢查訂單使用的優惠活動並紀錄使用的訂單
+// 有使用限制的活動會被鎖定並重新檢查，增加使用次數 & 已使用預算，沒有限制的活動不鎖定避免熱門活動互相等待
+// 必須在 transaction 內執行，避免同時結帳超過使用上限
+func redeemPromotions(ctx context.Context, txRepo iDB.IDatabase, order *model.Order) error {
+	if len(order.PromotionIDs) == 0 {
+		return nil
+	}
+
+	// 每個活動折抵的金額 & 計算時的版本
+	var (
+		discounts = make(map[int64]decimal.Decimal, len(order.PromotionIDs))
+		versions  = make(map[int64]int32, len(order.PromotionIDs))
+	)
+	for _, id := range order.PromotionIDs {
+		discounts[id] = decimal.Zero
+	}
+	for _, step := range order.PriceBreakdown {
+		if _, exist := discounts[step.PromotionID]; exist && step.SkipReason == "" {
+			discounts[step.PromotionID] = discounts[step.PromotionID].Add(step.SavedAmount)
+			versions[step.PromotionID] = step.PromotionVersion
+		}
+	}
+
+	promotions, err := txRepo.ListPromotions(ctx, &query.PromotionOptions{IDIn: order.PromotionIDs})
+	if err != nil {
+		return err
+	}
+
+	// 鎖定並重新取得有使用限制的活動
+	var limitedIDs = make([]int64, 0, len(promotions))
+	for _, promotion := range promotions {
+		if promotion.HasLimits() {
+			limitedIDs = append(limitedIDs, promotion.ID)
+		}
+	}
+	if len(limitedIDs) > 0 {
+		limited, err := txRepo.ListPromotions(ctx, &query.PromotionOptions{
+			IDIn: limitedIDs,
+			Lock: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		var limitedMap = make(map[int64]*model.Promotion, len(limited))
+		for _, promotion := range limited {
+			limitedMap[promotion.ID] = promotion
+		}
+		for i := range promotions {
+			if promotion, exist := limitedMap[promotions[i].ID]; exist {
+				promotions[i] = promotion
+			}
+		}
+	}
+
+	userRedemptions, err := getUserRedemptions(ctx, txRepo, order.UserID, promotions)
+	if err != nil {
+		return err
+	}
+
+	for _, promotion := range promotions {
+		// 計算金額後活動被修改或停用時，不以新的內容建立訂單
+		if !promotion.Status.IsPublished() {
+			return errors.Wrapf(errors.ErrResourceUnavailable,
+				"promotion(%d) status is %s", promotion.ID, promotion.Status.Str(),
+			)
+		}
+		if promotion.Version != versions[promotion.ID] {
+			return errors.Wrapf(errors.ErrResourceUnavailable,
+				"promotion(%d) is updated to version %d, priced with version %d", promotion.ID, promotion.Version, versions[promotion.ID],
+			)
+		}
+
+		discount := discounts[promotion.ID]
+		if promotion.HasLimits() {
+			if promotion.MaxPerUser > 0 && userRedemptions[promotion.ID] >= promotion.MaxPerUser {
+				return errors.Wrapf(errors.ErrResourceInsufficient,
+					"user(%d) has reached the usage limit of promotion(%d)", order.UserID, promotion.ID,
+				)
+			}
+			if !promotion.CanRedeem(discount) {
+				return errors.Wrapf(errors.ErrResourceInsufficient,
+					"promotion(%d) usage limit or budget is reached, discount: %s", promotion.ID, discount,
+				)
+			}
+
+			if err := txRepo.UpdatePromotion(ctx,
+				&query.PromotionOptions{IDIn: []int64{promotion.ID}},
+				&updates.Promotion{
+					RedeemedCount: &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: 1},
+					UsedBudget:    &model.TokenOperation{Operation: model.NumericOperationAdd, Token: discount},
+				},
+			); err != nil {
+				return err
+			}
+		}
+
+		if err := txRepo.CreatePromotionRedemption(ctx, &model.PromotionRedemption{
+			PromotionID:    promotion.ID,
+			UserID:         order.UserID,
+			OrderID:        order.ID,
+			DiscountAmount: discount,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releasePromotions 取消訂單或全額退款時歸還訂單使用的優惠活動，扣回使用次數 & 已使用預算並刪除使用紀錄
+// 必須在 transaction 內執行
+func releasePromotions(ctx context.Context, txRepo iDB.IDatabase, order *model.Order) error {
+	redemptions, err := txRepo.ListPromotionRedemptions(ctx, &query.PromotionRedemptionOptions{
+		OrderIDIn: []string{order.ID},
+	})
+	if err != nil {
+		return err
+	}
+	if len(redemptions) == 0 {
+		return nil
+	}
+
+	var promotionIDs = make([]int64, 0, len(redemptions))
+	for _, r := range redemptions {
+		promotionIDs = append(promotionIDs, r.PromotionID)
+	}
+
+	promotions, err := txRepo.ListPromotions(ctx, &query.PromotionOptions{
+		IDIn: promotionIDs,
+		Lock: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	var promotionMap = make(map[int64]*model.Promotion, len(promotions))
+	for _, promotion := range promotions {
+		promotionMap[promotion.ID] = promotion
+	}
+
+	for _, r := range redemptions {
+		// 只有設定使用限制的活動會累計使用次數 & 已使用預算，扣回時不低於 0
+		promotion, exist := promotionMap[r.PromotionID]
+		if !exist || !promotion.HasLimits() || promotion.RedeemedCount <= 0 {
+			continue
+		}
+
+		if err := txRepo.UpdatePromotion(ctx,
+			&query.PromotionOptions{IDIn: []int64{promotion.ID}},
+			&updates.Promotion{
+				RedeemedCount: &model.QuantityOperation{Operation: model.NumericOperationSub, Quantity: 1},
+				UsedBudget: &model.TokenOperation{
+					Operation: model.NumericOperationSub,
+					Token:     decimal.Min(r.DiscountAmount, promotion.UsedBudget),
+				},
+			},
+		); err != nil {
+			return err
+		}
+		promotion.RedeemedCount--
+		promotion.UsedBudget = promotion.UsedBudget.Sub(decimal.Min(r.DiscountAmount, promotion.UsedBudget))
+	}
+
+	return txRepo.DeletePromotionRedemptions(ctx, &query.PromotionRedemptionOptions{
+		OrderIDIn: []string{order.ID},
+	})
+}
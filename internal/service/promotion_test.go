@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePromotionDB 只實作活動相關方法的 IDatabase，其他方法被呼叫時會 panic
+type fakePromotionDB struct {
+	iDB.IDatabase
+
+	promotions  []*model.Promotion
+	redemptions []*model.PromotionRedemption
+	lockedIDs   []int64 // 被鎖定過的活動ID
+}
+
+func (db *fakePromotionDB) ListPromotions(ctx context.Context, options *query.PromotionOptions) ([]*model.Promotion, error) {
+	var res = make([]*model.Promotion, 0, len(db.promotions))
+	for _, p := range db.promotions {
+		if len(options.IDIn) > 0 && !containsValue(options.IDIn, p.ID) {
+			continue
+		}
+		if len(options.TypeIn) > 0 && !containsValue(options.TypeIn, p.Type) {
+			continue
+		}
+		if len(options.StatusIn) > 0 && !containsValue(options.StatusIn, p.Status) {
+			continue
+		}
+		if options.CouponOnly != nil && p.CouponOnly != *options.CouponOnly {
+			continue
+		}
+		if options.StartAtLte != nil && p.StartAt.After(*options.StartAtLte) {
+			continue
+		}
+		if options.EndAtGt != nil && !p.EndAt.After(*options.EndAtGt) {
+			continue
+		}
+		// 返回複本，與資料庫相同不會被呼叫端修改
+		cp := *p
+		res = append(res, &cp)
+		if options.Lock {
+			db.lockedIDs = append(db.lockedIDs, p.ID)
+		}
+	}
+	return res, nil
+}
+
+func (db *fakePromotionDB) UpdatePromotion(ctx context.Context, options *query.PromotionOptions, updates *updates.Promotion) error {
+	for _, p := range db.promotions {
+		if !containsValue(options.IDIn, p.ID) {
+			continue
+		}
+		if updates.RedeemedCount != nil {
+			if updates.RedeemedCount.Operation == model.NumericOperationAdd {
+				p.RedeemedCount += updates.RedeemedCount.Quantity
+			} else {
+				p.RedeemedCount -= updates.RedeemedCount.Quantity
+			}
+		}
+		if updates.UsedBudget != nil {
+			if updates.UsedBudget.Operation == model.NumericOperationAdd {
+				p.UsedBudget = p.UsedBudget.Add(updates.UsedBudget.Token)
+			} else {
+				p.UsedBudget = p.UsedBudget.Sub(updates.UsedBudget.Token)
+			}
+		}
+	}
+	return nil
+}
+
+func (db *fakePromotionDB) CreatePromotionRedemption(ctx context.Context, redemption *model.PromotionRedemption) error {
+	db.redemptions = append(db.redemptions, redemption)
+	return nil
+}
+
+func (db *fakePromotionDB) ListPromotionRedemptions(ctx context.Context, options *query.PromotionRedemptionOptions) ([]*model.PromotionRedemption, error) {
+	var res = make([]*model.PromotionRedemption, 0, len(db.redemptions))
+	for _, r := range db.redemptions {
+		if len(options.PromotionIDIn) > 0 && !containsValue(options.PromotionIDIn, r.PromotionID) {
+			continue
+		}
+		if len(options.UserIDIn) > 0 && !containsValue(options.UserIDIn, r.UserID) {
+			continue
+		}
+		if len(options.OrderIDIn) > 0 && !containsValue(options.OrderIDIn, r.OrderID) {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func (db *fakePromotionDB) DeletePromotionRedemptions(ctx context.Context, options *query.PromotionRedemptionOptions) error {
+	var res = make([]*model.PromotionRedemption, 0, len(db.redemptions))
+	for _, r := range db.redemptions {
+		if !containsValue(options.OrderIDIn, r.OrderID) {
+			res = append(res, r)
+		}
+	}
+	db.redemptions = res
+	return nil
+}
+
+func containsValue[T comparable](values []T, target T) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestPromotion 建立 testNow 進行中的活動，活動內容依 pType 設定為可通過驗證的內容
+func newTestPromotion(id int64, pType model.PromotionType, status model.PromotionStatus) *model.Promotion {
+	var ext model.IPromotionExt
+	switch pType {
+	case model.PromotionTypeMember:
+		ext = &model.PromotionExtMember{MemberRatio: map[model.MemberType]map[int8]decimal.Decimal{
+			model.MemberTypeVIP: {1: decimal.NewFromFloat(0.9)},
+		}}
+	case model.PromotionTypeExtraDiscount:
+		ext = &model.PromotionExtExtraDiscount{DiscountType: model.DiscountTypeAmount, DiscountAmount: decimal.NewFromInt(10)}
+	default:
+		ext = &model.PromotionExtPoint{Ratio: decimal.NewFromInt(1)}
+	}
+
+	return &model.Promotion{
+		ID:        id,
+		Type:      pType,
+		Extension: ext,
+		StartAt:   testNow.Add(-time.Hour),
+		EndAt:     testNow.Add(time.Hour),
+		Status:    status,
+	}
+}
+
+func newTestService(promotions ...*model.Promotion) *service {
+	return New(&fakePromotionDB{promotions: promotions}, WithClock(func() time.Time { return testNow })).(*service)
+}
+
+func TestGetCurrPromotionsMapLegacyStatus(t *testing.T) {
+	// 加入活動狀態前建立的活動沒有狀態，視為進行中
+	s := newTestService(
+		newTestPromotion(1, model.PromotionTypePoint, model.PromotionStatusUnknown),
+		newTestPromotion(2, model.PromotionTypePoint, model.PromotionStatusDraft),
+		newTestPromotion(3, model.PromotionTypePoint, model.PromotionStatusArchived),
+	)
+
+	promotionMap, err := s.GetCurrPromotionsMap(context.Background())
+	require.NoError(t, err)
+	require.Len(t, promotionMap[model.PromotionTypePoint], 1)
+	require.Equal(t, int64(1), promotionMap[model.PromotionTypePoint][0].ID)
+}
+
+func TestGetCurrPromotionsMapSkipsInvalidPromotion(t *testing.T) {
+	// 設定錯誤的活動只略過該活動並回報錯誤，其他活動照常套用
+	invalid := newTestPromotion(1, model.PromotionTypePoint, model.PromotionStatusLive)
+	invalid.Extension = &model.PromotionExtPoint{Ratio: decimal.Zero}
+	valid := newTestPromotion(2, model.PromotionTypePoint, model.PromotionStatusLive)
+
+	var reported []error
+	s := New(&fakePromotionDB{promotions: []*model.Promotion{invalid, valid}},
+		WithClock(func() time.Time { return testNow }),
+		WithErrorHandler(func(ctx context.Context, err error) { reported = append(reported, err) }),
+	).(*service)
+
+	promotionMap, err := s.GetCurrPromotionsMap(context.Background())
+	require.NoError(t, err)
+	require.Len(t, promotionMap[model.PromotionTypePoint], 1)
+	require.Equal(t, int64(2), promotionMap[model.PromotionTypePoint][0].ID)
+	require.Len(t, reported, 1)
+	require.ErrorIs(t, reported[0], errors.ErrInternalServerError)
+}
+
+func TestRedeemAndReleasePromotions(t *testing.T) {
+	// 只有設定使用限制的活動會被鎖定並累計使用次數 & 已使用預算
+	limited := newTestPromotion(1, model.PromotionTypePoint, model.PromotionStatusLive)
+	limited.MaxRedemptions = 10
+	limited.Budget = decimal.NewFromInt(1000)
+	unlimited := newTestPromotion(2, model.PromotionTypeMember, model.PromotionStatusLive)
+
+	db := &fakePromotionDB{promotions: []*model.Promotion{limited, unlimited}}
+	order := &model.Order{
+		ID:           "order-1",
+		UserID:       1,
+		PromotionIDs: []int64{1, 2},
+		PriceBreakdown: []*model.PriceStep{
+			{PromotionID: 1, SavedAmount: decimal.NewFromInt(30)},
+			{PromotionID: 2, SavedAmount: decimal.NewFromInt(20)},
+		},
+	}
+
+	require.NoError(t, redeemPromotions(context.Background(), db, order))
+	require.Equal(t, []int64{1}, db.lockedIDs)
+	require.Equal(t, int32(1), limited.RedeemedCount)
+	require.True(t, limited.UsedBudget.Equal(decimal.NewFromInt(30)))
+	require.Equal(t, int32(0), unlimited.RedeemedCount)
+	require.Len(t, db.redemptions, 2)
+
+	// 取消訂單時扣回使用次數 & 已使用預算並刪除使用紀錄
+	require.NoError(t, releasePromotions(context.Background(), db, order))
+	require.Equal(t, int32(0), limited.RedeemedCount)
+	require.True(t, limited.UsedBudget.IsZero())
+	require.Equal(t, int32(0), unlimited.RedeemedCount)
+	require.Empty(t, db.redemptions)
+}
+
+func TestGetCurrPromotionsMapOrdering(t *testing.T) {
+	// 同一個類型可以有多個進行中的活動，依 Priority 由大到小排序，相同時依 ID 由小到大
+	var (
+		low       = newTestPromotion(1, model.PromotionTypePoint, model.PromotionStatusLive)
+		highLater = newTestPromotion(5, model.PromotionTypePoint, model.PromotionStatusLive)
+		highFirst = newTestPromotion(3, model.PromotionTypePoint, model.PromotionStatusLive)
+		member    = newTestPromotion(2, model.PromotionTypeMember, model.PromotionStatusLive)
+		// 類型已有進行中的活動時不使用預設活動
+		defaultPoint = newTestPromotion(4, model.PromotionTypePoint, model.PromotionStatusLive)
+		// 類型沒有進行中的活動時使用預設活動
+		defaultExtra = newTestPromotion(6, model.PromotionTypeExtraDiscount, model.PromotionStatusLive)
+	)
+	highLater.Priority = 10
+	highFirst.Priority = 10
+	defaultPoint.IsDefault = true
+	defaultExtra.IsDefault = true
+
+	s := newTestService(low, highLater, member, defaultPoint, highFirst, defaultExtra)
+
+	promotionMap, err := s.GetCurrPromotionsMap(context.Background())
+	require.NoError(t, err)
+
+	ids := func(promotions []*model.Promotion) []int64 {
+		var res []int64
+		for _, p := range promotions {
+			res = append(res, p.ID)
+		}
+		return res
+	}
+	require.Equal(t, []int64{3, 5, 1}, ids(promotionMap[model.PromotionTypePoint]))
+	require.Equal(t, []int64{2}, ids(promotionMap[model.PromotionTypeMember]))
+	require.Equal(t, []int64{6}, ids(promotionMap[model.PromotionTypeExtraDiscount]))
+}
+
+func TestGetCurrPromotionsMapWithClock(t *testing.T) {
+	// 台北時間每天 12:00 ~ 14:00 的活動，依 WithClock 的時間判斷是否在時段內
+	promotion := newTestPromotion(1, model.PromotionTypePoint, model.PromotionStatusLive)
+	promotion.StartAt = testNow.AddDate(0, 0, -7)
+	promotion.EndAt = testNow.AddDate(0, 0, 7)
+	promotion.Timezone = "Asia/Taipei"
+	promotion.Schedules = []*model.PromotionSchedule{{StartTime: "12:00", EndTime: "14:00"}}
+	require.NoError(t, promotion.LoadLocation())
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		active bool
+	}{
+		{name: "13:00 in taipei", now: time.Date(2024, 3, 1, 5, 0, 0, 0, time.UTC), active: true},
+		{name: "13:00 in utc", now: time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC), active: false},
+		{name: "13:00 in taipei with other zone clock", now: time.Date(2024, 3, 1, 0, 0, 0, 0, time.FixedZone("UTC-5", -5*60*60)), active: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			s := New(&fakePromotionDB{promotions: []*model.Promotion{promotion}},
+				WithClock(func() time.Time { return now }),
+			).(*service)
+
+			promotionMap, err := s.GetCurrPromotionsMap(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, tt.active, len(promotionMap[model.PromotionTypePoint]) == 1)
+		})
+	}
+}
+
+func TestUpdatePromotionValidatesMergedPromotion(t *testing.T) {
+	db := newFakeDB()
+	db.promotions = []*model.Promotion{newTestPromotion(1, model.PromotionTypePoint, model.PromotionStatusLive)}
+	s := New(db, WithClock(func() time.Time { return testNow })).(*service)
+	ctx := context.Background()
+
+	// 修改後的活動需通過驗證
+	timezone := "Mars/Olympus"
+	err := s.UpdatePromotion(ctx, 1, &updates.Promotion{Timezone: &timezone})
+	require.ErrorIs(t, err, errors.ErrInvalidInput)
+	require.Contains(t, errors.Details(err), "Timezone")
+
+	maxPerUser := int32(-1)
+	err = s.UpdatePromotion(ctx, 1, &updates.Promotion{MaxPerUser: &maxPerUser})
+	require.ErrorIs(t, err, errors.ErrInvalidInput)
+	require.Contains(t, errors.Details(err), "MaxPerUser")
+
+	schedules := []*model.PromotionSchedule{{StartTime: "25:00"}}
+	err = s.UpdatePromotion(ctx, 1, &updates.Promotion{Schedules: &schedules})
+	require.ErrorIs(t, err, errors.ErrInvalidInput)
+
+	priority, timezone := int32(10), "Asia/Taipei"
+	err = s.UpdatePromotion(ctx, 1, &updates.Promotion{Priority: &priority, Timezone: &timezone})
+	require.NoError(t, err)
+}
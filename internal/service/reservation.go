@@ -0,0 +1,250 @@
+package service
+
+import (
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+	"context"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// sweepReservationLimit 每次釋放過期保留單的最大筆數
+const sweepReservationLimit = 100
+
+// ReserveInventory 保留購物車商品的庫存，將數量從可售庫存移到保留庫存
+func (s *service) ReserveInventory(ctx context.Context, userID int64, shoppingCart map[int64]int32, ttl time.Duration) (*model.Reservation, error) {
+	if len(shoppingCart) == 0 || ttl <= 0 {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "invalid reservation, cart: %v, ttl: %s", shoppingCart, ttl)
+	}
+
+	now := s.now()
+	reservation := &model.Reservation{
+		ID:        xid.New().String(),
+		UserID:    userID,
+		Status:    model.ReservationStatusReserved,
+		ExpiredAt: now.Add(ttl),
+		Items:     make([]*model.ReservationItem, 0, len(shoppingCart)),
+	}
+
+	var productIDs = make([]int64, 0, len(shoppingCart))
+	for productID, quantity := range shoppingCart {
+		if quantity <= 0 {
+			return nil, errors.Wrapf(errors.ErrInvalidInput, "product(%d) quantity %d must be positive", productID, quantity)
+		}
+		productIDs = append(productIDs, productID)
+		reservation.Items = append(reservation.Items, &model.ReservationItem{
+			ReservationID: reservation.ID,
+			ProductID:     productID,
+			Quantity:      quantity,
+		})
+	}
+
+	err := s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		inventories, err := txRepo.ListInventories(txCtx, &query.InventoryOptions{
+			ProductIDIn: productIDs,
+			Lock:        true,
+		})
+		if err != nil {
+			return err
+		}
+		if len(inventories) != len(productIDs) {
+			return errors.Wrapf(errors.ErrResourceNotFound, "inventories of products %v not found", productIDs)
+		}
+
+		for i := range inventories {
+			// 可售庫存必須大於等於保留數量
+			if inventories[i].AvailableQuantity < shoppingCart[inventories[i].ProductID] {
+				return errors.Wrapf(errors.ErrInsufficientBalance,
+					"productID(%d) is out of stock. %d < %d",
+					inventories[i].ProductID, inventories[i].AvailableQuantity, shoppingCart[inventories[i].ProductID],
+				)
+			}
+		}
+
+		// 可售庫存 -> 保留庫存
+		for _, item := range reservation.Items {
+			if err := txRepo.UpdateInventory(txCtx,
+				&query.InventoryOptions{ProductIDIn: []int64{item.ProductID}},
+				&updates.Inventory{
+					AvailableQuantity: &model.QuantityOperation{Operation: model.NumericOperationSub, Quantity: item.Quantity},
+					ReservedQuantity:  &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: item.Quantity},
+					Cause:             model.StockMovementCauseReservation,
+					ReferenceID:       reservation.ID,
+					OperatorID:        model.OperatorSystem,
+				},
+			); err != nil {
+				return err
+			}
+		}
+
+		return txRepo.CreateReservation(txCtx, reservation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// ConfirmReservation 確認保留單，以保留的庫存建立訂單並扣款
+// 保留單已過期或不是保留中時返回 errors.ErrResourceUnavailable
+func (s *service) ConfirmReservation(ctx context.Context, reservationID string, points int32) (orderID string, err error) {
+	err = s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		reservation, err := txRepo.GetReservation(txCtx, &query.ReservationOptions{
+			IDIn:      []string{reservationID},
+			Lock:      true,
+			WithItems: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if reservation.Status != model.ReservationStatusReserved {
+			return errors.Wrapf(errors.ErrResourceUnavailable,
+				"reservation(%s) status is %s", reservation.ID, reservation.Status.Str(),
+			)
+		}
+		if reservation.IsExpired(s.now()) {
+			return errors.Wrapf(errors.ErrResourceUnavailable, "reservation(%s) is expired", reservation.ID)
+		}
+
+		order, err := s.newOrder(txCtx, xid.New().String(), &orderRequest{
+			userID:       reservation.UserID,
+			points:       points,
+			shoppingCart: reservation.ShoppingCart(),
+			reserved:     true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := s.placeOrder(txCtx, txRepo, order, reservation); err != nil {
+			return err
+		}
+
+		status := model.ReservationStatusConfirmed
+		if err := txRepo.UpdateReservation(txCtx,
+			&query.ReservationOptions{IDIn: []string{reservation.ID}},
+			&updates.Reservation{Status: &status, OrderID: &order.ID},
+		); err != nil {
+			return err
+		}
+
+		orderID = order.ID
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return orderID, nil
+}
+
+// ReleaseReservation 釋放保留中的保留單，歸還可售庫存
+func (s *service) ReleaseReservation(ctx context.Context, reservationID string) error {
+	return s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+		reservation, err := txRepo.GetReservation(txCtx, &query.ReservationOptions{
+			IDIn:      []string{reservationID},
+			Lock:      true,
+			WithItems: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if reservation.Status != model.ReservationStatusReserved {
+			return errors.Wrapf(errors.ErrResourceUnavailable,
+				"reservation(%s) status is %s", reservation.ID, reservation.Status.Str(),
+			)
+		}
+
+		return releaseReservation(txCtx, txRepo, reservation)
+	})
+}
+
+// ReleaseExpiredReservations 釋放已過期的保留單，返回釋放的數量
+func (s *service) ReleaseExpiredReservations(ctx context.Context) (released int, err error) {
+	now := s.now()
+	reservations, err := s.db.ListReservations(ctx, &query.ReservationOptions{
+		StatusIn:    []model.ReservationStatus{model.ReservationStatusReserved},
+		ExpiredAtLt: &now,
+		Limit:       sweepReservationLimit,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, r := range reservations {
+		err := s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) error {
+			// 重新鎖定，避免與確認保留單同時執行
+			reservation, err := txRepo.GetReservation(txCtx, &query.ReservationOptions{
+				IDIn:      []string{r.ID},
+				StatusIn:  []model.ReservationStatus{model.ReservationStatusReserved},
+				Lock:      true,
+				WithItems: true,
+			})
+			if err != nil {
+				return err
+			}
+
+			return releaseReservation(txCtx, txRepo, reservation)
+		})
+		if err != nil {
+			// 已被確認或釋放
+			if errors.Is(err, errors.ErrResourceNotFound) {
+				continue
+			}
+			return released, err
+		}
+		released++
+	}
+
+	return released, nil
+}
+
+// RunReservationSweeper 每隔 interval 釋放已過期的保留單，直到 ctx 結束
+func (s *service) RunReservationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 失敗的保留單會在下一輪重試
+			if _, err := s.ReleaseExpiredReservations(ctx); err != nil {
+				s.errorHandler(ctx, err)
+			}
+		}
+	}
+}
+
+// releaseReservation 將保留庫存歸還到可售庫存並標記保留單為已釋放
+// 必須在 transaction 內且保留單已被鎖定
+func releaseReservation(ctx context.Context, txRepo iDB.IDatabase, reservation *model.Reservation) error {
+	for _, item := range reservation.Items {
+		if err := txRepo.UpdateInventory(ctx,
+			&query.InventoryOptions{ProductIDIn: []int64{item.ProductID}},
+			&updates.Inventory{
+				AvailableQuantity: &model.QuantityOperation{Operation: model.NumericOperationAdd, Quantity: item.Quantity},
+				ReservedQuantity:  &model.QuantityOperation{Operation: model.NumericOperationSub, Quantity: item.Quantity},
+				Cause:             model.StockMovementCauseReservation,
+				ReferenceID:       reservation.ID,
+				OperatorID:        model.OperatorSystem,
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	status := model.ReservationStatusReleased
+	return txRepo.UpdateReservation(ctx,
+		&query.ReservationOptions{IDIn: []string{reservation.ID}},
+		&updates.Reservation{Status: &status},
+	)
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cashier/internal/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseExpiredReservations(t *testing.T) {
+	var (
+		now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		db  = newFakeDB()
+	)
+	db.inventories[1] = &model.Inventory{ProductID: 1, TotalQuantity: 10, AvailableQuantity: 7, ReservedQuantity: 3}
+	db.reservations = []*model.Reservation{
+		{
+			ID:        "expired",
+			Status:    model.ReservationStatusReserved,
+			ExpiredAt: now.Add(-time.Second),
+			Items:     []*model.ReservationItem{{ProductID: 1, Quantity: 2}},
+		},
+		{
+			ID:        "reserved",
+			Status:    model.ReservationStatusReserved,
+			ExpiredAt: now.Add(time.Minute),
+			Items:     []*model.ReservationItem{{ProductID: 1, Quantity: 1}},
+		},
+	}
+	s := New(db, WithClock(func() time.Time { return now })).(*service)
+
+	// 依 WithClock 的時間只釋放已過期的保留單
+	released, err := s.ReleaseExpiredReservations(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, released)
+	require.Equal(t, model.ReservationStatusReleased, db.reservations[0].Status)
+	require.Equal(t, model.ReservationStatusReserved, db.reservations[1].Status)
+	require.Equal(t, int32(9), db.inventories[1].AvailableQuantity)
+	require.Equal(t, int32(1), db.inventories[1].ReservedQuantity)
+}
@@ -1,13 +1,66 @@
 package service
 
-import iDB "cashier/internal/repository/database"
+import (
+	"cashier/internal/model"
+	iDB "cashier/internal/repository/database"
+	"context"
+	"time"
+)
+
+const (
+	defaultListLimit = 20  // 列表預設的筆數
+	maxListLimit     = 100 // 列表最多的筆數
+)
 
 type service struct {
 	db iDB.IDatabase
+
+	pricingMode model.PricingMode // 多個優惠活動一起計算的方式
+	clock       func() time.Time  // 取得目前時間，用來判斷進行中的活動
+
+	errorHandler func(ctx context.Context, err error) // 處理不影響請求結果的錯誤，e.g. 略過設定錯誤的活動
+}
+
+// Option 設定 service 的選項
+type Option func(*service)
+
+// WithPricingMode 設定多個優惠活動一起計算的方式，預設為 model.PricingModePriority
+func WithPricingMode(mode model.PricingMode) Option {
+	return func(s *service) {
+		s.pricingMode = mode
+	}
+}
+
+// WithClock 設定取得目前時間的方式，預設為 time.Now
+func WithClock(clock func() time.Time) Option {
+	return func(s *service) {
+		s.clock = clock
+	}
 }
 
-func New(db iDB.IDatabase) IService {
-	return &service{
-		db: db,
+// WithErrorHandler 設定處理不影響請求結果的錯誤的方式，e.g. 寫入 log 或發送告警，預設忽略
+func WithErrorHandler(handler func(ctx context.Context, err error)) Option {
+	return func(s *service) {
+		s.errorHandler = handler
 	}
 }
+
+func New(db iDB.IDatabase, opts ...Option) IService {
+	s := &service{
+		db:           db,
+		pricingMode:  model.PricingModePriority,
+		clock:        time.Now,
+		errorHandler: func(ctx context.Context, err error) {},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// now 依 clock 取得目前的 UTC 時間
+func (s *service) now() time.Time {
+	return s.clock().UTC()
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"cashier/internal/model"
+	"cashier/internal/model/query"
+	"cashier/internal/model/updates"
+	"cashier/internal/pkg/errors"
+	iDB "cashier/internal/repository/database"
+	"context"
+
+	"github.com/shopspring/decimal"
+)
+
+// TopUp 儲值平台幣
+func (s *service) TopUp(ctx context.Context, userID int64, token decimal.Decimal, reasonCode string, operatorID int64) (*model.Wallet, error) {
+	if !token.IsPositive() {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "top up token %s must be positive", token)
+	}
+
+	return s.adjustWallet(ctx, userID, token, 0, &updates.Wallet{
+		Reason:     model.WalletTransactionReasonTopUp,
+		ReasonCode: reasonCode,
+		OperatorID: operatorID,
+	})
+}
+
+// GrantPoints 發放平台點數
+func (s *service) GrantPoints(ctx context.Context, userID int64, points int32, reasonCode string, operatorID int64) (*model.Wallet, error) {
+	if points <= 0 {
+		return nil, errors.Wrapf(errors.ErrInvalidInput, "granted points %d must be positive", points)
+	}
+
+	return s.adjustWallet(ctx, userID, decimal.Zero, points, &updates.Wallet{
+		Reason:     model.WalletTransactionReasonGrantPoints,
+		ReasonCode: reasonCode,
+		OperatorID: operatorID,
+	})
+}
+
+// AdminAdjust 管理員調整平台幣及平台點數，負數為扣除
+func (s *service) AdminAdjust(ctx context.Context, userID int64, tokenDelta decimal.Decimal, pointsDelta int32, reasonCode string, operatorID int64) (*model.Wallet, error) {
+	if tokenDelta.IsZero() && pointsDelta == 0 {
+		return nil, errors.Wrap(errors.ErrInvalidInput, "nothing to adjust")
+	}
+	if reasonCode == "" {
+		return nil, errors.Wrap(errors.ErrInvalidInput, "reason code is required for admin adjustment")
+	}
+
+	return s.adjustWallet(ctx, userID, tokenDelta, pointsDelta, &updates.Wallet{
+		Reason:     model.WalletTransactionReasonAdminAdjust,
+		ReasonCode: reasonCode,
+		OperatorID: operatorID,
+	})
+}
+
+// adjustWallet 在 transaction 內異動用戶錢包，異動後的餘額不可小於 0
+// 用戶沒有錢包時，只有增加餘額才會建立錢包
+func (s *service) adjustWallet(ctx context.Context, userID int64, tokenDelta decimal.Decimal, pointsDelta int32, updatesWallet *updates.Wallet) (*model.Wallet, error) {
+	var wallet *model.Wallet
+
+	err := s.db.Transaction(ctx, func(txCtx context.Context, txRepo iDB.IDatabase) (err error) {
+		wallet, err = txRepo.GetWallet(txCtx, &query.WalletOptions{
+			UserIDIn: []int64{userID},
+			Lock:     true,
+		})
+		if err != nil {
+			if !errors.Is(err, errors.ErrResourceNotFound) || tokenDelta.IsNegative() || pointsDelta < 0 {
+				return err
+			}
+
+			wallet = &model.Wallet{UserID: userID}
+			if err := txRepo.CreateWallet(txCtx, wallet); err != nil {
+				return err
+			}
+		}
+
+		// 檢查異動後的餘額
+		if wallet.Token.Add(tokenDelta).IsNegative() {
+			return errors.Wrapf(errors.ErrInsufficientBalance,
+				"Insufficient token, wallet token %s is less than %s", wallet.Token, tokenDelta.Neg(),
+			)
+		}
+		if wallet.Points+pointsDelta < 0 {
+			return errors.Wrapf(errors.ErrInsufficientBalance,
+				"Insufficient point, wallet point %d is less than %d", wallet.Points, -pointsDelta,
+			)
+		}
+
+		if !tokenDelta.IsZero() {
+			updatesWallet.TokenOperation = &model.TokenOperation{
+				Operation: model.NumericOperationAdd,
+				Token:     tokenDelta,
+			}
+			if tokenDelta.IsNegative() {
+				updatesWallet.TokenOperation.Operation = model.NumericOperationSub
+				updatesWallet.TokenOperation.Token = tokenDelta.Neg()
+			}
+		}
+
+		if pointsDelta != 0 {
+			updatesWallet.PointsOperation = &model.PointOperation{
+				Operation: model.NumericOperationAdd,
+				Points:    pointsDelta,
+			}
+			if pointsDelta < 0 {
+				updatesWallet.PointsOperation.Operation = model.NumericOperationSub
+				updatesWallet.PointsOperation.Points = -pointsDelta
+			}
+		}
+
+		if err := txRepo.UpdateWallet(txCtx, &query.WalletOptions{IDIn: []int64{wallet.ID}}, updatesWallet); err != nil {
+			return err
+		}
+
+		wallet, err = txRepo.GetWallet(txCtx, &query.WalletOptions{IDIn: []int64{wallet.ID}})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
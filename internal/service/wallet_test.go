@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"cashier/internal/pkg/errors"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdjustWallet(t *testing.T) {
+	s, db := newOrderTestService()
+	ctx := context.Background()
+
+	wallet, err := s.TopUp(ctx, testUserID, decimal.NewFromInt(100), "promo", 99)
+	require.NoError(t, err)
+	require.True(t, decimal.NewFromInt(1100).Equal(wallet.Token))
+
+	wallet, err = s.GrantPoints(ctx, testUserID, 20, "promo", 99)
+	require.NoError(t, err)
+	require.Equal(t, int32(120), wallet.Points)
+
+	_, err = s.TopUp(ctx, testUserID, decimal.NewFromInt(-1), "promo", 99)
+	require.ErrorIs(t, err, errors.ErrInvalidInput)
+	_, err = s.GrantPoints(ctx, testUserID, 0, "promo", 99)
+	require.ErrorIs(t, err, errors.ErrInvalidInput)
+
+	// 調整後的餘額不可小於 0
+	_, err = s.AdminAdjust(ctx, testUserID, decimal.NewFromInt(-1101), 0, "fix", 99)
+	require.ErrorIs(t, err, errors.ErrInsufficientBalance)
+	_, err = s.AdminAdjust(ctx, testUserID, decimal.Zero, -121, "fix", 99)
+	require.ErrorIs(t, err, errors.ErrInsufficientBalance)
+	requireWallet(t, db, 1100, 120)
+
+	wallet, err = s.AdminAdjust(ctx, testUserID, decimal.NewFromInt(-1100), -120, "fix", 99)
+	require.NoError(t, err)
+	require.True(t, wallet.Token.IsZero())
+	require.Zero(t, wallet.Points)
+
+	_, err = s.AdminAdjust(ctx, testUserID, decimal.NewFromInt(10), 0, "", 99)
+	require.ErrorIs(t, err, errors.ErrInvalidInput)
+}
+
+func TestAdjustWalletWithoutWallet(t *testing.T) {
+	s, db := newOrderTestService()
+	ctx := context.Background()
+
+	// 沒有錢包時不能扣除餘額
+	_, err := s.AdminAdjust(ctx, 2, decimal.NewFromInt(-10), 0, "fix", 99)
+	require.ErrorIs(t, err, errors.ErrResourceNotFound)
+	require.NotContains(t, db.wallets, int64(2))
+
+	// 增加餘額時建立錢包
+	wallet, err := s.TopUp(ctx, 2, decimal.NewFromInt(10), "promo", 99)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), wallet.UserID)
+	require.True(t, decimal.NewFromInt(10).Equal(wallet.Token))
+}